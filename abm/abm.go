@@ -5,23 +5,36 @@ package abm
 
 import (
 	"cmp"
-	"errors"
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"math"
 	"math/rand"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// How the growth rate times the size of the current generation, which needn't
+// be whole, is turned into the number of children in the next generation
 type GrowthStrategy string
 
 const (
+	// Rounds down or up with equal probability
 	RANDOM GrowthStrategy = "Random"
-	FLOOR  GrowthStrategy = "Floor"
-	CEIL   GrowthStrategy = "Ceil"
-	ROUND  GrowthStrategy = "Round"
+	// Rounds down, so 1.5 times 3 agents gives 4 children
+	FLOOR GrowthStrategy = "Floor"
+	// Rounds up, so 1.5 times 3 agents gives 5 children
+	CEIL GrowthStrategy = "Ceil"
+	// Rounds to the nearest whole number, halves away from zero, so 1.5
+	// times 3 agents gives 5 children and 1.5 times 2 gives 3
+	ROUND GrowthStrategy = "Round"
+	// Draws from a Poisson distribution with that mean, so that generation
+	// sizes vary stochastically
+	POISSON GrowthStrategy = "Poisson"
 )
 
 // String implements the flag.Value interface
@@ -40,13 +53,146 @@ func (g *GrowthStrategy) Set(value string) error {
 		*g = CEIL
 	case "round":
 		*g = ROUND
+	case "poisson":
+		*g = POISSON
 	default:
-		return fmt.Errorf("invalid growth strategy: %s (valid options: random, floor, ceil, round)", value)
+		return fmt.Errorf("invalid growth strategy: %s (valid options: random, floor, ceil, round, poisson)", value)
 	}
 	return nil
 }
 
-// These can be set on the command line
+// The way genes mutate
+type MutationModel string
+
+const (
+	BACKTICK   MutationModel = "Backtick"
+	INFINITE   MutationModel = "Infinite"
+	NUCLEOTIDE MutationModel = "Nucleotide"
+)
+
+// String implements the flag.Value interface
+func (m *MutationModel) String() string {
+	return string(*m)
+}
+
+// Implement Set on flag.Set interface
+func (m *MutationModel) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "backtick":
+		*m = BACKTICK
+	case "infinite":
+		*m = INFINITE
+	case "nucleotide":
+		*m = NUCLEOTIDE
+	default:
+		return fmt.Errorf("invalid mutation model: %s (valid options: backtick, infinite, nucleotide)", value)
+	}
+	return nil
+}
+
+// What happens to agents left without a partner in monogamous mating
+type LeftoverStrategy string
+
+const (
+	DROP        LeftoverStrategy = "Drop"
+	RETRY_ANY   LeftoverStrategy = "RetryAny"
+	REPORT_ONLY LeftoverStrategy = "ReportOnly"
+)
+
+// String implements the flag.Value interface
+func (l *LeftoverStrategy) String() string {
+	return string(*l)
+}
+
+// Implement Set on flag.Set interface
+func (l *LeftoverStrategy) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "drop":
+		*l = DROP
+	case "retry-any", "retryany":
+		*l = RETRY_ANY
+	case "report-only", "reportonly":
+		*l = REPORT_ONLY
+	default:
+		return fmt.Errorf("invalid leftover strategy: %s (valid options: drop, retry-any, report-only)", value)
+	}
+	return nil
+}
+
+// An analysis that is selected by including its letter in Parameters.Analysis
+type AnalysisOption struct {
+	Letter      rune
+	Description string
+}
+
+// Every analysis that can be selected. New analyses must be registered here
+// so that ParseAnalysis accepts them and AnalysisHelp documents them.
+var AnalysisOptions = []AnalysisOption{
+	{'N', "Number of ancestors"},
+	{'C', "Number of common ancestors"},
+	{'D', "Generation differences and their histogram"},
+	{'R', "Descent paths per ancestor (pedigree redundancy)"},
+	{'O', "Pedigree collapse of each agent of the analyzed generation"},
+	{'B', "Genes shared within and between founder families in the last generation"},
+	{'T', "Mean and variance of the phenotype of the last generation"},
+	{'K', "Mean kinship of each generation"},
+	{'I', "Inbreeding coefficients of the analyzed generation"},
+	{'F', "Summary of the founders and their contributions to the last generation"},
+	{'S', "Reproductive success by sex of the parents of the analyzed generation"},
+	{'L', "Fixation and loss of founder lineages in the last generation"},
+	{'X', "Number of founder lineages surviving in each generation"},
+	{'P', "Size and realized growth of each generation compared to the growth rate"},
+	{'Y', "Distinct Y haplotypes among the males of the last generation"},
+	{'M', "Distinct mitochondrial haplotypes in the last generation"},
+	{'H', "Gene diversity of each generation"},
+	{'E', "Effective population size of each generation from the variance in offspring"},
+	{'G', "Gene analysis"},
+	{'g', "Only do gene analysis on last generation"},
+}
+
+// Set of analyses selected by an analysis string
+type AnalysisSet map[rune]struct{}
+
+// Parses an analysis string such as "NCDGg" into the set of selected
+// analyses, returning an error for any letter that isn't registered in
+// AnalysisOptions.
+func ParseAnalysis(s string) (AnalysisSet, error) {
+	set := make(AnalysisSet)
+	for _, letter := range s {
+		if !slices.ContainsFunc(AnalysisOptions, func(o AnalysisOption) bool {
+			return o.Letter == letter
+		}) {
+			var valid strings.Builder
+			for _, o := range AnalysisOptions {
+				valid.WriteRune(o.Letter)
+			}
+			return nil, fmt.Errorf("invalid analysis: %c (valid options: %s)", letter, valid.String())
+		}
+		set[letter] = struct{}{}
+	}
+	return set, nil
+}
+
+// Checks if the analysis with the given letter is selected
+func (a AnalysisSet) Has(letter rune) bool {
+	_, found := a[letter]
+	return found
+}
+
+// Returns a description of every analysis, one per line, for help text
+func AnalysisHelp() string {
+	var help strings.Builder
+	for i, o := range AnalysisOptions {
+		if i > 0 {
+			help.WriteString("\n")
+		}
+		fmt.Fprintf(&help, "%c - %s", o.Letter, o.Description)
+	}
+	return help.String()
+}
+
+// These can be set on the command line. The function parameters can't be
+// saved as JSON, so they are left out of it.
 type Parameters struct {
 	SimulationId int
 	NumAgents    int
@@ -63,29 +209,318 @@ type Parameters struct {
 	MateCousin   bool
 	MateSameSex  bool
 	Analysis     string
+	// Generation to analyze, 0 for the last one
+	AnalysisGen int
+	// Number of randomly sampled pairs of agents the C analysis estimates
+	// the common ancestors from, 0 to compare every pair
+	CommonAncestorSamples int
+	// Seed for all random numbers, 0 picks a random seed
+	Seed int64
+	// How genes mutate, and for the nucleotide model the number of sites per
+	// gene and the ratio of transition to transversion substitutions
+	MutationModel MutationModel
+	GeneLength    int
+	TsTvRatio     float64
+	// Probability that an agent dies before it can reproduce. If
+	// MortalityFunc is set it is used instead, called with the agent's age,
+	// which is its generation, i.e. its depth below the founders. When
+	// generations overlap that isn't its age when it faces mortality.
+	MortalityRate float64
+	MortalityFunc func(age int) float64 `json:"-"`
+	// Use the version-stable random number generator, see rng.go
+	StableRng bool
+	// Determines the sex of a child of the given parents. nil gives each
+	// child SexRatio chance of being male.
+	SexDeterminer func(father, mother *Agent, rng Rng) Sex `json:"-"`
+	// Largest number of children an agent can have under non-monogamous
+	// mating, 0 for no limit. Agents at the limit are skipped when they are
+	// picked as parents, giving up after MatingK tries.
+	MaxOffspring int
+	// Give agents two alleles at each of the NumGenes loci, one inherited from
+	// each parent, instead of one inherited from either. The founders' two
+	// alleles at a locus are labelled a and b.
+	Diploid bool
+	// Probability that a founder or child is male, from 0 for an all female
+	// population to 1 for an all male one.
+	SexRatio float64
+	// What happens to agents that monogamous mating leaves without a
+	// partner. Dropped agents don't reproduce. With RetryAny they get a
+	// second chance to pair with any other unpaired agent, not only those
+	// within MatingK. ReportOnly drops them and prints how many there are.
+	Leftover LeftoverStrategy
+	// Returns the fitness of an agent with the given genes. Fitter agents are
+	// picked to reproduce proportionately more often, and fitter monogamous
+	// pairs have proportionately more children. nil gives every agent the
+	// same fitness, unless FitnessAdvantage is set.
+	FitnessFunc func(genes []string) float64 `json:"-"`
+	// Selection on one gene when there is no FitnessFunc: agents carrying an
+	// allele of gene FitnessGene, counted from 0, with a backtick mutation
+	// have fitness 1 + FitnessAdvantage instead of 1. 0 for no selection.
+	FitnessGene      int
+	FitnessAdvantage float64
+	// Number of generations the per-generation series are also reported as
+	// rolling means over, 1 or less for none
+	Window int
+	// Number of generations back that ancestors are searched for, 0 for all
+	MaxAncestorDepth int
+	// Number of generations of ancestors stored with each agent, 0 for all.
+	// Storing fewer saves memory in long runs; Ancestors recomputes deeper
+	// ones on demand. The analyses that use stored ancestors, N, C, D, R and
+	// the ancestor graph, only see this many generations, so they are exact
+	// only if it is at least the number of generations analyzed.
+	AncestorCacheDepth int
+	// Seed for the founders, so that replicates can share them while their
+	// reproduction differs. 0 uses Seed.
+	FounderSeed int64
+	// Called with the statistics of each generation as soon as it is made,
+	// so that long runs can be followed without analyzing their history.
+	// Mean kinship takes time and memory quadratic in the generation size,
+	// so it is only calculated if IncrementalKinship is set.
+	OnGeneration       func(GenerationStats) `json:"-"`
+	IncrementalKinship bool
+	// Report the coalescent expectations next to the simulated results of
+	// the C and D analyses, see coalescent.go
+	Coalescent bool
+	// Effective population size for the coalescent expectations, 0 for the
+	// harmonic mean of the generation sizes
+	EffectiveSize float64
+	// Let agents of earlier generations that haven't died stay in the mating
+	// pool alongside the newest generation, facing the mortality again each
+	// generation they are in it. Because the pool keeps growing, so does the
+	// population unless mortality or FertilityMax limits it.
+	Overlap bool
+	// Ages, in generations, between which agents can mate, where an agent's
+	// age is the number of generations since its own. 0 and 0 give
+	// non-overlapping generations in which only the latest one mates, or
+	// with Overlap no age limit. Otherwise generations overlap, and agents
+	// stay in the mating pool until they are older than FertilityMax.
+	// Founders start at FertilityMin.
+	FertilityMin int
+	FertilityMax int
+	// Probability that each of a child's uniparental markers, its Y and
+	// mitochondrial haplotypes, mutates, see haplotype.go
+	HaplotypeMutationRate float64
+	// Largest distance between agents that can mate, which makes the
+	// simulation spatial: founders are placed at random in a unit square and
+	// children at the midpoint of their parents moved by up to Dispersal in
+	// each direction. 0 for no spatial structure.
+	MatingRadius float64
+	Dispersal    float64
+	// Number of generations between migrations when simulations are run as
+	// islands, see island.go, 0 for none
+	MigrationInterval int
+	// Fraction of each island's current generation that emigrates to the
+	// next island at each migration, from 0 to 1
+	MigrationRate float64
+	// Whether to record every mating in the mating log, see
+	// Simulation.MatingLog
+	LogMatings bool
+	// Number of mating types agents are divided into instead of the two
+	// sexes, for values above 2. Types 0 and 1 are MALE and FEMALE and the
+	// rest are neither. Each agent is of a type picked uniformly at random,
+	// and compatible agents must be of different types unless MateSameSex is
+	// set.
+	NumMatingTypes int
+	// Number of the latest generations to keep, discarding older ones after
+	// each generation is made so that memory stays bounded on long runs, 0
+	// to keep them all. Agents whose parents are discarded become founders,
+	// and the discarded generations are empty, so the ancestry analyses,
+	// which need the pedigree back to the real founders, fail with
+	// AncestorsDiscarded. At least 3 are needed so that the parents and
+	// grandparents of the agents that mate, which compatibility checks use,
+	// are kept.
+	KeepGenerations int
+	// Whether non-monogamous mating with compatibility checks picks, of the
+	// MatingK candidates, the compatible one sharing the most genes with
+	// the agent instead of the first compatible one
+	AssortativeMating bool
+	// Whether the ancestors of the analyzed generation are built by merging
+	// their parents' ancestors, which are set first, instead of by searching
+	// the pedigree from each agent. It is faster on deep pedigrees but
+	// stores the ancestors of the earlier generations too.
+	IncrementalAncestors bool
+	// Number of families the founders are divided into, founder i being in
+	// family i modulo FounderFamilies, to model a population that already
+	// has structure. The founders of a family share the alleles of its first
+	// founder at the first half of the loci, rounded up. 1 or less for
+	// unrelated founders.
+	FounderFamilies int
+	// Whether non-monogamous mating with compatibility checks picks, of the
+	// MatingK candidates, the compatible one with the lowest kinship with
+	// the agent instead of the first compatible one
+	AvoidInbreeding bool
+	// Number of generations between the checkpoints Simulate writes to
+	// CheckpointPath, 0 for none. A checkpoint is the simulation as
+	// WriteJSON writes it, from which ResumeSimulation carries on. Islands
+	// aren't checkpointed.
+	CheckpointEvery int
+	CheckpointPath  string
+	// Largest number of agents, counting every generation, a simulation can
+	// have, 0 for no limit. Simulate stops with a PopulationLimit error
+	// instead of adding a generation that would take it over the limit.
+	MaxPopulation int
+	// Variance of the environmental noise added to the mean of the parents'
+	// phenotypes to make a child's, 0 for none
+	EnvVariance float64
+}
+
+// Checks that the parameters are in range
+func (p *Parameters) Validate() error {
+	if p.NumAgents < 0 || p.Generations < 0 || p.NumGenes < 0 {
+		return fmt.Errorf("agents %d, generations %d and genes %d can't be negative",
+			p.NumAgents, p.Generations, p.NumGenes)
+	}
+	if p.GrowthRate <= 0.0 {
+		return fmt.Errorf("growth rate %g not greater than 0", p.GrowthRate)
+	}
+	// Only mating without compatibility checks can pick mates without
+	// searching for them
+	if p.MatingK < 0 || (p.MatingK == 0 && (p.Monogamous || p.Compatible)) {
+		return fmt.Errorf("mating k %d not greater than 0 with monogamous or compatible mating", p.MatingK)
+	}
+	if p.MutationRate < 0.0 || p.MutationRate > 1.0 {
+		return fmt.Errorf("mutation rate %g not in range 0 to 1", p.MutationRate)
+	}
+	if p.HaplotypeMutationRate < 0.0 || p.HaplotypeMutationRate > 1.0 {
+		return fmt.Errorf("haplotype mutation rate %g not in range 0 to 1", p.HaplotypeMutationRate)
+	}
+	if p.MortalityRate < 0.0 || p.MortalityRate > 1.0 {
+		return fmt.Errorf("mortality rate %g not in range 0 to 1", p.MortalityRate)
+	}
+	if p.MutationModel == NUCLEOTIDE && p.GeneLength <= 0 {
+		return fmt.Errorf("gene length %d not greater than 0 with the nucleotide model", p.GeneLength)
+	}
+	if p.AnalysisGen < 0 || p.CommonAncestorSamples < 0 || p.MaxOffspring < 0 {
+		return fmt.Errorf("analysis generation %d, common ancestor samples %d and max offspring %d can't be negative",
+			p.AnalysisGen, p.CommonAncestorSamples, p.MaxOffspring)
+	}
+	if p.SexRatio < 0.0 || p.SexRatio > 1.0 {
+		return fmt.Errorf("sex ratio %g not in range 0 to 1", p.SexRatio)
+	}
+	if p.FitnessAdvantage != 0.0 && (p.FitnessGene < 0 || p.FitnessGene >= p.NumGenes) {
+		return fmt.Errorf("fitness gene %d not in range 0 to %d", p.FitnessGene, p.NumGenes-1)
+	}
+	if p.FitnessAdvantage < -1.0 {
+		return fmt.Errorf("fitness advantage %g less than -1", p.FitnessAdvantage)
+	}
+	if p.FertilityMin < 0 || (p.FertilityMax < p.FertilityMin && (p.FertilityMax > 0 || !p.Overlap)) {
+		return fmt.Errorf("fertility ages %d to %d not a range of ages", p.FertilityMin, p.FertilityMax)
+	}
+	if p.MatingRadius < 0.0 || p.Dispersal < 0.0 {
+		return fmt.Errorf("mating radius %g and dispersal %g can't be negative", p.MatingRadius, p.Dispersal)
+	}
+	if p.MigrationRate < 0.0 || p.MigrationRate > 1.0 {
+		return fmt.Errorf("migration rate %g not in range 0 to 1", p.MigrationRate)
+	}
+	if p.NumMatingTypes < 0 {
+		return fmt.Errorf("number of mating types %d can't be negative", p.NumMatingTypes)
+	}
+	if p.KeepGenerations < 0 || p.KeepGenerations == 1 || p.KeepGenerations == 2 {
+		return fmt.Errorf("generations to keep %d not 0 or at least 3", p.KeepGenerations)
+	}
+	if p.AssortativeMating && p.AvoidInbreeding {
+		return fmt.Errorf("assortative mating and inbreeding avoidance can't both be chosen")
+	}
+	if p.CheckpointEvery < 0 {
+		return fmt.Errorf("checkpoint interval %d can't be negative", p.CheckpointEvery)
+	}
+	if p.CheckpointEvery > 0 && p.CheckpointPath == "" {
+		return fmt.Errorf("checkpoint every %d generations needs a checkpoint path", p.CheckpointEvery)
+	}
+	if p.MaxPopulation < 0 || (p.MaxPopulation > 0 && p.MaxPopulation < p.NumAgents) {
+		return fmt.Errorf("maximum population %d not 0 or at least the %d founders", p.MaxPopulation, p.NumAgents)
+	}
+	if p.EnvVariance < 0.0 {
+		return fmt.Errorf("environmental variance %g can't be negative", p.EnvVariance)
+	}
+	if p.FounderFamilies < 0 {
+		return fmt.Errorf("number of founder families %d can't be negative", p.FounderFamilies)
+	}
+	if p.KeepGenerations > 0 && p.overlapping() {
+		return fmt.Errorf("generations can't be discarded when they overlap")
+	}
+	return nil
 }
 
 // Sets the default values for the parameters
 func NewParameters() Parameters {
 	return Parameters{
-		SimulationId: 0,
-		NumAgents:    2,
-		Generations:  32,
-		GrowthRate:   1.02,
-		Strategy:     RANDOM,
-		Monogamous:   false,
-		MatingK:      50,
-		NumGenes:     10,
-		MutationRate: 0.0,
-		Compatible:   false,
-		MateSelf:     false,
-		MateSibling:  false,
-		MateCousin:   false,
-		MateSameSex:  false,
-		Analysis:     "NCDGg",
+		SimulationId:          0,
+		NumAgents:             2,
+		Generations:           32,
+		GrowthRate:            1.02,
+		Strategy:              RANDOM,
+		Monogamous:            false,
+		MatingK:               50,
+		NumGenes:              10,
+		MutationRate:          0.0,
+		Compatible:            false,
+		MateSelf:              false,
+		MateSibling:           false,
+		MateCousin:            false,
+		MateSameSex:           false,
+		Analysis:              "NCDGg",
+		AnalysisGen:           0,
+		CommonAncestorSamples: 0,
+		Seed:                  0,
+		MutationModel:         BACKTICK,
+		GeneLength:            10,
+		TsTvRatio:             2.0,
+		MortalityRate:         0.0,
+		StableRng:             false,
+		FounderSeed:           0,
+		MaxAncestorDepth:      0,
+		AncestorCacheDepth:    0,
+		Window:                0,
+		Leftover:              DROP,
+		Coalescent:            false,
+		SexRatio:              0.5,
+		MaxOffspring:          0,
+		Diploid:               false,
+		EffectiveSize:         0.0,
+		FitnessGene:           0,
+		FitnessAdvantage:      0.0,
+		Overlap:               false,
+		FertilityMin:          0,
+		FertilityMax:          0,
+		HaplotypeMutationRate: 0.0,
+		MatingRadius:          0.0,
+		Dispersal:             0.0,
+		MigrationInterval:     0,
+		MigrationRate:         0.0,
+		LogMatings:            false,
+		NumMatingTypes:        0,
+		KeepGenerations:       0,
+		AssortativeMating:     false,
+		IncrementalAncestors:  false,
+		FounderFamilies:       0,
+		AvoidInbreeding:       false,
+		CheckpointEvery:       0,
+		CheckpointPath:        "",
+		MaxPopulation:         0,
+		EnvVariance:           0.0,
+	}
+}
+
+// Returns the number of agents a simulation with these parameters is expected
+// to end with, counting every generation, by growing each generation from the
+// last with the CEIL strategy. It is exact for the CEIL strategy without
+// mortality, overlapping generations or discarded generations, and close
+// for the other strategies. It saturates at math.MaxInt.
+func (p Parameters) ProjectedAgents() int {
+	size := float64(p.NumAgents)
+	total := size
+	for range p.Generations {
+		size = math.Ceil(p.GrowthRate * size)
+		total += size
+		if total >= math.MaxInt {
+			return math.MaxInt
+		}
 	}
+	return int(total)
 }
 
+// The sex, or more generally the mating type, of an agent
 type Sex int
 
 const (
@@ -96,29 +531,107 @@ const (
 // Data structure for each individual in the simulation.
 // We keep both an array and set of ancestors because sometimes
 // one is more efficient to use than the other.
-// Genes are of the form [0-9]+\-[0-9]+`*
-// The first integer is the agent id. The second is the number of the gene.
-// Each backtick represents a mutation.
+// Genes are of the form [0-9]+\-[0-9]+ followed by the mutation state.
+// The first integer is the founder agent id. The second is the number of the gene.
+// With the backtick mutation model each backtick represents a mutation. With
+// the infinite alleles model a mutation replaces any #[0-9]+ suffix with a
+// new, never before seen one. With the nucleotide model the gene is followed
+// by :[ACGT]+, the state of each of its sites.
+// Founders have no known parents, and their mother and father are ignored.
+// Every agent in generation 0 is a founder, but imported pedigrees can also
+// have founders in later generations.
 type Agent struct {
 	id          int
 	generation  int
 	sex         Sex
+	founder     bool
+	dead        bool
 	mother      int
 	father      int
 	children    []int
 	ancestorVec []int
 	ancestorSet map[int]struct{}
 	genes       []string
+	// Position in the unit square when the simulation is spatial
+	x, y float64
+	// Marker inherited only from father to son, labelled with the male
+	// founder it comes from, see haplotype.go. Empty for females.
+	yHaplotype string
+	// Marker inherited only from the mother by every child, labelled with the
+	// female founder it comes from. Empty for male founders.
+	mtHaplotype string
+	// Value of a quantitative trait, see phenotype.go
+	phenotype float64
+	// Index of the agent's family in the kin groups of the generation being
+	// paired, see kin.go
+	kin int
+}
+
+// Returns the agent's id
+func (a *Agent) Id() int {
+	return a.id
+}
+
+// Returns the generation the agent was born in
+func (a *Agent) Generation() int {
+	return a.generation
+}
+
+// Returns the agent's sex
+func (a *Agent) Sex() Sex {
+	return a.sex
+}
+
+// Returns the value of the agent's quantitative trait
+func (a *Agent) Phenotype() float64 {
+	return a.phenotype
+}
+
+// Returns the agent's genes, which must not be modified. In a diploid
+// simulation the two alleles of each locus are consecutive.
+func (a *Agent) Genes() []string {
+	return a.genes
+}
+
+// Returns the two alleles at each locus of an agent in a diploid simulation,
+// its mother's then its father's, or nil if the simulation is haploid
+func (s *Simulation) Loci(id int) [][2]string {
+	if !s.params.Diploid {
+		return nil
+	}
+	genes := s.agents[id].genes
+	loci := make([][2]string, len(genes)/2)
+	for i := range loci {
+		loci[i] = [2]string{genes[2*i], genes[2*i+1]}
+	}
+	return loci
+}
+
+// Returns the number of generations from the agent's generation to the given
+// one
+func (a *Agent) age(currentGen int) int {
+	return currentGen - a.generation
+}
+
+// Returns the agent's position, which is 0, 0 unless the simulation is
+// spatial
+func (a *Agent) Position() (x, y float64) {
+	return a.x, a.y
+}
+
+// Checks if an agent has no known parents
+func (a *Agent) isFounder() bool {
+	return a.founder || a.generation == 0
 }
 
 // Checks if two agents share a mother or father in which case they are siblings.
 func isSibling(a, b *Agent) bool {
-	return a.generation > 0 && (a.mother == b.mother || a.father == b.father)
+	return !a.isFounder() && !b.isFounder() && (a.mother == b.mother || a.father == b.father)
 }
 
 // Check if two agents share a grandparent in which case they are cousins.
 func isCousin(agents []Agent, a, b *Agent) bool {
-	if a.generation < 2 || b.generation < 2 {
+	if a.isFounder() || b.isFounder() {
 		return false
 	}
 	aMother := agents[a.mother]
@@ -130,40 +643,102 @@ func isCousin(agents []Agent, a, b *Agent) bool {
 		isSibling(&aFather, &bMother) || isSibling(&aFather, &bFather)
 }
 
-// Finds all the ancestors for a given agent. id is the id of the agent for whom to calculate
-func setAncestors(agents []Agent, id int) {
+// Finds all the ancestors for a given agent. id is the id of the agent for whom to calculate.
+// If maxDepth is greater than 0 only ancestors at most that many generations
+// before the agent are found.
+func setAncestors(agents []Agent, id int, maxDepth int) {
+	agents[id].ancestorVec, agents[id].ancestorSet = findAncestors(agents, id, maxDepth)
+}
+
+// Sets the ancestors of an agent to its parents and their ancestors, merging
+// the parents' sorted ancestors instead of searching the pedigree. If either
+// parent's ancestors haven't been set it falls back to setAncestors. maxDepth
+// must be the depth the parents' ancestors were set with.
+func setAncestorsFromParents(agents []Agent, id int, maxDepth int) {
+	agent := &agents[id]
+	if agent.isFounder() {
+		setAncestors(agents, id, maxDepth)
+		return
+	}
+	mother, father := &agents[agent.mother], &agents[agent.father]
+	if mother.ancestorSet == nil || father.ancestorSet == nil {
+		setAncestors(agents, id, maxDepth)
+		return
+	}
+	// Ancestors within the parents' depth can be too far back for the child's
+	inDepth := func(ancestor int) bool {
+		return maxDepth <= 0 || agent.generation-agents[ancestor].generation <= maxDepth
+	}
+	ancestorVec := make([]int, 0, len(mother.ancestorVec)+len(father.ancestorVec)+2)
+	add := func(ancestor int) {
+		if inDepth(ancestor) && (len(ancestorVec) == 0 || ancestorVec[len(ancestorVec)-1] != ancestor) {
+			ancestorVec = append(ancestorVec, ancestor)
+		}
+	}
+	// Each parent has a higher id than its ancestors, so it goes at the end
+	// of its own sorted ancestors
+	a := append(slices.Clip(mother.ancestorVec), agent.mother)
+	b := append(slices.Clip(father.ancestorVec), agent.father)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			add(a[i])
+			i++
+		case a[i] > b[j]:
+			add(b[j])
+			j++
+		default:
+			add(a[i])
+			i++
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(a[i])
+	}
+	for ; j < len(b); j++ {
+		add(b[j])
+	}
+	ancestorSet := make(map[int]struct{}, len(ancestorVec))
+	for _, ancestor := range ancestorVec {
+		ancestorSet[ancestor] = struct{}{}
+	}
+	agent.ancestorVec, agent.ancestorSet = ancestorVec, ancestorSet
+}
+
+// Returns the sorted ancestors of an agent, and the same ancestors as a set,
+// without storing them
+func findAncestors(agents []Agent, id int, maxDepth int) ([]int, map[int]struct{}) {
 	ancestorSet := make(map[int]struct{})
 	ancestorVec := make([]int, 0, agents[id].generation*2)
 	ancestorVec = append(ancestorVec, id)
 	generation := agents[id].generation
-	sp := 0
-	for sp < len(ancestorVec) {
-		curr := ancestorVec[sp]
-		currGen := agents[curr].generation
-		if currGen == 0 { // The zero generation has no ancestry
-			break
+	for sp := 0; sp < len(ancestorVec); sp++ {
+		curr := &agents[ancestorVec[sp]]
+		if curr.isFounder() { // Founders have no known ancestry
+			continue
 		}
-		mother := agents[curr].mother
-		father := agents[curr].father
-		parents := [...]int{mother, father}
+		parents := [...]int{curr.mother, curr.father}
 		for _, parent := range parents {
+			if maxDepth > 0 && generation-agents[parent].generation > maxDepth {
+				continue
+			}
 			if _, found := ancestorSet[parent]; !found {
 				ancestorVec = append(ancestorVec, parent)
 				ancestorSet[parent] = struct{}{}
 			}
 		}
-		sp += 1
-		if currGen < generation {
-			generation = currGen
-		}
 	}
 	slices.Sort(ancestorVec)
-	ancestorVec = ancestorVec[:len(ancestorVec)-1] // Remove self
-	agents[id].ancestorVec = ancestorVec
-	agents[id].ancestorSet = ancestorSet
+	return ancestorVec[:len(ancestorVec)-1], ancestorSet // Remove self
 }
 
-// Generic function to count the number of common elements in two ordered arrays
+// Generic function to count the number of common elements in two ordered arrays.
+// Each element is matched with at most one equal element of the other array,
+// so for arrays without duplicates, such as ancestorVec, this is the size of
+// the set intersection, and for arrays with duplicates it is the size of the
+// multiset intersection, like CountCommonMultiset.
 func CountCommonElementsSortedArray[S ~[]E, E cmp.Ordered](vecA S, vecB S) int {
 	i, j, total := 0, 0, 0
 	for i < len(vecA) && j < len(vecB) {
@@ -181,21 +756,99 @@ func CountCommonElementsSortedArray[S ~[]E, E cmp.Ordered](vecA S, vecB S) int {
 	return total
 }
 
-// Calculates the number of generations back you need to go to find a common
-// ancestor between two agents. Maximum value is last generation.
+// Counts the distinct values that are in both ordered arrays, so that each
+// shared value is counted once however many times it is repeated: {2, 2} and
+// {2, 2} have 1 in common. This is the sorted version of CountCommonSet.
+func CountDistinctCommonElementsSortedArray[S ~[]E, E cmp.Ordered](vecA S, vecB S) int {
+	i, j, total := 0, 0, 0
+	for i < len(vecA) && j < len(vecB) {
+		switch {
+		case vecA[i] < vecB[j]:
+			i++
+		case vecA[i] > vecB[j]:
+			j++
+		default:
+			total++
+			value := vecA[i]
+			for i < len(vecA) && vecA[i] == value {
+				i++
+			}
+			for j < len(vecB) && vecB[j] == value {
+				j++
+			}
+		}
+	}
+	return total
+}
 
-func generationDiff(agents []Agent, a *Agent, b *Agent) int {
-	generationFound := 0
+// Counts the distinct values that are in both slices, which needn't be
+// sorted. Duplicates are ignored, so {2, 2} and {2, 2} have 1 in common.
+func CountCommonSet[S ~[]E, E comparable](a S, b S) int {
+	inA := make(map[E]struct{}, len(a))
+	for _, e := range a {
+		inA[e] = struct{}{}
+	}
+	total := 0
+	for _, e := range b {
+		if _, found := inA[e]; found {
+			total++
+			delete(inA, e)
+		}
+	}
+	return total
+}
+
+// Counts the elements two slices, which needn't be sorted, have in common
+// as multisets: each value counts the smaller number of times it occurs in
+// either, so {2, 2, 3} and {2, 2, 2} have 2 in common. Use this for gene
+// vectors, which can have duplicate labels.
+func CountCommonMultiset[S ~[]E, E comparable](a S, b S) int {
+	counts := make(map[E]int, len(a))
+	for _, e := range a {
+		counts[e]++
+	}
+	total := 0
+	for _, e := range b {
+		if counts[e] > 0 {
+			total++
+			counts[e]--
+		}
+	}
+	return total
+}
+
+// Finds the most recent common ancestor of two agents, i.e. the common
+// ancestor with the highest id, whose ancestors must already be set.
+func mrca(a *Agent, b *Agent) (int, bool) {
 	for i := len(a.ancestorVec) - 1; i >= 0; i-- {
 		index := a.ancestorVec[i]
 		if _, found := b.ancestorSet[index]; found {
-			generationFound = agents[index].generation
-			break
+			return index, true
 		}
 	}
+	return 0, false
+}
+
+// Calculates the number of generations back you need to go to find a common
+// ancestor between two agents. Maximum value is last generation.
+
+func generationDiff(agents []Agent, a *Agent, b *Agent) int {
+	generationFound := 0
+	if index, found := mrca(a, b); found {
+		generationFound = agents[index].generation
+	}
 	return a.generation - generationFound
 }
 
+// Adds two non-negative path counts, saturating at math.MaxInt rather than
+// overflowing.
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
 // Used to keep track of agents that are in mating pool.
 type selectedAgent struct {
 	id    int
@@ -208,6 +861,16 @@ type matingPair struct {
 	female int
 }
 
+// A mating recorded in the mating log. The male and female are the agents
+// in the roles of father and mother, who can be of the same sex if
+// compatibility isn't checked.
+type MatingEvent struct {
+	Generation int
+	Male       int
+	Female     int
+	Child      int
+}
+
 // Data structure used by the simulation engine to manage
 // state.
 type Simulation struct {
@@ -221,45 +884,194 @@ type Simulation struct {
 	genBdrys []int
 	// Agents that are paired to reproduce
 	matingPairs []matingPair
+	// Number of agents left without a partner by monogamous mating in each
+	// generation, starting with generation 1
+	unmatched []int
 	// User specified parameters
 	params Parameters
+	// Seed from which every random number in the simulation is derived
+	seed int64
+	// Random number generator for the current stage of the simulation
+	rng Rng
+	// Number of mutations so far, used to label new infinite alleles
+	numMutations int
+	// How long each generation and each selected analysis took
+	genTimes      []time.Duration
+	analysisTimes []AnalysisTime
+	// Kinship of the latest generation, kept for incremental statistics
+	kinship *kinshipMatrix
+	// Kinship coefficients memoized by Kinship
+	kinships *kinshipTable
+	// Parents and grandparents of the mating pool while a generation is
+	// being paired with compatibility checks
+	kinGroups *kinGroups
+	// Every mating, in the order the children were made, if
+	// Parameters.LogMatings is set
+	matingLog []MatingEvent
+	// Where reports and report errors are written, os.Stdout and os.Stderr
+	// unless SetOutput changes them
+	out    io.Writer
+	errOut io.Writer
+	// Called, if it is set, at the end of each generation with the number of
+	// the generation and the number of agents so far, so that callers can
+	// show progress
+	ProgressFunc func(generation, numAgents int)
 }
 
-// Creates a new simulation
-func NewSimulation(parameters *Parameters) *Simulation {
+// Creates a simulation without agents
+func newSimulation(parameters *Parameters) *Simulation {
 	var simulation Simulation
+	simulation.out, simulation.errOut = os.Stdout, os.Stderr
 	simulation.params = *parameters
 	simulation.id = parameters.SimulationId
+	simulation.seed = parameters.Seed
+	if simulation.seed == 0 {
+		simulation.seed = rand.Int63()
+	}
+	return &simulation
+}
+
+// Returns the seed the founders are made with
+func (s *Simulation) founderSeed() int64 {
+	if s.params.FounderSeed != 0 {
+		return s.params.FounderSeed
+	}
+	return s.seed
+}
+
+// Makes the agents, which must all be founders, generation 0 and the current
+// generation
+func (s *Simulation) startFounders() {
+	s.genBdrys = append(s.genBdrys, len(s.agents))
+	for i := range len(s.agents) {
+		selectedAgent := selectedAgent{
+			id:    i,
+			mated: false,
+		}
+		s.currGen = append(s.currGen, selectedAgent)
+	}
+}
+
+// Creates a new simulation
+func NewSimulation(parameters *Parameters) *Simulation {
+	simulation := newSimulation(parameters)
+	founderSeed := simulation.founderSeed()
+	simulation.rng = substream(founderSeed, founderStream, parameters.StableRng)
 	// Create agents
 	for i := range parameters.NumAgents {
 		var sex Sex
-		if rand.Float64() < 0.5 {
-			sex = MALE
+		if parameters.NumMatingTypes > 2 {
+			sex = Sex(simulation.rng.Intn(parameters.NumMatingTypes))
 		} else {
-			sex = FEMALE
+			sex = randomSex(simulation.rng, parameters.SexRatio)
 		}
 		agent := Agent{
 			id:         i,
 			generation: 0,
 			sex:        sex,
+			founder:    true,
 			mother:     0,
 			father:     0,
 		}
+		if parameters.MatingRadius > 0.0 {
+			agent.x, agent.y = simulation.rng.Float64(), simulation.rng.Float64()
+		}
+		copies := []string{""}
+		if parameters.Diploid {
+			copies = []string{"a", "b"}
+		}
+		// The first founder of the family, which has already been made
+		family := parameters.founderFamily(agent.id)
 		for i := range parameters.NumGenes {
-			agent.genes = append(agent.genes, fmt.Sprintf("%d-%d", agent.id, i))
+			for j, c := range copies {
+				if parameters.FounderFamilies > 1 && family != agent.id && i < familyLoci(parameters.NumGenes) {
+					agent.genes = append(agent.genes, simulation.agents[family].genes[i*len(copies)+j])
+					continue
+				}
+				gene := fmt.Sprintf("%d-%d%s", agent.id, i, c)
+				if parameters.MutationModel == NUCLEOTIDE {
+					gene += ":" + randomSequence(simulation.rng, parameters.GeneLength)
+				}
+				agent.genes = append(agent.genes, gene)
+			}
+		}
+		if sex == MALE {
+			agent.yHaplotype = fmt.Sprintf("%d-Y", agent.id)
+		} else if sex == FEMALE {
+			agent.mtHaplotype = fmt.Sprintf("%d-mt", agent.id)
 		}
 		simulation.agents = append(simulation.agents, agent)
 	}
-	// Set current generation
-	simulation.genBdrys = append(simulation.genBdrys, len(simulation.agents))
-	for i := range len(simulation.agents) {
-		selectedAgent := selectedAgent{
-			id:    i,
-			mated: false,
+	if parameters.MutationModel == NUCLEOTIDE {
+		simulation.addHaplotypeSequences(substream(founderSeed, haplotypeStream, parameters.StableRng))
+	}
+	simulation.addFounderPhenotypes(substream(founderSeed, phenotypeStream, parameters.StableRng))
+	simulation.startFounders()
+	return simulation
+}
+
+// Returns a founder with the given id, sex, genes and position, for
+// NewSimulationFromAgents. Its Y or mitochondrial haplotype is labelled with
+// its id, as NewSimulation's founders' are. Genes named <founder>-<locus>, as
+// NewSimulation names them, can be traced back to their founders by the gene
+// analyses.
+func NewFounder(id int, sex Sex, genes []string, x, y float64) Agent {
+	agent := Agent{id: id, sex: sex, founder: true, genes: slices.Clone(genes), x: x, y: y}
+	if sex == MALE {
+		agent.yHaplotype = fmt.Sprintf("%d-Y", id)
+	} else if sex == FEMALE {
+		agent.mtHaplotype = fmt.Sprintf("%d-mt", id)
+	}
+	return agent
+}
+
+// Creates a simulation whose generation 0 is the given founders, such as a
+// real population made with NewFounder, instead of random ones. The founders
+// must be in generation 0, have the ids 0, 1, 2 and so on in order, and all
+// have the same number of genes, two per locus if they are diploid. The
+// number of agents and genes in the parameters are replaced by the founders'.
+// Their phenotypes, and for the nucleotide model their haplotype sequences,
+// are drawn as NewSimulation draws them.
+func NewSimulationFromAgents(parameters *Parameters, founders []Agent) (*Simulation, error) {
+	for i := range founders {
+		agent := &founders[i]
+		switch {
+		case agent.generation != 0:
+			return nil, fmt.Errorf("%d, founders-err, agent %d is in generation %d, not 0",
+				parameters.SimulationId, i, agent.generation)
+		case agent.id != i:
+			return nil, fmt.Errorf("%d, founders-err, agent %d has id %d", parameters.SimulationId, i, agent.id)
+		case len(agent.genes) != len(founders[0].genes):
+			return nil, fmt.Errorf("%d, founders-err, agent %d has %d genes but agent 0 has %d",
+				parameters.SimulationId, i, len(agent.genes), len(founders[0].genes))
 		}
-		simulation.currGen = append(simulation.currGen, selectedAgent)
 	}
-	return &simulation
+	p := *parameters
+	p.NumAgents = len(founders)
+	p.NumGenes = 0
+	if len(founders) > 0 {
+		p.NumGenes = len(founders[0].genes)
+		if p.Diploid {
+			if p.NumGenes%2 != 0 {
+				return nil, fmt.Errorf("%d, founders-err, diploid founders have an odd number of genes, %d",
+					parameters.SimulationId, p.NumGenes)
+			}
+			p.NumGenes /= 2
+		}
+	}
+	simulation := newSimulation(&p)
+	for _, founder := range founders {
+		simulation.agents = append(simulation.agents, Agent{id: founder.id, sex: founder.sex, founder: true,
+			genes: slices.Clone(founder.genes), x: founder.x, y: founder.y,
+			yHaplotype: founder.yHaplotype, mtHaplotype: founder.mtHaplotype})
+	}
+	founderSeed := simulation.founderSeed()
+	if p.MutationModel == NUCLEOTIDE {
+		simulation.addHaplotypeSequences(substream(founderSeed, haplotypeStream, p.StableRng))
+	}
+	simulation.addFounderPhenotypes(substream(founderSeed, phenotypeStream, p.StableRng))
+	simulation.startFounders()
+	return simulation, nil
 }
 
 // Checks if two agents are compatible for mating
@@ -269,9 +1081,11 @@ func (s *Simulation) compatible(a, b *Agent) bool {
 		return false
 	case s.params.MateSameSex == false && a.sex == b.sex:
 		return false
-	case s.params.MateSibling == false && isSibling(a, b):
+	case s.params.MateSibling == false && s.siblings(a, b):
 		return false
-	case s.params.MateCousin && isCousin(s.agents, a, b):
+	case s.params.MateCousin && s.cousins(a, b):
+		return false
+	case !s.withinRadius(a.id, b.id):
 		return false
 	default:
 		return true
@@ -280,73 +1094,358 @@ func (s *Simulation) compatible(a, b *Agent) bool {
 
 // Fills the current_generation vector with the IDs of the given generation
 func (s *Simulation) setCurrGen(gen int) {
+	s.currGen = s.currGen[:0]
+	for _, agent := range s.Generation(gen) {
+		s.currGen = append(s.currGen, selectedAgent{agent.id, false})
+	}
+}
+
+// Returns whether agents of earlier generations can mate with the newest one
+func (p *Parameters) overlapping() bool {
+	return p.Overlap || p.FertilityMax > 0
+}
+
+// Fills the current generation with the agents that can mate when the next
+// generation is made after the given one, which may be from any generation up
+// to it: those alive whose age is at least Parameters.FertilityMin and, if
+// FertilityMax is set, at most it. Founders in generation 0 are FertilityMin
+// generations old in it.
+func (s *Simulation) setMatingPool(gen int) {
 	s.currGen = s.currGen[:0]
 	if gen >= len(s.genBdrys) {
 		return
 	}
-	var start int
-	if gen == 0 {
-		start = 0
-	} else {
-		start = s.genBdrys[gen-1]
+	oldest := 0
+	if s.params.FertilityMax > 0 {
+		oldest = max(gen-s.params.FertilityMax, 0)
 	}
-	for _, agent := range s.agents[start:s.genBdrys[gen]] {
-		s.currGen = append(s.currGen, selectedAgent{agent.id, false})
+	for _, agent := range s.agents[s.genStart(oldest):s.genBdrys[gen]] {
+		age := agent.age(gen)
+		if agent.generation == 0 {
+			age += s.params.FertilityMin
+		}
+		if !agent.dead && age >= s.params.FertilityMin &&
+			(s.params.FertilityMax == 0 || age <= s.params.FertilityMax) {
+			s.currGen = append(s.currGen, selectedAgent{agent.id, false})
+		}
 	}
 }
 
-// Sets the ancestors for every agent in the given generation
-func (s *Simulation) setAncestorsGen(gen int) {
-	for i := s.genBdrys[gen-1]; i < s.genBdrys[gen]; i++ {
-		setAncestors(s.agents, i)
+// Returns the agents of the given generation, or nil if there is no such
+// generation. The slice is a view of the simulation's agents, not a copy, so
+// it must not be modified and is only valid until more agents are added.
+func (s *Simulation) Generation(gen int) []Agent {
+	if gen < 0 || gen >= len(s.genBdrys) {
+		return nil
 	}
+	return s.agents[s.genStart(gen):s.genBdrys[gen]]
 }
 
-// Helper function for pairAgents that makes a single pair
-func makePair(agentA *Agent, agentB *Agent) matingPair {
-	var pair matingPair
-	if agentA.sex == MALE {
-		pair.male = agentA.id
-		pair.female = agentB.id
-	} else {
-		pair.male = agentB.id
-		pair.female = agentA.id
+// Returns the index of the first agent in the given generation
+func (s *Simulation) genStart(gen int) int {
+	if gen == 0 {
+		return 0
 	}
-	return pair
+	return s.genBdrys[gen-1]
 }
 
-// Creates pairs of compatible agents that will be used to generate children
-func (s *Simulation) pairAgents() {
-	s.matingPairs = s.matingPairs[:0]
-	for i := range len(s.currGen) {
-		agentA := &s.agents[s.currGen[i].id]
-		if s.currGen[i].mated == true {
-			continue
+// Sets the ancestors for every agent in the given generation. With
+// IncrementalAncestors the ancestors of the generations before it that are
+// within the stored depth are set first, oldest first, so that each agent's
+// ancestors can be built from its parents'.
+func (s *Simulation) setAncestorsGen(gen int) {
+	depth := s.storedAncestorDepth()
+	if !s.params.IncrementalAncestors {
+		for _, agent := range s.Generation(gen) {
+			setAncestors(s.agents, agent.id, depth)
 		}
-		hi := min(len(s.currGen), i+s.params.MatingK)
-		for j := i + 1; j < hi; j++ {
-			if s.currGen[j].mated == true {
-				continue
-			}
-			agentB := &s.agents[s.currGen[j].id]
-			if s.compatible(agentA, agentB) == true {
-				pair := makePair(agentA, agentB)
-				s.matingPairs = append(s.matingPairs, pair)
-				s.currGen[i].mated = true
-				s.currGen[j].mated = true
-				break
+		return
+	}
+	first := 0
+	if depth > 0 {
+		first = max(gen-depth, 0)
+	}
+	for g := first; g < gen; g++ {
+		for _, agent := range s.Generation(g) {
+			if agent.ancestorSet == nil {
+				setAncestorsFromParents(s.agents, agent.id, depth)
 			}
 		}
 	}
+	for _, agent := range s.Generation(gen) {
+		setAncestorsFromParents(s.agents, agent.id, depth)
+	}
 }
 
-func newChild(agents []Agent, father, mother, numGenes, generation int, mutationRate float64) []Agent {
-	var sex Sex
-	if rand.Float64() < 0.5 {
-		sex = MALE
-	} else {
-		sex = FEMALE
+// Returns the number of generations of ancestors stored with each agent, 0
+// for all
+func (s *Simulation) storedAncestorDepth() int {
+	depth, cache := s.params.MaxAncestorDepth, s.params.AncestorCacheDepth
+	if cache > 0 && (depth == 0 || cache < depth) {
+		return cache
 	}
+	return depth
+}
+
+// Returns the sorted ids of the ancestors of an agent at most depth
+// generations before it, or all its ancestors if depth is 0, in both cases
+// limited by MaxAncestorDepth. Stored ancestors are used if they go back far
+// enough, otherwise the ancestors are recomputed without being stored.
+func (s *Simulation) Ancestors(id, depth int) []int {
+	if max_ := s.params.MaxAncestorDepth; max_ > 0 && (depth == 0 || depth > max_) {
+		depth = max_
+	}
+	agent := &s.agents[id]
+	stored := s.storedAncestorDepth()
+	if agent.ancestorSet == nil || (stored > 0 && (depth == 0 || depth > stored)) {
+		ancestors, _ := findAncestors(s.agents, id, depth)
+		return ancestors
+	}
+	ancestors := make([]int, 0, len(agent.ancestorVec))
+	for _, ancestor := range agent.ancestorVec {
+		if depth == 0 || agent.generation-s.agents[ancestor].generation <= depth {
+			ancestors = append(ancestors, ancestor)
+		}
+	}
+	return ancestors
+}
+
+// Returns the sorted ids of every descendant of an agent, found by a breadth
+// first search of the children. Each agent is visited once, so a malformed
+// pedigree with a cycle doesn't loop forever, and children out of range are
+// skipped.
+func (s *Simulation) Descendants(id int) []int {
+	visited := map[int]struct{}{id: {}}
+	queue := []int{id}
+	var descendants []int
+	for len(queue) > 0 {
+		agent := &s.agents[queue[0]]
+		queue = queue[1:]
+		for _, child := range agent.children {
+			if child < 0 || child >= len(s.agents) {
+				continue
+			}
+			if _, seen := visited[child]; seen {
+				continue
+			}
+			visited[child] = struct{}{}
+			descendants = append(descendants, child)
+			queue = append(queue, child)
+		}
+	}
+	slices.Sort(descendants)
+	return descendants
+}
+
+// Returns the ids of one of the shortest lines of descent from an ancestor to
+// a descendant, found by a breadth first search of the parents, starting with
+// the descendant and ending with the ancestor. found is false if the ancestor
+// isn't an ancestor of the descendant. Mothers are searched before fathers, so
+// of paths of equal length the one through the mother is returned.
+func (s *Simulation) LineagePath(descendant, ancestor int) (path []int, found bool) {
+	if descendant < 0 || descendant >= len(s.agents) || ancestor < 0 || ancestor >= len(s.agents) {
+		return nil, false
+	}
+	// The child each agent was reached from, for retracing the path
+	child := map[int]int{descendant: descendant}
+	queue := []int{descendant}
+	for len(queue) > 0 {
+		agent := &s.agents[queue[0]]
+		queue = queue[1:]
+		if agent.id == ancestor {
+			found = true
+			break
+		}
+		if agent.isFounder() {
+			continue
+		}
+		for _, parent := range [...]int{agent.mother, agent.father} {
+			if parent < 0 || parent >= len(s.agents) {
+				continue
+			}
+			if _, seen := child[parent]; seen {
+				continue
+			}
+			child[parent] = agent.id
+			queue = append(queue, parent)
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	for id := ancestor; id != descendant; id = child[id] {
+		path = append(path, id)
+	}
+	path = append(path, descendant)
+	slices.Reverse(path)
+	return path, true
+}
+
+// Returns the most recent common ancestor of two agents, i.e. their common
+// ancestor with the highest id and so in the latest generation, and its
+// generation. found is false if they have no common ancestor within the
+// stored ancestor depth. The agents' ancestors are set if they haven't been.
+func (s *Simulation) MRCA(a, b int) (ancestorID int, generation int, found bool) {
+	for _, id := range [...]int{a, b} {
+		if s.agents[id].ancestorSet == nil {
+			setAncestors(s.agents, id, s.storedAncestorDepth())
+		}
+	}
+	ancestorID, found = mrca(&s.agents[a], &s.agents[b])
+	if !found {
+		return 0, 0, false
+	}
+	return ancestorID, s.agents[ancestorID].generation, true
+}
+
+// Helper function for pairAgents that makes a single pair. The agent of the
+// lower mating type takes the male role, and agentA does if they are both
+// male.
+func makePair(agentA *Agent, agentB *Agent) matingPair {
+	var pair matingPair
+	if agentA.sex == MALE || (agentB.sex != MALE && agentA.sex < agentB.sex) {
+		pair.male = agentA.id
+		pair.female = agentB.id
+	} else {
+		pair.male = agentB.id
+		pair.female = agentA.id
+	}
+	return pair
+}
+
+// Pairs each agent in the current generation that isn't yet mated with the
+// first compatible unmated agent among the next window agents
+func (s *Simulation) pairUnmated(window int) {
+	for i := range len(s.currGen) {
+		agentA := &s.agents[s.currGen[i].id]
+		if s.currGen[i].mated == true {
+			continue
+		}
+		hi := min(len(s.currGen), i+window)
+		for j := i + 1; j < hi; j++ {
+			if s.currGen[j].mated == true {
+				continue
+			}
+			agentB := &s.agents[s.currGen[j].id]
+			if s.compatible(agentA, agentB) == true {
+				pair := makePair(agentA, agentB)
+				s.matingPairs = append(s.matingPairs, pair)
+				s.currGen[i].mated = true
+				s.currGen[j].mated = true
+				break
+			}
+		}
+	}
+}
+
+// Creates pairs of compatible agents that will be used to generate children,
+// and returns the number of agents left without a partner
+func (s *Simulation) pairAgents() int {
+	s.matingPairs = s.matingPairs[:0]
+	s.pairUnmated(s.params.MatingK)
+	if s.params.Leftover == RETRY_ANY {
+		s.pairUnmated(len(s.currGen))
+	}
+	return len(s.currGen) - 2*len(s.matingPairs)
+}
+
+// Returns the number of agents monogamous mating left without a partner in
+// each generation, starting with generation 1
+func (s *Simulation) UnmatchedCounts() []int {
+	return s.unmatched
+}
+
+const nucleotides = "ACGT"
+
+// Creates a random nucleotide sequence
+func randomSequence(rng Rng, length int) string {
+	seq := make([]byte, length)
+	for i := range seq {
+		seq[i] = nucleotides[rng.Intn(len(nucleotides))]
+	}
+	return string(seq)
+}
+
+// Returns the nucleotide that a substitution changes n to. Transitions swap
+// the purines A and G or the pyrimidines C and T. Transversions swap a purine
+// for either pyrimidine, or vice versa.
+func substitute(rng Rng, n byte, tstv float64) byte {
+	if rng.Float64() < tstv/(tstv+1.0) {
+		switch n {
+		case 'A':
+			return 'G'
+		case 'G':
+			return 'A'
+		case 'C':
+			return 'T'
+		default:
+			return 'C'
+		}
+	}
+	var choices string
+	if n == 'A' || n == 'G' {
+		choices = "CT"
+	} else {
+		choices = "AG"
+	}
+	return choices[rng.Intn(2)]
+}
+
+// Returns a mutated copy of an allele according to the mutation model
+func (s *Simulation) mutate(allele string) string {
+	switch s.params.MutationModel {
+	case INFINITE:
+		s.numMutations++
+		if i := strings.IndexByte(allele, '#'); i >= 0 {
+			allele = allele[:i]
+		}
+		return fmt.Sprintf("%s#%d", allele, s.numMutations)
+	case NUCLEOTIDE:
+		i := strings.IndexByte(allele, ':')
+		if i < 0 || i == len(allele)-1 {
+			return allele
+		}
+		seq := []byte(allele)
+		site := i + 1 + s.rng.Intn(len(seq)-i-1)
+		seq[site] = substitute(s.rng, seq[site], s.params.TsTvRatio)
+		return string(seq)
+	default:
+		return allele + "`"
+	}
+}
+
+// Returns a male with the given probability and otherwise a female
+func randomSex(rng Rng, maleProbability float64) Sex {
+	if rng.Float64() < maleProbability {
+		return MALE
+	}
+	return FEMALE
+}
+
+// Returns the function that determines the sex of children
+func (s *Simulation) sexDeterminer() func(father, mother *Agent, rng Rng) Sex {
+	if s.params.SexDeterminer != nil {
+		return s.params.SexDeterminer
+	}
+	if numTypes := s.params.NumMatingTypes; numTypes > 2 {
+		return func(father, mother *Agent, rng Rng) Sex {
+			return Sex(rng.Intn(numTypes))
+		}
+	}
+	maleProbability := s.params.SexRatio
+	return func(father, mother *Agent, rng Rng) Sex {
+		return randomSex(rng, maleProbability)
+	}
+}
+
+// Adds a child of the given parents to agents. A haploid child inherits each
+// gene from either parent, and a diploid child inherits one of its mother's
+// two alleles and one of its father's at each locus. Each inherited gene
+// mutates with the given probability.
+func newChild(rng Rng, agents []Agent, father, mother, numGenes int, diploid bool, generation int,
+	mutationRate float64, mutate func(string) string,
+	determineSex func(father, mother *Agent, rng Rng) Sex) []Agent {
+	sex := determineSex(&agents[father], &agents[mother], rng)
 	agent := Agent{
 		id:         len(agents),
 		generation: generation,
@@ -354,19 +1453,45 @@ func newChild(agents []Agent, father, mother, numGenes, generation int, mutation
 		father:     father,
 		mother:     mother,
 	}
-	for i := range numGenes {
-		if rand.Float64() < 0.5 {
-			agent.genes = append(agent.genes, agents[father].genes[i])
-		} else {
-			agent.genes = append(agent.genes, agents[mother].genes[i])
+	// Without compatibility checks the parent recorded as the father can be
+	// female, so the Y haplotype comes from whichever parent is male
+	switch {
+	case sex != MALE:
+	case agents[father].sex == MALE:
+		agent.yHaplotype = agents[father].yHaplotype
+	case agents[mother].sex == MALE:
+		agent.yHaplotype = agents[mother].yHaplotype
+	}
+	// Likewise the mitochondrial haplotype comes from whichever is female
+	switch {
+	case agents[mother].sex == FEMALE:
+		agent.mtHaplotype = agents[mother].mtHaplotype
+	case agents[father].sex == FEMALE:
+		agent.mtHaplotype = agents[father].mtHaplotype
+	}
+	inherit := func(gene string) {
+		if mutationRate > 0.0 && rng.Float64() < mutationRate {
+			gene = mutate(gene)
 		}
-		if mutationRate > 0.0 && rand.Float64() < mutationRate {
-			agent.genes[len(agent.genes)-1] += "`"
+		agent.genes = append(agent.genes, gene)
+	}
+	for i := range numGenes {
+		switch {
+		case diploid:
+			inherit(agents[mother].genes[2*i+rng.Intn(2)])
+			inherit(agents[father].genes[2*i+rng.Intn(2)])
+		case rng.Float64() < 0.5:
+			inherit(agents[father].genes[i])
+		default:
+			inherit(agents[mother].genes[i])
 		}
 	}
 	agents = append(agents, agent)
 	agents[father].children = append(agents[father].children, agent.id)
-	agents[mother].children = append(agents[mother].children, agent.id)
+	// A self-mated child must only be counted once
+	if mother != father {
+		agents[mother].children = append(agents[mother].children, agent.id)
+	}
 	return agents
 }
 
@@ -374,7 +1499,7 @@ func newChild(agents []Agent, father, mother, numGenes, generation int, mutation
 func (s *Simulation) calcNumChildrenForGeneration() int {
 	switch s.params.Strategy {
 	case RANDOM:
-		if rand.Float64() < 0.5 {
+		if s.rng.Float64() < 0.5 {
 			return int(math.Floor(s.params.GrowthRate * float64(len(s.currGen))))
 		}
 		return int(math.Ceil(s.params.GrowthRate * float64(len(s.currGen))))
@@ -382,26 +1507,63 @@ func (s *Simulation) calcNumChildrenForGeneration() int {
 		return int(math.Floor(s.params.GrowthRate * float64(len(s.currGen))))
 	case CEIL:
 		return int(math.Ceil(s.params.GrowthRate * float64(len(s.currGen))))
+	case POISSON:
+		return poisson(s.rng, s.params.GrowthRate*float64(len(s.currGen)))
 	default:
 		return int(math.Round(s.params.GrowthRate * float64(len(s.currGen))))
 	}
 }
 
+// Draws from a Poisson distribution with the given mean using Knuth's method.
+// Large means are split into parts whose draws are added, so that e^-mean
+// doesn't underflow.
+func poisson(rng Rng, mean float64) int {
+	n := 0
+	for mean > 0.0 {
+		part := min(mean, 500.0)
+		mean -= part
+		limit := math.Exp(-part)
+		for p := rng.Float64(); p > limit; p *= rng.Float64() {
+			n++
+		}
+	}
+	return n
+}
+
 // Makes children agents from the mating_pairs vector
+// Pairs are chosen uniformly unless agents differ in fitness, in which case
+// they are chosen in proportion to their fitness.
 func (s *Simulation) makeChildrenMonogamous(generation int) {
 	iterations := s.calcNumChildrenForGeneration()
+	var cumulative []float64
+	if s.hasFitness() {
+		weights := make([]float64, len(s.matingPairs))
+		for i, pair := range s.matingPairs {
+			weights[i] = s.pairFitness(pair)
+		}
+		cumulative = cumulativeWeights(weights)
+	}
 	for range iterations {
-		pair := s.matingPairs[rand.Intn(len(s.matingPairs))]
-		s.agents = newChild(s.agents, pair.male, pair.female, s.params.NumGenes, generation, s.params.MutationRate)
+		var pair matingPair
+		if cumulative != nil {
+			pair = s.matingPairs[weightedIndex(s.rng, cumulative)]
+		} else {
+			pair = s.matingPairs[s.rng.Intn(len(s.matingPairs))]
+		}
+		s.addChild(pair.male, pair.female, generation)
 	}
 }
 
 // Mating strategy in which any given agent mates with at most one other agent
 func (s *Simulation) monogamousMating(generation int) error {
-	s.pairAgents()
+	unmatched := s.pairAgents()
+	s.unmatched = append(s.unmatched, unmatched)
+	if s.params.Leftover == REPORT_ONLY {
+		fmt.Fprintf(s.out, "%d, unmatched-agents, generation, %d, count, %d\n", s.id, generation, unmatched)
+	}
 	if len(s.matingPairs) == 0 {
-		return fmt.Errorf("%d, Error: No mating pairs for generation %d",
-			s.id, generation)
+		return &SimError{SimID: s.id, Generation: generation, Kind: NoMatingPairs,
+			Agents: len(s.currGen)}
 	}
 	s.makeChildrenMonogamous(generation)
 	return nil
@@ -411,50 +1573,313 @@ func (s *Simulation) monogamousMating(generation int) error {
 // anyone but compatibility checking is done.
 func (s *Simulation) nonMonogamousMating(generation int) error {
 	iterations := s.calcNumChildrenForGeneration()
+	cumulative := s.currGenWeights()
+	// The kinship of the current generation doesn't change as children are
+	// added, so it is memoized for the whole generation
+	var kinships *kinshipTable
+	if s.params.AvoidInbreeding {
+		kinships = newKinshipTable(s.agents)
+	}
 	for range iterations {
-		i := s.currGen[rand.Intn(len(s.currGen))].id
+		i, ok := s.pickParent(cumulative)
+		if !ok {
+			continue
+		}
 		var j int
 		compat := false
-		k := 0
-		matingK := s.params.MatingK
-		for ; !compat && k < matingK; k++ {
-			j = s.currGen[rand.Intn(len(s.currGen))].id
-			compat = s.compatible(&s.agents[i], &s.agents[j])
+		if s.params.AssortativeMating {
+			j, compat = s.mostSimilarMate(i, cumulative)
+		} else if s.params.AvoidInbreeding {
+			j, compat = s.leastRelatedMate(i, cumulative, kinships)
+		} else {
+			k := 0
+			matingK := s.params.MatingK
+			for ; !compat && k < matingK; k++ {
+				j = s.randomCurrGen(cumulative)
+				compat = s.compatible(&s.agents[i], &s.agents[j]) && s.canHaveChild(j)
+			}
 		}
-		if k >= matingK {
+		if !compat {
 			continue
 		}
-		s.agents = newChild(s.agents, i, j, s.params.NumGenes, generation, s.params.MutationRate)
+		s.addChild(i, j, generation)
 	}
 	return nil
 }
 
+// Picks MatingK candidate mates for agent i and returns the compatible one
+// that shares the most genes with it, the first of them if there is a tie,
+// or false if none is compatible
+func (s *Simulation) mostSimilarMate(i int, cumulative []float64) (int, bool) {
+	genes := slices.Sorted(slices.Values(s.agents[i].genes))
+	best, bestShared := 0, -1
+	for range s.params.MatingK {
+		j := s.randomCurrGen(cumulative)
+		if !s.compatible(&s.agents[i], &s.agents[j]) || !s.canHaveChild(j) {
+			continue
+		}
+		shared := CountCommonElementsSortedArray(genes, slices.Sorted(slices.Values(s.agents[j].genes)))
+		if shared > bestShared {
+			best, bestShared = j, shared
+		}
+	}
+	return best, bestShared >= 0
+}
+
+// Picks MatingK candidate mates for agent i and returns the compatible one
+// with the lowest kinship with it, the first of them if there is a tie, or
+// false if none is compatible
+func (s *Simulation) leastRelatedMate(i int, cumulative []float64, kinships *kinshipTable) (int, bool) {
+	best, bestKinship := 0, math.Inf(1)
+	for range s.params.MatingK {
+		j := s.randomCurrGen(cumulative)
+		if !s.compatible(&s.agents[i], &s.agents[j]) || !s.canHaveChild(j) {
+			continue
+		}
+		if kinship := kinships.kinship(i, j); kinship < bestKinship {
+			best, bestKinship = j, kinship
+		}
+	}
+	return best, !math.IsInf(bestKinship, 1)
+}
+
+// Returns whether an agent is below Parameters.MaxOffspring
+func (s *Simulation) canHaveChild(id int) bool {
+	return s.params.MaxOffspring <= 0 || len(s.agents[id].children) < s.params.MaxOffspring
+}
+
+// Picks a random agent of the current generation that can have another
+// child, trying up to MatingK times, and returns false if none is found.
+// Agents are picked in proportion to the cumulative weights unless they are
+// nil.
+func (s *Simulation) pickParent(cumulative []float64) (int, bool) {
+	id := s.randomCurrGen(cumulative)
+	for k := 1; !s.canHaveChild(id) && k < s.params.MatingK; k++ {
+		id = s.randomCurrGen(cumulative)
+	}
+	return id, s.canHaveChild(id)
+}
+
 // Mating strategy in which no compatibility checks are done (fastest)
 func (s *Simulation) anyMating(generation int) error {
 	iterations := s.calcNumChildrenForGeneration()
+	cumulative := s.currGenWeights()
 	for range iterations {
-		i := s.currGen[rand.Intn(len(s.currGen))].id
-		j := s.currGen[rand.Intn(len(s.currGen))].id
-		s.agents = newChild(s.agents, i, j, s.params.NumGenes,
-			generation, s.params.MutationRate)
+		i, ok := s.pickParent(cumulative)
+		if !ok {
+			continue
+		}
+		j, ok := s.pickParent(cumulative)
+		for k := 1; ok && !s.withinRadius(i, j) && k < s.params.MatingK; k++ {
+			j, ok = s.pickParent(cumulative)
+		}
+		if !ok || !s.withinRadius(i, j) {
+			continue
+		}
+		s.addChild(i, j, generation)
 	}
 	return nil
 }
 
+// Adds a child of the given parents to the simulation, placed between them if
+// the simulation is spatial
+func (s *Simulation) addChild(father, mother, generation int) {
+	s.agents = newChild(s.rng, s.agents, father, mother, s.params.NumGenes, s.params.Diploid,
+		generation, s.params.MutationRate, s.mutate, s.sexDeterminer())
+	if s.params.MatingRadius > 0.0 {
+		s.place(&s.agents[len(s.agents)-1])
+	}
+	if s.params.HaplotypeMutationRate > 0.0 {
+		s.mutateHaplotypes(&s.agents[len(s.agents)-1])
+	}
+	s.inheritPhenotype(&s.agents[len(s.agents)-1])
+	if s.params.LogMatings {
+		s.matingLog = append(s.matingLog, MatingEvent{generation, father, mother, len(s.agents) - 1})
+	}
+}
+
+// Places an agent at the midpoint of its parents moved by up to
+// Parameters.Dispersal in each direction, kept within the unit square
+func (s *Simulation) place(a *Agent) {
+	father, mother := &s.agents[a.father], &s.agents[a.mother]
+	disperse := func(x float64) float64 {
+		x += s.params.Dispersal * (2.0*s.rng.Float64() - 1.0)
+		return min(max(x, 0.0), 1.0)
+	}
+	a.x = disperse(0.5 * (father.x + mother.x))
+	a.y = disperse(0.5 * (father.y + mother.y))
+}
+
+// Returns whether two agents are close enough to mate, which they always are
+// unless Parameters.MatingRadius is set
+func (s *Simulation) withinRadius(a, b int) bool {
+	if s.params.MatingRadius <= 0.0 {
+		return true
+	}
+	dx, dy := s.agents[a].x-s.agents[b].x, s.agents[a].y-s.agents[b].y
+	return dx*dx+dy*dy <= s.params.MatingRadius*s.params.MatingRadius
+}
+
+// Returns the number of children of each agent in the given generation, in
+// agent order. Under the any and non-monogamous strategies, without
+// compatibility constraints, every agent has the same expected count.
+func (s *Simulation) OffspringCounts(gen int) []int {
+	if gen < 0 || gen >= len(s.genBdrys) {
+		return nil
+	}
+	start := s.genStart(gen)
+	counts := make([]int, 0, s.genBdrys[gen]-start)
+	for _, agent := range s.agents[start:s.genBdrys[gen]] {
+		counts = append(counts, len(agent.children))
+	}
+	return counts
+}
+
+// Mean and variance of the number of children of a group of agents
+type ReproductiveSuccess struct {
+	Agents   int
+	Mean     float64
+	Variance float64
+}
+
+// Calculates the mean and population variance of the number of children of
+// the males and the females in the given generation
+func (s *Simulation) ReproductiveSuccessBySex(gen int) (male, female ReproductiveSuccess) {
+	if gen < 0 || gen >= len(s.genBdrys) {
+		return male, female
+	}
+	var sums, squares [2]float64
+	var counts [2]int
+	for _, agent := range s.Generation(gen) {
+		if agent.sex != MALE && agent.sex != FEMALE {
+			continue
+		}
+		n := float64(len(agent.children))
+		counts[agent.sex]++
+		sums[agent.sex] += n
+		squares[agent.sex] += n * n
+	}
+	var success [2]ReproductiveSuccess
+	for sex := range success {
+		if counts[sex] == 0 {
+			continue
+		}
+		mean := sums[sex] / float64(counts[sex])
+		success[sex] = ReproductiveSuccess{counts[sex], mean, squares[sex]/float64(counts[sex]) - mean*mean}
+	}
+	return success[MALE], success[FEMALE]
+}
+
+// Reports the reproductive success of males and females in the given generation
+func (s *Simulation) reportReproductiveSuccess(gen int) {
+	male, female := s.ReproductiveSuccessBySex(gen)
+	for _, r := range [...]struct {
+		sex     string
+		success ReproductiveSuccess
+	}{{"male", male}, {"female", female}} {
+		fmt.Fprintf(s.out, "%d, rpt-reproductive-success, generation, %d, sex, %s, agents, %d, mean, %.2f, variance, %.2f\n",
+			s.id, gen, r.sex, r.success.Agents, r.success.Mean, r.success.Variance)
+	}
+}
+
+// Sets where the simulation writes its reports and the errors found while
+// reporting, so that they can be captured instead of printed
+func (s *Simulation) SetOutput(out, errOut io.Writer) {
+	s.out, s.errOut = out, errOut
+}
+
+// Returns the simulation's id
+func (s *Simulation) Id() int {
+	return s.id
+}
+
+// Returns the matings that made each child, in the order they were made, if
+// Parameters.LogMatings is set, or nil otherwise. The log isn't carried over
+// when simulations are merged, and the ids in it aren't changed when
+// emigration re-identifies agents.
+func (s *Simulation) MatingLog() []MatingEvent {
+	return s.matingLog
+}
+
+// Returns the simulation's parameters, which for a loaded or resumed
+// simulation are those it was saved with, without the function parameters
+func (s *Simulation) Parameters() Parameters {
+	return s.params
+}
+
+// Returns the seed the simulation uses, chosen at random if Parameters.Seed
+// is 0, so that the run can be replayed by passing it as the seed
+func (s *Simulation) Seed() int64 {
+	return s.seed
+}
+
+// Returns the number of generations, including the founders' generation 0,
+// or 0 if there are no agents
+func (s *Simulation) NumGenerations() int {
+	if len(s.agents) == 0 {
+		return 0
+	}
+	return len(s.genBdrys)
+}
+
+// Returns the number of the last generation, or -1 if there are no agents
+func (s *Simulation) LastGeneration() int {
+	return s.NumGenerations() - 1
+}
+
+// Growth of the population from the previous generation to a generation
+type GrowthPoint struct {
+	Generation int
+	Size       int
+	// Size divided by the size of the previous generation
+	Factor float64
+	// Fewer agents were born than the growth rate gives with any rounding
+	Short bool
+}
+
+// Returns the realized growth of every generation after the founders
+func (s *Simulation) RealizedGrowth() []GrowthPoint {
+	sizes := s.PopulationTrajectory()
+	var growth []GrowthPoint
+	for gen := 1; gen < len(sizes); gen++ {
+		point := GrowthPoint{Generation: gen, Size: sizes[gen], Factor: math.NaN()}
+		if sizes[gen-1] > 0 {
+			point.Factor = float64(sizes[gen]) / float64(sizes[gen-1])
+		}
+		point.Short = sizes[gen] < int(math.Floor(s.params.GrowthRate*float64(sizes[gen-1])))
+		growth = append(growth, point)
+	}
+	return growth
+}
+
+// Reports the size, as PopulationSizes gives it, and the realized growth
+// factor of each generation, flagging those that fell short of the growth rate
+func (s *Simulation) reportRealizedGrowth() {
+	short := 0
+	for _, g := range s.RealizedGrowth() {
+		if g.Short {
+			short++
+		}
+		fmt.Fprintf(s.out, "%d, rpt-realized-growth, generation, %d, size, %d, factor, %.3f, rate, %.3f, short, %t\n",
+			s.id, g.Generation, g.Size, g.Factor, s.params.GrowthRate, g.Short)
+	}
+	fmt.Fprintf(s.out, "%d, rpt-realized-growth, short-generations, %d\n", s.id, short)
+}
+
 // Creates an array of integers in simulation.genBdrys where each integer is
 // one past the simulation.agents index of the last agent with the generation
 // matching the index of the array. This should generally only be needed for
-// testing purposes because the genBdrys array is maintained by the simulation
-// engine as it generates a new generation of agents.
+// testing purposes, or after importing agents, because the genBdrys array is
+// maintained by the simulation engine as it generates a new generation of
+// agents. The agents must be ordered by generation, but generation numbers
+// can be skipped, in which case the skipped generations are empty.
 func (s *Simulation) SetGenBdrys() {
 	s.genBdrys = s.genBdrys[:0]
 	if len(s.agents) == 0 {
 		return
 	}
-	gen := s.agents[0].generation
 	for i := range len(s.agents) {
-		if gen != s.agents[i].generation {
-			gen = s.agents[i].generation
+		for len(s.genBdrys) < s.agents[i].generation {
 			s.genBdrys = append(s.genBdrys, i)
 		}
 	}
@@ -472,36 +1897,214 @@ func (s *Simulation) setPairFunc() func(int) error {
 	}
 }
 
+// Returns the probability that an agent dies before reproducing
+func (s *Simulation) mortality(a *Agent) float64 {
+	if s.params.MortalityFunc != nil {
+		return s.params.MortalityFunc(a.generation)
+	}
+	return s.params.MortalityRate
+}
+
+// Kills agents in the current generation according to the mortality
+// parameters and removes them from it
+func (s *Simulation) applyMortality() {
+	if s.params.MortalityRate <= 0.0 && s.params.MortalityFunc == nil {
+		return
+	}
+	survivors := s.currGen[:0]
+	for _, selected := range s.currGen {
+		agent := &s.agents[selected.id]
+		if p := s.mortality(agent); p > 0.0 && s.rng.Float64() < p {
+			agent.dead = true
+			continue
+		}
+		survivors = append(survivors, selected)
+	}
+	s.currGen = survivors
+}
+
 // This is the simulation engine function
 func (s *Simulation) Simulate() error {
-	s.setCurrGen(0)
-	pairFunc := s.setPairFunc()
-	for i := 1; i <= s.params.Generations; i++ {
-		if len(s.currGen) < 2 {
-			return fmt.Errorf("%d, sim-eng-err, insufficient survivors for generation, %d, %d",
-				s.id, len(s.currGen), i)
-		}
-		rand.Shuffle(len(s.currGen), func(x, y int) {
-			s.currGen[x], s.currGen[y] = s.currGen[y], s.currGen[x]
-		})
-		if err := pairFunc(i); err != nil {
+	return s.SimulateContext(context.Background())
+}
+
+// Runs the simulation engine, checking before each generation whether ctx
+// has been cancelled, in which case the context's error is returned wrapped.
+func (s *Simulation) SimulateContext(ctx context.Context) error {
+	pairFunc, err := s.begin()
+	if err != nil {
+		return err
+	}
+	for i := len(s.genBdrys); i <= s.params.Generations; i++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%d, sim-eng-cancelled, generation, %d, %w", s.id, i, err)
+		}
+		if err := s.step(i, pairFunc); err != nil {
 			return err
 		}
-		s.genBdrys = append(s.genBdrys, len(s.agents))
-		s.setCurrGen(i)
+		if every := s.params.CheckpointEvery; every > 0 && i%every == 0 {
+			if err := s.writeCheckpoint(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Checks the parameters and readies the founders to reproduce, returning the
+// mating function to make each generation with
+func (s *Simulation) begin() (func(int) error, error) {
+	if err := s.params.Validate(); err != nil {
+		return nil, &SimError{SimID: s.id, Kind: InvalidParameters, Err: err}
+	}
+	// A resumed simulation carries on from its last generation
+	last := len(s.genBdrys) - 1
+	s.setCurrGen(last)
+	if last == 0 {
+		s.emitGenerationStats(0)
+	}
+	return s.setPairFunc(), nil
+}
+
+// Makes generation i from the current generation
+func (s *Simulation) step(i int, pairFunc func(int) error) error {
+	start := time.Now()
+	s.rng = s.substream(uint64(i))
+	if s.params.overlapping() {
+		s.setMatingPool(i - 1)
+	}
+	s.applyMortality()
+	if len(s.currGen) < 2 {
+		return &SimError{SimID: s.id, Generation: i, Kind: InsufficientSurvivors,
+			Agents: len(s.currGen)}
+	}
+	if err := s.checkSexBalance(i); err != nil {
+		return err
+	}
+	s.rng.Shuffle(len(s.currGen), func(x, y int) {
+		s.currGen[x], s.currGen[y] = s.currGen[y], s.currGen[x]
+	})
+	if s.params.Compatible {
+		s.kinGroups = newKinGroups(s.agents, s.currGen)
+	}
+	err := pairFunc(i)
+	s.kinGroups = nil
+	if err != nil {
+		return err
+	}
+	if limit := s.params.MaxPopulation; limit > 0 && len(s.agents) > limit {
+		agents := len(s.agents)
+		s.discardChildren(s.genBdrys[len(s.genBdrys)-1])
+		return &SimError{SimID: s.id, Generation: i, Kind: PopulationLimit, Agents: agents}
+	}
+	s.genBdrys = append(s.genBdrys, len(s.agents))
+	if s.params.KeepGenerations > 0 {
+		s.discardBefore(i - s.params.KeepGenerations + 1)
+	}
+	s.setCurrGen(i)
+	s.genTimes = append(s.genTimes, time.Since(start))
+	s.emitGenerationStats(i)
+	if s.ProgressFunc != nil {
+		s.ProgressFunc(i, len(s.agents))
 	}
 	return nil
 }
 
-// Reports statistics on number of ancestors agents in the last generation have
-func (s *Simulation) reportNumAncestors() {
-	generation := s.agents[len(s.agents)-1].generation
+// Removes the agents from start on, which are the children of a generation
+// that is being made, and the parents' and mating log's references to them,
+// so that the simulation is as it was before the generation was started
+func (s *Simulation) discardChildren(start int) {
+	for i := range s.agents[start:] {
+		child := &s.agents[start+i]
+		parents := []int{child.mother, child.father}
+		// A self-mated child is only counted once
+		if child.mother == child.father {
+			parents = parents[:1]
+		}
+		for _, parent := range parents {
+			children := s.agents[parent].children
+			if n := len(children); n > 0 && children[n-1] >= start {
+				s.agents[parent].children = children[:n-1]
+			}
+		}
+	}
+	s.agents = s.agents[:start]
+	for len(s.matingLog) > 0 && s.matingLog[len(s.matingLog)-1].Child >= start {
+		s.matingLog = s.matingLog[:len(s.matingLog)-1]
+	}
+}
+
+// Counts the number of distinct descent paths from an agent to each of its
+// ancestors. Because children always have higher ids than their parents,
+// walking the ancestors in descending id order visits every agent after all
+// of its descendants, so each count only has to be pushed to the parents once.
+// Only the stored ancestors are counted, so parents beyond MaxAncestorDepth or
+// AncestorCacheDepth get nothing pushed to them.
+// Counts grow exponentially with depth in collapsed pedigrees, so they
+// saturate at math.MaxInt.
+func (s *Simulation) AncestorPathCounts(agentID int) map[int]int {
+	agent := &s.agents[agentID]
+	if agent.ancestorSet == nil {
+		setAncestors(s.agents, agentID, s.storedAncestorDepth())
+	}
+	paths := make(map[int]int, len(agent.ancestorVec)+1)
+	paths[agentID] = 1
+	for i := len(agent.ancestorVec); i >= 0; i-- {
+		curr := agentID
+		if i < len(agent.ancestorVec) {
+			curr = agent.ancestorVec[i]
+		}
+		if s.agents[curr].isFounder() {
+			continue
+		}
+		count := paths[curr]
+		for _, parent := range [2]int{s.agents[curr].mother, s.agents[curr].father} {
+			if _, ok := agent.ancestorSet[parent]; ok {
+				paths[parent] = saturatingAdd(paths[parent], count)
+			}
+		}
+	}
+	delete(paths, agentID)
+	return paths
+}
+
+// Reports the mean and maximum number of descent paths to each ancestor of
+// the agents in the given generation, which measures pedigree redundancy
+func (s *Simulation) reportPathRedundancy(generation int) {
+	start := s.genBdrys[generation-1]
 	count := 0
+	total := 0.0
+	max_ := 0
+	for _, agent := range s.agents[start:s.genBdrys[generation]] {
+		paths := s.AncestorPathCounts(agent.id)
+		if len(paths) == 0 {
+			continue
+		}
+		sum := 0.0
+		for _, p := range paths {
+			sum += float64(p)
+			if p > max_ {
+				max_ = p
+			}
+		}
+		total += sum / float64(len(paths))
+		count++
+	}
+	avg := 0.0
+	if count > 0 {
+		avg = total / float64(count)
+	}
+	fmt.Fprintf(s.out, "%d, rpt-path-redundancy, paths-per-ancestor-last-gen, mean, %.1f, max, %d\n", s.id, avg, max_)
+}
+
+// Calculates the number of agents in the given generation and the minimum,
+// maximum and mean number of ancestors they have
+func (s *Simulation) numAncestors(generation int) (count, min_, max_ int, avg float64) {
 	total := 0
-	min_ := math.MaxInt
-	max_ := math.MinInt
+	min_ = math.MaxInt
+	max_ = math.MinInt
 	start := s.genBdrys[generation-1]
-	for _, agent := range s.agents[start:] {
+	for _, agent := range s.agents[start:s.genBdrys[generation]] {
 		numAncestors := len(agent.ancestorVec)
 		total += numAncestors
 		count++
@@ -512,152 +2115,654 @@ func (s *Simulation) reportNumAncestors() {
 			max_ = numAncestors
 		}
 	}
-	avg := math.Round(float64(total) / float64(count))
-	fmt.Printf("%d, rpt-num-ancestors, tot-agents, %d\n", s.id, len(s.agents))
-	fmt.Printf("%d, rpt-num-ancestors, num-agents-last-gen, %d\n", s.id, count)
-	fmt.Printf("%d, rpt-num-ancestors, generations, %d, max-ancestors, %.0f\n", s.id, generation, math.Pow(2, float64(generation+1))-2)
-	fmt.Printf("%d, rpt-num-ancestors, num-ancestors-last-gen, min, %d, max, %d, mean, %.1f\n", s.id, min_, max_, avg)
+	avg = math.Round(float64(total) / float64(count))
+	return count, min_, max_, avg
+}
+
+// Returns the number of generations back that the ancestors of the agents in
+// the given generation are stored for, and the number of ancestors they would
+// have in that many generations without pedigree collapse, 2^(depth+1) - 2
+func (s *Simulation) maxPossibleAncestors(generation int) (depth int, maxPossible float64) {
+	depth = generation
+	if stored := s.storedAncestorDepth(); stored > 0 && stored < depth {
+		depth = stored
+	}
+	return depth, math.Pow(2, float64(depth+1)) - 2
+}
+
+// Reports statistics on number of ancestors agents in the given generation have
+func (s *Simulation) reportNumAncestors(generation int) *NumAncestorsResult {
+	r := &NumAncestorsResult{TotalAgents: len(s.agents), Depth: generation}
+	r.Agents, r.Min, r.Max, r.Mean = s.numAncestors(generation)
+	fmt.Fprintf(s.out, "%d, rpt-num-ancestors, tot-agents, %d\n", s.id, r.TotalAgents)
+	fmt.Fprintf(s.out, "%d, rpt-num-ancestors, num-agents-last-gen, %d\n", s.id, r.Agents)
+	r.Depth, r.MaxPossible = s.maxPossibleAncestors(generation)
+	if r.Depth < generation {
+		fmt.Fprintf(s.out, "%d, rpt-num-ancestors, max-ancestor-depth, %d\n", s.id, r.Depth)
+	}
+	fmt.Fprintf(s.out, "%d, rpt-num-ancestors, generations, %d, max-ancestors, %.0f\n", s.id, generation, r.MaxPossible)
+	fmt.Fprintf(s.out, "%d, rpt-num-ancestors, num-ancestors-last-gen, min, %d, max, %d, mean, %.1f\n", s.id, r.Min, r.Max, r.Mean)
+	return r
 }
 
-// Reports statistics on the number of common ancestors that agents in the last generation have
-func (s *Simulation) reportCommonAncestors() {
-	generation := s.agents[len(s.agents)-1].generation
+// Summary of the common ancestors shared by every pair of agents in a
+// generation, including which pairs share the most and the fewest.
+type commonAncestorStats struct {
+	min, max, total int
+	minA, minB      int
+	maxA, maxB      int
+}
+
+// Compares every pair of agents in the given generation and finds the
+// extremes of the number of common ancestors they share
+func (s *Simulation) commonAncestors(generation int) commonAncestorStats {
 	start := s.genBdrys[generation-1]
-	total := 0
-	min_ := math.MaxInt
-	max_ := math.MinInt
-	for _, agent := range s.agents[start : len(s.agents)-1] {
-		for j := agent.id + 1; j < len(s.agents); j++ {
+	end := s.genBdrys[generation]
+	stats := commonAncestorStats{
+		min:  math.MaxInt,
+		max:  math.MinInt,
+		minA: -1, minB: -1,
+		maxA: -1, maxB: -1,
+	}
+	for _, agent := range s.agents[start : end-1] {
+		for j := agent.id + 1; j < end; j++ {
 			common := CountCommonElementsSortedArray(agent.ancestorVec, s.agents[j].ancestorVec)
-			if common < min_ {
-				min_ = common
+			if common < stats.min {
+				stats.min, stats.minA, stats.minB = common, agent.id, j
 			}
-			if common > max_ {
-				max_ = common
+			if common > stats.max {
+				stats.max, stats.maxA, stats.maxB = common, agent.id, j
 			}
-			total += common
+			stats.total += common
 		}
 	}
-	pop := len(s.agents) - start
-	avg := math.Round(float64(total) / (float64(pop) * float64(pop) / 2.0))
-	fmt.Printf("%d, rpt-common-ancestors-last-gen, min, %d max, %d mean %.1f\n", s.id, min_, max_, avg)
+	return stats
 }
 
-// Reports statistics on the number of generations back you have to search to
-// / find common ancestors of the agents in the last generation
-func (s *Simulation) reportGenDiff() {
-	lastGen := s.agents[len(s.agents)-1].generation
-	if lastGen == 0 {
-		fmt.Fprintf(os.Stderr, "s.id, rpt-generation-diff-err, only one generation\n")
-		return
+// Compares randomly sampled pairs of distinct agents in the given generation.
+// The extremes are those of the sample, and the total is estimated for every
+// pair from its mean, so that it can be used like that of commonAncestors.
+func (s *Simulation) sampledCommonAncestors(generation, samples int) commonAncestorStats {
+	start := s.genBdrys[generation-1]
+	n := s.genBdrys[generation] - start
+	stats := commonAncestorStats{
+		min:  math.MaxInt,
+		max:  math.MinInt,
+		minA: -1, minB: -1,
+		maxA: -1, maxB: -1,
 	}
-	count := 0
+	rng := s.substream(commonAncestorStream)
 	total := 0
-	min_ := math.MaxInt
-	max_ := 0
-	for i := len(s.agents) - 1; i >= 0; i-- {
+	for range samples {
+		a := start + rng.Intn(n)
+		b := start + rng.Intn(n-1)
+		if b >= a {
+			b++
+		}
+		common := CountCommonElementsSortedArray(s.agents[a].ancestorVec, s.agents[b].ancestorVec)
+		if common < stats.min {
+			stats.min, stats.minA, stats.minB = common, a, b
+		}
+		if common > stats.max {
+			stats.max, stats.maxA, stats.maxB = common, a, b
+		}
+		total += common
+	}
+	pairs := n * (n - 1) / 2
+	stats.total = int(math.Round(float64(total) * float64(pairs) / float64(samples)))
+	return stats
+}
+
+// Calculates the ancestors of the agents in the given generation unless this
+// has already been done
+func (s *Simulation) ensureAncestorsGen(gen int) {
+	for i := s.genStart(gen); i < s.genBdrys[gen]; i++ {
+		if s.agents[i].ancestorSet == nil {
+			s.setAncestorsGen(gen)
+			return
+		}
+	}
+}
+
+// Returns the pair of agents in the last generation that share the most
+// common ancestors, and the number they share. If there are fewer than two
+// agents in the last generation the ids are -1.
+func (s *Simulation) MostRelatedPair() (a, b int, shared int) {
+	generation := s.LastGeneration()
+	if generation <= 0 {
+		return -1, -1, 0
+	}
+	s.ensureAncestorsGen(generation)
+	stats := s.commonAncestors(generation)
+	if stats.maxA < 0 {
+		return -1, -1, 0
+	}
+	return stats.maxA, stats.maxB, stats.max
+}
+
+// Returns the pair of agents in the last generation that share the fewest
+// common ancestors, and the number they share. If there are fewer than two
+// agents in the last generation the ids are -1.
+func (s *Simulation) LeastRelatedPair() (a, b int, shared int) {
+	generation := s.LastGeneration()
+	if generation <= 0 {
+		return -1, -1, 0
+	}
+	s.ensureAncestorsGen(generation)
+	stats := s.commonAncestors(generation)
+	if stats.minA < 0 {
+		return -1, -1, 0
+	}
+	return stats.minA, stats.minB, stats.min
+}
+
+// Reports statistics on the number of common ancestors that agents in the given generation have
+func (s *Simulation) reportCommonAncestors(generation int) *CommonAncestorsResult {
+	start := s.genBdrys[generation-1]
+	pop := s.genBdrys[generation] - start
+	samples := s.params.CommonAncestorSamples
+	if pop < 2 || samples >= pop*(pop-1)/2 {
+		samples = 0
+	}
+	var stats commonAncestorStats
+	if samples > 0 {
+		stats = s.sampledCommonAncestors(generation, samples)
+	} else {
+		stats = s.commonAncestors(generation)
+	}
+	r := &CommonAncestorsResult{
+		Min:     stats.min,
+		Max:     stats.max,
+		Total:   stats.total,
+		Mean:    math.Round(float64(stats.total) / (float64(pop) * float64(pop) / 2.0)),
+		Samples: samples,
+	}
+	if stored := s.storedAncestorDepth(); stored > 0 {
+		fmt.Fprintf(s.out, "%d, rpt-common-ancestors-last-gen, max-ancestor-depth, %d\n", s.id, stored)
+	}
+	if samples > 0 {
+		fmt.Fprintf(s.out, "%d, rpt-common-ancestors-last-gen, sampled-pairs, %d\n", s.id, samples)
+	}
+	fmt.Fprintf(s.out, "%d, rpt-common-ancestors-last-gen, min, %d max, %d mean %.1f\n", s.id, r.Min, r.Max, r.Mean)
+	return r
+}
+
+// An ancestor that is the most recent common ancestor of many pairs of agents
+type MRCAHub struct {
+	Ancestor   int
+	Generation int
+	Pairs      int
+}
+
+// Tallies how often each ancestor is the most recent common ancestor of a
+// pair of agents in the given generation, where 0 means the last generation,
+// and returns the n most frequent, most frequent first. It returns nil
+// without tallying if n isn't positive.
+func (s *Simulation) MRCAHubs(generation, n int) []MRCAHub {
+	lastGen := s.LastGeneration()
+	if n <= 0 || lastGen <= 0 {
+		return nil
+	}
+	if generation == 0 {
+		generation = lastGen
+	}
+	s.ensureAncestorsGen(generation)
+	start := s.genBdrys[generation-1]
+	end := s.genBdrys[generation]
+	tally := make(map[int]int)
+	for i := start; i < end-1; i++ {
+		for j := i + 1; j < end; j++ {
+			if ancestor, found := mrca(&s.agents[j], &s.agents[i]); found {
+				tally[ancestor]++
+			}
+		}
+	}
+	hubs := make([]MRCAHub, 0, len(tally))
+	for ancestor, pairs := range tally {
+		hubs = append(hubs, MRCAHub{ancestor, s.agents[ancestor].generation, pairs})
+	}
+	slices.SortFunc(hubs, func(a, b MRCAHub) int {
+		if c := cmp.Compare(b.Pairs, a.Pairs); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Ancestor, b.Ancestor)
+	})
+	return hubs[:min(n, len(hubs))]
+}
+
+// Summary of the founding generation
+type foundersSummary struct {
+	count, males, females int
+	// Number of distinct alleles the founders carry
+	alleles int
+	// Mean kinship of pairs of founders, which is 0 unless imported founders
+	// are related
+	meanKinship float64
+}
+
+// Summarizes generation 0
+func (s *Simulation) founders() foundersSummary {
+	var summary foundersSummary
+	if len(s.genBdrys) == 0 {
+		return summary
+	}
+	alleles := make(map[string]struct{})
+	for _, agent := range s.agents[:s.genBdrys[0]] {
+		summary.count++
+		if agent.sex == MALE {
+			summary.males++
+		} else if agent.sex == FEMALE {
+			summary.females++
+		}
+		for _, gene := range agent.genes {
+			alleles[gene] = struct{}{}
+		}
+	}
+	summary.alleles = len(alleles)
+	if summary.count > 1 {
+		table := newKinshipTable(s.agents)
+		total := 0.0
+		for i := 0; i < summary.count-1; i++ {
+			for j := i + 1; j < summary.count; j++ {
+				total += table.kinship(i, j)
+			}
+		}
+		summary.meanKinship = total / float64(summary.count*(summary.count-1)/2)
+	}
+	return summary
+}
+
+// Reports the number, sexes, alleles and kinship of the founders
+func (s *Simulation) reportFounders() {
+	f := s.founders()
+	ratio := math.NaN()
+	if f.females > 0 {
+		ratio = float64(f.males) / float64(f.females)
+	}
+	fmt.Fprintf(s.out, "%d, rpt-founders, num-founders, %d, males, %d, females, %d, sex-ratio, %.2f\n",
+		s.id, f.count, f.males, f.females, ratio)
+	fmt.Fprintf(s.out, "%d, rpt-founders, num-alleles, %d, mean-kinship, %.6f\n", s.id, f.alleles, f.meanKinship)
+	contributions, err := s.FounderContributions()
+	if err != nil {
+		fmt.Fprintf(s.errOut, "%s\n", err)
+		return
+	}
+	for _, c := range contributions {
+		fmt.Fprintf(s.out, "%d, rpt-founder-contribution, founder, %d, descendants, %.4f, genes, %.4f\n",
+			s.id, c.Founder, c.Descendants, c.Genes)
+	}
+}
+
+// What a founder has left in the last generation
+type FounderContribution struct {
+	Founder int
+	// Fraction of the last generation descended from the founder
+	Descendants float64
+	// Fraction of the genes of the last generation that come from the founder
+	Genes float64
+}
+
+// Returns the contribution of each founder in generation 0 to the last
+// generation, largest genetic contribution first, then most descendants, then
+// lowest id
+func (s *Simulation) FounderContributions() ([]FounderContribution, error) {
+	if len(s.genBdrys) == 0 {
+		return nil, nil
+	}
+	last := s.LastGeneration()
+	start, end := s.genStart(last), s.genBdrys[last]
+	contributions := make([]FounderContribution, s.genBdrys[0])
+	for i := range contributions {
+		contributions[i].Founder = i
+	}
+	if end == start {
+		return contributions, nil
+	}
+	genes := 0
+	for _, agent := range s.agents[start:end] {
+		for _, gene := range agent.genes {
+			founder, err := geneOrigin(gene)
+			if err != nil {
+				return nil, fmt.Errorf("%d, founder-contribution-err, invalid gene %s", s.id, gene)
+			}
+			if founder < len(contributions) {
+				contributions[founder].Genes++
+			}
+			genes++
+		}
+	}
+	for i := range contributions {
+		c := &contributions[i]
+		if last == 0 {
+			c.Descendants = 1.0 / float64(end-start)
+		} else {
+			descendants := s.Descendants(c.Founder)
+			first, _ := slices.BinarySearch(descendants, start)
+			inLast := len(descendants) - first
+			c.Descendants = float64(inLast) / float64(end-start)
+		}
+		if genes > 0 {
+			c.Genes /= float64(genes)
+		}
+	}
+	slices.SortStableFunc(contributions, func(a, b FounderContribution) int {
+		return cmp.Or(cmp.Compare(b.Genes, a.Genes), cmp.Compare(b.Descendants, a.Descendants))
+	})
+	return contributions, nil
+}
+
+// Calls visit with the generation difference of each pair of agents in the
+// given generation and returns the number of pairs
+func (s *Simulation) generationDiffs(generation int, visit func(difference int)) int {
+	pairs := 0
+	for i := s.genBdrys[generation] - 1; i >= 0; i-- {
 		a := &s.agents[i]
-		if a.generation != lastGen {
+		if a.generation != generation {
 			break
 		}
-		count++
-		for j := a.id - 1; j > 0; j-- {
+		for j := a.id - 1; j >= 0; j-- {
 			b := &s.agents[j]
-			if b.generation != lastGen {
+			if b.generation != generation {
 				break
 			}
-			difference := generationDiff(s.agents, a, b)
-			if difference < min_ {
-				min_ = difference
+			visit(generationDiff(s.agents, a, b))
+			pairs++
+		}
+	}
+	return pairs
+}
+
+// Returns the number of pairs of agents in the given generation with each
+// generation difference, the number of generations back to their most recent
+// common ancestor. The agents' ancestors must have been set.
+func (s *Simulation) GenerationDiffHistogram(generation int) map[int]int {
+	histogram := make(map[int]int)
+	s.generationDiffs(generation, func(difference int) {
+		histogram[difference]++
+	})
+	return histogram
+}
+
+// Reports the number of pairs of agents in the given generation with each
+// generation difference, smallest difference first
+func (s *Simulation) reportGenDiffHistogram(generation int) {
+	if generation == 0 {
+		return
+	}
+	histogram := s.GenerationDiffHistogram(generation)
+	for _, difference := range slices.Sorted(maps.Keys(histogram)) {
+		fmt.Fprintf(s.out, "%d, rpt-generation-diff-histogram, difference, %d, pairs, %d\n",
+			s.id, difference, histogram[difference])
+	}
+}
+
+// Reports statistics on the number of generations back you have to search to
+// / find common ancestors of the agents in the given generation
+func (s *Simulation) reportGenDiff(generation int) *GenerationDiffResult {
+	if generation == 0 {
+		fmt.Fprintf(s.errOut, "%d, rpt-generation-diff-err, only one generation\n", s.id)
+		return nil
+	}
+	total := 0
+	min_ := math.MaxInt
+	max_ := 0
+	pairs := s.generationDiffs(generation, func(difference int) {
+		if difference < min_ {
+			min_ = difference
+		}
+		if difference > max_ {
+			max_ = difference
+		}
+		total += difference
+	})
+	r := &GenerationDiffResult{
+		Min:   min_,
+		Max:   max_,
+		Total: total,
+		Mean:  math.Round(float64(total) / float64(max(pairs, 1))),
+	}
+	fmt.Fprintf(s.out, "%d, rpt-generation-diff, generation-diff-last-gen, min, %d, max, %d, mean %.1f\n", s.id, r.Min, r.Max, r.Mean)
+	return r
+}
+
+// Returns the id of the founder a gene comes from
+func geneOrigin(gene string) (int, error) {
+	components := strings.Split(gene, "-")
+	return strconv.Atoi(components[0])
+}
+
+// What has become of a founder's genes
+type LineageFate string
+
+const (
+	FIXED       LineageFate = "Fixed"
+	LOST        LineageFate = "Lost"
+	POLYMORPHIC LineageFate = "Polymorphic"
+)
+
+// Classifies each founder in generation 0 by whether every agent in the last
+// generation carries at least one of its genes, none do, or only some do
+func (s *Simulation) FounderFates() (map[int]LineageFate, error) {
+	fates := make(map[int]LineageFate)
+	if len(s.genBdrys) == 0 {
+		return fates, nil
+	}
+	carriers := make(map[int]int)
+	last := len(s.genBdrys) - 1
+	lastGen := s.Generation(last)
+	for _, agent := range lastGen {
+		founders := make(map[int]struct{})
+		for _, gene := range agent.genes {
+			founder, err := geneOrigin(gene)
+			if err != nil {
+				return nil, fmt.Errorf("%d, founder-fates-err, invalid gene %s", s.id, gene)
 			}
-			if difference > max_ {
-				max_ = difference
+			founders[founder] = struct{}{}
+		}
+		for founder := range founders {
+			carriers[founder]++
+		}
+	}
+	for founder := range s.genBdrys[0] {
+		switch carriers[founder] {
+		case 0:
+			fates[founder] = LOST
+		case len(lastGen):
+			fates[founder] = FIXED
+		default:
+			fates[founder] = POLYMORPHIC
+		}
+	}
+	return fates, nil
+}
+
+// Returns the frequency in the last generation of the alleles at a locus,
+// counted from 0, that descend from the given founder's allele there, as a
+// gene drop through the pedigree would. Copies that have since mutated still
+// count, as they are identified by the founder they come from. The
+// frequencies of all the founders at a locus sum to 1. It is NaN if the last
+// generation is empty or the locus is out of range.
+func (s *Simulation) GeneDropFrequency(founderID, locus int) float64 {
+	copies := 1
+	if s.params.Diploid {
+		copies = 2
+	}
+	agents := s.Generation(s.LastGeneration())
+	if len(agents) == 0 || locus < 0 || (locus+1)*copies > len(agents[0].genes) {
+		return math.NaN()
+	}
+	carried, total := 0, 0
+	for _, agent := range agents {
+		for _, gene := range agent.genes[locus*copies : (locus+1)*copies] {
+			if founder, err := geneOrigin(gene); err == nil && founder == founderID {
+				carried++
 			}
-			total += difference
+			total++
 		}
 	}
-	avg := math.Round(float64(total) / (float64(count*count) / 2.0))
-	fmt.Printf("%d, rpt-generation-diff, generation-diff-last-gen, min, %d, max, %d, mean %.1f\n", s.id, min_, max_, avg)
+	return float64(carried) / float64(total)
+}
+
+// Reports the fate of each founder lineage and how many have each fate
+func (s *Simulation) reportFounderFates() error {
+	fates, err := s.FounderFates()
+	if err != nil {
+		return err
+	}
+	counts := make(map[LineageFate]int)
+	for founder := range s.genBdrys[0] {
+		counts[fates[founder]]++
+		fmt.Fprintf(s.out, "%d, rpt-founder-fates, founder, %d, fate, %s\n", s.id, founder, fates[founder])
+	}
+	fmt.Fprintf(s.out, "%d, rpt-founder-fates, fixed, %d, lost, %d, polymorphic, %d\n",
+		s.id, counts[FIXED], counts[LOST], counts[POLYMORPHIC])
+	return nil
 }
 
 // Reports statistics on gene distribution across a slice of agents
-func (s *Simulation) analyzeGenes(agents []Agent) error {
-	geneTable := make(map[string]int)
-	individualTable := make(map[int]int)
+func (s *Simulation) analyzeGenes(agents []Agent) (GeneResult, error) {
+	r := GeneResult{
+		Generation:    agents[0].generation,
+		GeneCounts:    make(map[string]int),
+		FounderCounts: make(map[int]int),
+	}
 	for _, agent := range agents {
 		for _, gene := range agent.genes {
-			geneTable[gene]++
-			components := strings.Split(gene, "-")
-			individual, err := strconv.Atoi(components[0])
+			r.GeneCounts[gene]++
+			individual, err := geneOrigin(gene)
 			if err != nil {
-				return fmt.Errorf("%d, rpt-genes-err, error converting gene components to int", s.id)
+				return r, fmt.Errorf("%d, rpt-genes-err, error converting gene components to int", s.id)
 			}
-			individualTable[individual]++
+			r.FounderCounts[individual]++
 		}
 	}
-	generation := agents[0].generation
-	fmt.Printf("%d, rpt-genes, num-genes, generation, %d, num, %d\n", s.id, generation, len(geneTable))
-	maxGene, maxGeneCnt := "", 0
-	for k, v := range geneTable {
-		if v > maxGeneCnt {
-			maxGene, maxGeneCnt = k, v
+	fmt.Fprintf(s.out, "%d, rpt-genes, num-genes, generation, %d, num, %d\n", s.id, r.Generation, len(r.GeneCounts))
+	for k, v := range r.GeneCounts {
+		if v > r.MostCommonGeneCount {
+			r.MostCommonGene, r.MostCommonGeneCount = k, v
 		}
 	}
-	fmt.Printf("%d, rpt-genes, most-common-gene, %s, count, %d\n", s.id, maxGene, maxGeneCnt)
-	maxIndividual, maxIndividualCnt := 0, 0
-	for k, v := range individualTable {
-		if v > maxIndividualCnt {
-			maxIndividual, maxIndividualCnt = k, v
+	fmt.Fprintf(s.out, "%d, rpt-genes, most-common-gene, %s, count, %d\n", s.id, r.MostCommonGene, r.MostCommonGeneCount)
+	for k, v := range r.FounderCounts {
+		if v > r.MostCommonFounderCount {
+			r.MostCommonFounder, r.MostCommonFounderCount = k, v
 		}
 	}
-	fmt.Printf("%d, rpt-genes, num-zero-agents, generation, %d, count, %d\n", s.id, generation, len(individualTable))
-	fmt.Printf("%d, rpt-genes, most-common-zero-agent, generation, %d, agent, %d, count, %d\n", s.id, generation, maxIndividual, maxIndividualCnt)
-	return nil
+	fmt.Fprintf(s.out, "%d, rpt-genes, num-zero-agents, generation, %d, count, %d\n", s.id, r.Generation, len(r.FounderCounts))
+	fmt.Fprintf(s.out, "%d, rpt-genes, most-common-zero-agent, generation, %d, agent, %d, count, %d\n", s.id, r.Generation, r.MostCommonFounder, r.MostCommonFounderCount)
+	return r, nil
 }
 
 // Creates table of the number of each gene in the entire population
 // Reports gene statistics for a simulation
-func (s *Simulation) reportGenes(lastGenOnly bool) error {
-	start := 0
-	for _, end := range s.genBdrys {
-		if lastGenOnly == false || end == len(s.agents) {
-			if err := s.analyzeGenes(s.agents[start:end]); err != nil {
-				return err
+func (s *Simulation) reportGenes(lastGenOnly bool) ([]GeneResult, error) {
+	var results []GeneResult
+	for gen, end := range s.genBdrys {
+		agents := s.Generation(gen)
+		if len(agents) > 0 && (lastGenOnly == false || end == len(s.agents)) {
+			r, err := s.analyzeGenes(agents)
+			if err != nil {
+				return results, err
 			}
+			results = append(results, r)
 		}
-		start = end
 	}
 
+	return results, nil
+}
+
+// Sets the analyses Analysis does, in the form of Parameters.Analysis, and
+// the generation the ancestry analyses are done on, 0 for the last one, so
+// that a loaded simulation can be analyzed differently. An empty analysis
+// string keeps the current analyses.
+func (s *Simulation) SetAnalysis(analysis string, generation int) error {
+	if analysis != "" {
+		if _, err := ParseAnalysis(analysis); err != nil {
+			return &SimError{SimID: s.id, Kind: InvalidAnalysis, Err: err}
+		}
+		s.params.Analysis = analysis
+	}
+	s.params.AnalysisGen = generation
 	return nil
 }
 
-// Reports statistics on the outcome of a simulation
-func (s *Simulation) Analysis() error {
-	fmt.Printf("%d, Parameters: %+v\n", s.id, s.params)
+// Reports statistics on the outcome of a simulation and returns the results
+// of the ancestry and gene analyses
+func (s *Simulation) Analysis() (AnalysisResult, error) {
+	var result AnalysisResult
+	fmt.Fprintf(s.out, "%d, Parameters: %+v\n", s.id, s.params)
+	if s.params.Seed == 0 {
+		fmt.Fprintf(s.out, "%d, seed, %d\n", s.id, s.seed)
+	}
+	analyses, err := ParseAnalysis(s.params.Analysis)
+	if err != nil {
+		return result, &SimError{SimID: s.id, Kind: InvalidAnalysis, Err: err}
+	}
 	if len(s.agents) == 0 {
-		return errors.New("No agents in simulation")
+		return result, &SimError{SimID: s.id, Kind: NoAgents}
 	}
-	generation := s.agents[len(s.agents)-1].generation
-	if generation == 0 {
-		return fmt.Errorf("%d, analysis-err, only zero generation exists", s.id)
+	lastGen := s.agents[len(s.agents)-1].generation
+	if lastGen == 0 {
+		return result, &SimError{SimID: s.id, Kind: NoGenerations}
 	}
-	s.setAncestorsGen(generation)
-	if strings.Contains(s.params.Analysis, "N") {
-		s.reportNumAncestors()
-
+	generation := lastGen
+	if s.params.AnalysisGen != 0 {
+		generation = s.params.AnalysisGen
+		if generation < 1 || generation > lastGen {
+			return result, &SimError{SimID: s.id, Generation: generation, Kind: InvalidAnalysis,
+				Err: fmt.Errorf("analysis generation %d not in range 1 to %d", generation, lastGen)}
+		}
 	}
-
-	if strings.Contains(s.params.Analysis, "C") {
-		s.reportCommonAncestors()
+	if err := s.checkAncestryKept(analyses); err != nil {
+		return result, err
 	}
-
-	if strings.Contains(s.params.Analysis, "D") {
-		s.reportGenDiff()
+	if s.genStart(generation) == s.genBdrys[generation] {
+		return result, &SimError{SimID: s.id, Generation: generation, Kind: InvalidAnalysis,
+			Err: fmt.Errorf("analysis generation %d has no agents", generation)}
 	}
-	if strings.Contains(s.params.Analysis, "G") {
-		if err := s.reportGenes(strings.Contains(s.params.Analysis, "g")); err != nil {
-			return err
+	result.Generation = generation
+	s.setAncestorsGen(generation)
+	// Runs the report of an analysis if it is selected and records its time
+	timed := func(letter rune, report func()) {
+		if !analyses.Has(letter) {
+			return
 		}
+		start := time.Now()
+		report()
+		s.analysisTimes = append(s.analysisTimes, AnalysisTime{string(letter), time.Since(start)})
 	}
-	return nil
+	timed('N', func() { result.NumAncestors = s.reportNumAncestors(generation) })
+	timed('C', func() {
+		result.CommonAncestors = s.reportCommonAncestors(generation)
+		if s.params.Coalescent {
+			s.reportCoalescentCommonAncestors(generation)
+		}
+	})
+	timed('D', func() {
+		result.GenerationDiff = s.reportGenDiff(generation)
+		s.reportGenDiffHistogram(generation)
+		if s.params.Coalescent {
+			s.reportCoalescentGenDiff(generation)
+		}
+	})
+	timed('R', func() { s.reportPathRedundancy(generation) })
+	timed('O', func() { s.reportPedigreeCollapse(generation) })
+	timed('K', s.reportKinshipDecay)
+	timed('I', func() { s.reportInbreeding(generation) })
+	timed('F', s.reportFounders)
+	timed('S', func() { s.reportReproductiveSuccess(generation - 1) })
+	timed('P', s.reportRealizedGrowth)
+	timed('Y', s.reportYHaplotypes)
+	timed('M', s.reportMtHaplotypes)
+	timed('H', s.reportGeneDiversity)
+	timed('E', s.reportEffectiveSizes)
+	timed('B', s.reportFamilySharing)
+	timed('T', s.reportPhenotypes)
+	timed('X', s.reportLineageExtinction)
+	timed('L', func() { err = s.reportFounderFates() })
+	if err != nil {
+		return result, err
+	}
+	timed('G', func() { result.Genes, err = s.reportGenes(analyses.Has('g')) })
+	return result, err
 }
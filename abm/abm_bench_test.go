@@ -0,0 +1,72 @@
+package abm
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func BenchmarkSimulate(b *testing.B) {
+	parameters := NewParameters()
+	parameters.NumAgents = 200
+	parameters.GrowthRate = 1.0
+	parameters.Generations = 16
+	parameters.Seed = 1
+	for b.Loop() {
+		simulation := NewSimulation(&parameters)
+		if err := simulation.Simulate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSetAncestorsGen(b *testing.B) {
+	simulation, _, _ := benchSimulation(b, 16)
+	for b.Loop() {
+		simulation.setAncestorsGen(16)
+	}
+}
+
+func BenchmarkReportCommonAncestors(b *testing.B) {
+	simulation, _, _ := benchSimulation(b, 16)
+	simulation.setAncestorsGen(16)
+	simulation.SetOutput(io.Discard, io.Discard)
+	for b.Loop() {
+		simulation.reportCommonAncestors(16)
+	}
+}
+
+func BenchmarkCompatible(b *testing.B) {
+	parameters := NewParameters()
+	parameters.NumAgents = 200
+	parameters.GrowthRate = 1.0
+	parameters.Generations = 8
+	parameters.Compatible = true
+	parameters.MateCousin = true
+	parameters.MatingK = 200
+	parameters.Seed = 1
+	simulation := NewSimulation(&parameters)
+	if err := simulation.Simulate(); err != nil {
+		b.Fatal(err)
+	}
+	pool := slices.Clone(simulation.currGen)
+	checkPool := func() {
+		for _, x := range pool {
+			for _, y := range pool {
+				simulation.compatible(&simulation.agents[x.id], &simulation.agents[y.id])
+			}
+		}
+	}
+	b.Run("naive", func(b *testing.B) {
+		simulation.kinGroups = nil
+		for b.Loop() {
+			checkPool()
+		}
+	})
+	b.Run("grouped", func(b *testing.B) {
+		simulation.kinGroups = newKinGroups(simulation.agents, pool)
+		for b.Loop() {
+			checkPool()
+		}
+	})
+}
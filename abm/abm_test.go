@@ -2,9 +2,14 @@ package abm
 
 import (
 	//"fmt"
+	"bytes"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"math"
 	"slices"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -39,6 +44,51 @@ func TestCountCommonElements(t *testing.T) {
 	}
 }
 
+func TestCountCommonElementsRepeated(t *testing.T) {
+	tests := []struct {
+		a, b             []int
+		common, distinct int
+	}{
+		{[]int{2, 2}, []int{1, 2}, 1, 1},
+		{[]int{2, 2}, []int{2, 2}, 2, 1},
+		{[]int{1, 2, 2, 2, 3}, []int{2, 2, 3, 3}, 3, 2},
+		{[]int{1, 1, 1}, []int{2, 2}, 0, 0},
+		{[]int{}, []int{2, 2}, 0, 0},
+		{[]int{0, 1, 1, 5, 5, 5}, []int{1, 5, 5, 7}, 3, 2},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.common, CountCommonElementsSortedArray(tt.a, tt.b),
+			"Multiset count of %v and %v", tt.a, tt.b)
+		assert.Equal(t, tt.distinct, CountDistinctCommonElementsSortedArray(tt.a, tt.b),
+			"Distinct count of %v and %v", tt.a, tt.b)
+		assert.Equal(t, CountCommonSet(tt.a, tt.b), CountDistinctCommonElementsSortedArray(tt.a, tt.b),
+			"Distinct count matches set count of %v and %v", tt.a, tt.b)
+	}
+}
+
+func TestCountCommonSetAndMultiset(t *testing.T) {
+	{
+		v1 := []int{2, 2, 3}
+		v2 := []int{2, 2, 2}
+		assert.Equal(t, 1, CountCommonSet(v1, v2), "Set counts 2 once")
+		assert.Equal(t, 2, CountCommonMultiset(v1, v2), "Multiset counts 2 twice")
+		assert.Equal(t, 2, CountCommonElementsSortedArray(v1, v2), "Sorted count is multiset")
+	}
+	{
+		v1 := []string{"0-1``", "3-1", "0-1``", "5-2"}
+		v2 := []string{"5-2", "0-1``", "0-1``", "0-1``", "5-2"}
+		assert.Equal(t, 2, CountCommonSet(v1, v2), "Distinct genes in common")
+		assert.Equal(t, 3, CountCommonMultiset(v1, v2), "Gene copies in common")
+		assert.Equal(t, 3, CountCommonMultiset(v2, v1), "Multiset count is symmetric")
+	}
+	{
+		v1 := []int{1, 2, 3}
+		v2 := []int{2, 3, 4}
+		assert.Equal(t, 2, CountCommonSet(v1, v2), "Without repeats set count")
+		assert.Equal(t, 2, CountCommonMultiset(v1, v2), "matches multiset count")
+	}
+}
+
 func TestSimpleSimOne(t *testing.T) {
 	const GENERATIONS = 0
 	parameters := Parameters{
@@ -147,6 +197,8 @@ func TestSimpleSimSix(t *testing.T) {
 	assert.Equal(t, 6, simulation.genBdrys[1], "Gen bdrys 0 is 6")
 	assert.Equal(t, 14, simulation.genBdrys[2], "Gen bdrys 0 is 14")
 	assert.Equal(t, 3, len(simulation.genBdrys), "Len gen bdrys 3")
+	assert.Equal(t, []int{2, 4, 8}, simulation.PopulationTrajectory(), "Population doubles")
+	assert.Equal(t, []int{2, 4, 8}, simulation.PopulationSizes(), "Sizes are the trajectory")
 	assert.Equal(t, 0, simulation.agents[1].generation, "Gen should be 0")
 	assert.Equal(t, 1, simulation.agents[2].generation, "Gen should be 1")
 	assert.Equal(t, 1, simulation.agents[5].generation, "Gen should be 1")
@@ -217,6 +269,7 @@ func TestSetAncestorsGeneral(t *testing.T) {
 		MatingK:      50,
 		Monogamous:   true,
 		Compatible:   false,
+		SexRatio:     0.5,
 	}
 	simulation := NewSimulation(&parameters)
 	simulation.Simulate()
@@ -231,8 +284,6 @@ func TestSetAncestorsGeneral(t *testing.T) {
 				"ancestor set has elements for last generation agent")
 			require.Equal(t, len(agent.ancestorVec) > 0, true,
 				"ancestor vector has elements for last generation agent")
-			require.Equal(t, len(agent.ancestorSet), len(agent.ancestorVec),
-				"set and vector have same number of elemnts")
 			counter++
 		} else {
 			require.Equal(t, len(agent.ancestorSet), 0, "ancestor set has 0 elements for not last generation agent")
@@ -240,6 +291,7 @@ func TestSetAncestorsGeneral(t *testing.T) {
 		}
 	}
 	assert.Equal(t, counter > 0, true, "some agents exist")
+	require.Nil(t, simulation.CheckInvariants(), "Set and vector agree")
 }
 
 func setupSim(t *testing.T) *Simulation {
@@ -366,14 +418,6 @@ func setupSim(t *testing.T) *Simulation {
 	return simulation
 }
 
-func setToVec(m map[int]struct{}) []int {
-	result := make([]int, 0)
-	for key := range m {
-		result = append(result, key)
-	}
-	return result
-}
-
 func TestSetAncestorsSpecific(t *testing.T) {
 	simulation := setupSim(t)
 	simulation.setAncestorsGen(simulation.agents[len(simulation.agents)-1].generation)
@@ -383,10 +427,6 @@ func TestSetAncestorsSpecific(t *testing.T) {
 			[]int{0, 1, 3, 4, 5, 7},
 			simulation.agents[9].ancestorVec,
 			"Expected entries in ancestor vec")
-
-		vecFromSet := setToVec(simulation.agents[9].ancestorSet)
-		slices.Sort(vecFromSet)
-		assert.Equal(t, simulation.agents[9].ancestorVec, vecFromSet, "Set and vec are equal")
 	}
 	{
 		agent := simulation.agents[len(simulation.agents)-1]
@@ -394,9 +434,1297 @@ func TestSetAncestorsSpecific(t *testing.T) {
 			[]int{0, 1, 3, 4, 6, 8},
 			agent.ancestorVec,
 			"Expected entries in ancestor vec")
+	}
+	assert.Nil(t, simulation.CheckInvariants(), "Set and vec are equal")
+}
+
+func TestAncestorPathCounts(t *testing.T) {
+	simulation := setupSim(t)
+	paths := simulation.AncestorPathCounts(9)
+	assert.Equal(t,
+		map[int]int{0: 4, 1: 4, 3: 2, 4: 2, 5: 1, 7: 1},
+		paths,
+		"Founders reachable through both grandparents and both parents")
+	assert.Equal(t, 0, len(simulation.AncestorPathCounts(0)), "Founders have no ancestors")
+
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 5
+	parameters.GrowthRate = 1.0
+	parameters.MaxAncestorDepth = 2
+	limited := NewSimulation(&parameters)
+	require.Nil(t, limited.Simulate(), "Simulation succeeds")
+	id := len(limited.agents) - 1
+	counted := make([]int, 0)
+	for ancestor := range limited.AncestorPathCounts(id) {
+		counted = append(counted, ancestor)
+	}
+	slices.Sort(counted)
+	assert.Equal(t, limited.Ancestors(id, 0), counted,
+		"Paths are only counted to ancestors within the depth limit")
+}
+
+func TestMostRelatedPair(t *testing.T) {
+	simulation := setupSim(t)
+	// Give agent 10 a different father so that only the children of 6 and 8
+	// share every ancestor, moving it from the old father's children to the
+	// new one's so that the pedigree stays consistent.
+	simulation.agents[10].father = 8
+	simulation.agents[7].children = []int{9}
+	simulation.agents[8].children = []int{10, 11, 12, 13}
+	for i := range simulation.agents {
+		simulation.agents[i].ancestorVec, simulation.agents[i].ancestorSet = nil, nil
+	}
+	require.Nil(t, simulation.ValidatePedigree(), "Pedigree is well formed after the change")
+	a, b, shared := simulation.MostRelatedPair()
+	assert.Equal(t, 11, a, "First agent of most related pair")
+	assert.Equal(t, 12, b, "Second agent of most related pair")
+	assert.Equal(t, 6, shared, "Most related pair shares all ancestors")
+	a, b, shared = simulation.LeastRelatedPair()
+	assert.Equal(t, 9, a, "First agent of least related pair")
+	assert.Equal(t, 11, b, "Second agent of least related pair")
+	assert.Equal(t, 4, shared, "Least related pair shares only grandparents")
+}
+
+// Sums the chi-square statistic of the offspring counts of every generation
+// that reproduced against a uniform expectation, and returns it with its
+// degrees of freedom.
+func offspringChiSquare(simulation *Simulation) (chi float64, df int) {
+	for gen := 0; gen < len(simulation.genBdrys)-1; gen++ {
+		counts := simulation.OffspringCounts(gen)
+		total := 0
+		for _, c := range counts {
+			total += c
+		}
+		expected := float64(total) / float64(len(counts))
+		for _, c := range counts {
+			diff := float64(c) - expected
+			chi += diff * diff / expected
+		}
+		df += len(counts) - 1
+	}
+	return chi, df
+}
+
+func TestUniformReproductiveOpportunity(t *testing.T) {
+	for _, compatible := range []bool{false, true} {
+		parameters := Parameters{
+			SimulationId: 7,
+			NumAgents:    200,
+			Generations:  20,
+			GrowthRate:   1.0,
+			Strategy:     CEIL,
+			Compatible:   compatible,
+			MateSelf:     true,
+			MateSameSex:  true,
+			MateSibling:  true,
+			MatingK:      1,
+		}
+		simulation := NewSimulation(&parameters)
+		require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+		assert.Equal(t, 200*21, len(simulation.agents), "No matings are lost")
+		chi, df := offspringChiSquare(simulation)
+		assert.InDelta(t, float64(df), chi, 5*math.Sqrt(2*float64(df)),
+			"Offspring counts consistent with uniform selection")
+	}
+}
+
+func TestNumAncestorsIntermediateGeneration(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.setAncestorsGen(2)
+	// Agents 5 to 8 all descend from 3 and 4, who descend from 0 and 1.
+	count, min_, max_, avg := simulation.numAncestors(2)
+	assert.Equal(t, 4, count, "Four agents in generation 2")
+	assert.Equal(t, 4, min_, "Minimum ancestors in generation 2")
+	assert.Equal(t, 4, max_, "Maximum ancestors in generation 2")
+	assert.Equal(t, 4.0, avg, "Mean ancestors in generation 2")
+}
+
+func TestGenerationDiffHistogram(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.setAncestorsGen(3)
+	histogram := simulation.GenerationDiffHistogram(3)
+	pairs := 0
+	for _, count := range histogram {
+		pairs += count
+	}
+	assert.Equal(t, 5*4/2, pairs, "Every pair of the five agents in generation 3 is counted once")
+	assert.Equal(t, map[int]int{1: 4, 2: 6}, histogram, "Siblings differ by one generation, cousins by two")
+}
+
+func TestGenerationDiffIncludesAgentZero(t *testing.T) {
+	// Discarding generations 0 and 1 makes agents 5 to 8 of generation 2
+	// founders with ids 0 to 3, so that no pair has a common ancestor
+	simulation := setupSim(t)
+	simulation.discardBefore(2)
+	require.Equal(t, 2, simulation.agents[0].generation, "Agent 0 is in generation 2")
+	simulation.setAncestorsGen(2)
+	assert.Equal(t, map[int]int{2: 6}, simulation.GenerationDiffHistogram(2), "Agent 0 is in three of the six pairs")
+	assert.Equal(t, &GenerationDiffResult{Min: 2, Max: 2, Total: 12, Mean: 2},
+		simulation.reportGenDiff(2), "Mean is over the six pairs")
+}
+
+func TestAnalysisResult(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.params.Analysis = "NCDGg"
+	for i := 9; i < 14; i++ {
+		simulation.agents[i].genes = []string{"0-0", "0-0", "1-1"}
+	}
+	result, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	assert.Equal(t, 3, result.Generation, "Last generation analyzed")
+	assert.Equal(t, &NumAncestorsResult{TotalAgents: 14, Agents: 5, Depth: 3, MaxPossible: 14,
+		Min: 6, Max: 6, Mean: 6}, result.NumAncestors, "Number of ancestors")
+	assert.Equal(t, &CommonAncestorsResult{Min: 4, Max: 6, Total: 48, Mean: 4},
+		result.CommonAncestors, "Common ancestors")
+	assert.Equal(t, &GenerationDiffResult{Min: 1, Max: 2, Total: 16, Mean: 2},
+		result.GenerationDiff, "Generation differences, a mean of 1.6 over 10 pairs")
+	require.Equal(t, 1, len(result.Genes), "Only the last generation's genes")
+	assert.Equal(t, GeneResult{
+		Generation:             3,
+		GeneCounts:             map[string]int{"0-0": 10, "1-1": 5},
+		FounderCounts:          map[int]int{0: 10, 1: 5},
+		MostCommonGene:         "0-0",
+		MostCommonGeneCount:    10,
+		MostCommonFounder:      0,
+		MostCommonFounderCount: 10,
+	}, result.Genes[0], "Gene tables")
+
+	simulation.params.Analysis = "N"
+	result, err = simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	assert.NotNil(t, result.NumAncestors, "Selected analysis has a result")
+	assert.Nil(t, result.CommonAncestors, "Unselected analysis has no result")
+	assert.Nil(t, result.Genes, "Unselected gene analysis has no result")
+}
+
+func TestSetOutput(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.params.Analysis = "N"
+	var out, errOut bytes.Buffer
+	simulation.SetOutput(&out, &errOut)
+	_, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	assert.Contains(t, out.String(), "0, rpt-num-ancestors, num-ancestors-last-gen, min, 6, max, 6, mean, 6.0\n",
+		"Number of ancestors is reported to the output")
+	assert.Equal(t, 0, errOut.Len(), "No errors are reported")
+}
+
+func TestParseAnalysis(t *testing.T) {
+	analyses, err := ParseAnalysis("NCDGg")
+	require.Nil(t, err, "Valid analysis string parses")
+	assert.True(t, analyses.Has('N'), "N is selected")
+	assert.True(t, analyses.Has('g'), "g is selected")
+	assert.False(t, analyses.Has('R'), "R is not selected")
+
+	_, err = ParseAnalysis("NCZ")
+	assert.NotNil(t, err, "Unknown letter is an error")
+
+	for _, o := range AnalysisOptions {
+		assert.Contains(t, AnalysisHelp(), string(o.Letter)+" - "+o.Description,
+			"Help text documents every analysis")
+	}
+}
+
+func TestTransitionTransversionRatio(t *testing.T) {
+	parameters := NewParameters()
+	parameters.MutationModel = NUCLEOTIDE
+	parameters.TsTvRatio = 3.0
+	parameters.Seed = 9
+	simulation := NewSimulation(&parameters)
+	transitions, transversions := 0, 0
+	for range 100000 {
+		before := simulation.agents[0].genes[0]
+		after := simulation.mutate(before)
+		for i := range before {
+			if before[i] == after[i] {
+				continue
+			}
+			pair := string([]byte{before[i], after[i]})
+			switch pair {
+			case "AG", "GA", "CT", "TC":
+				transitions++
+			default:
+				transversions++
+			}
+		}
+		simulation.agents[0].genes[0] = after
+	}
+	assert.Equal(t, 100000, transitions+transversions, "Each mutation changes one site")
+	assert.InDelta(t, 3.0, float64(transitions)/float64(transversions), 0.1,
+		"Transition to transversion ratio matches parameter")
+}
+
+func TestInfiniteAlleles(t *testing.T) {
+	parameters := NewParameters()
+	parameters.MutationModel = INFINITE
+	simulation := NewSimulation(&parameters)
+	seen := make(map[string]struct{})
+	allele := simulation.agents[0].genes[0]
+	for range 100 {
+		allele = simulation.mutate(allele)
+		_, found := seen[allele]
+		require.False(t, found, "Every mutation creates a new allele")
+		seen[allele] = struct{}{}
+	}
+	assert.Equal(t, "0-0#100", allele, "Allele keeps its origin and only the latest mutation")
+}
+
+func TestMRCAHubs(t *testing.T) {
+	simulation := setupSim(t)
+	hubs := simulation.MRCAHubs(0, 2)
+	// The six pairs of agents whose parents are different pairs of siblings
+	// are most recently related through grandparent 4.
+	assert.Equal(t, []MRCAHub{{4, 1, 6}, {8, 2, 3}}, hubs, "Grandparent 4 is the main hub")
+	assert.Equal(t, 3, len(simulation.MRCAHubs(0, 10)), "Only three ancestors are MRCAs")
+	assert.Nil(t, simulation.MRCAHubs(0, 0), "No hubs are asked for")
+	assert.Nil(t, simulation.MRCAHubs(0, -1), "A negative number of hubs gives none")
+}
+
+func TestMixedDepthFounders(t *testing.T) {
+	// Agent 3 is a founder who joins the pedigree in generation 1, agent 6 one
+	// who joins in generation 3, and no agents were recorded in generation 2.
+	agents := []Agent{
+		{id: 0, generation: 0, sex: MALE, founder: true, children: []int{2}},
+		{id: 1, generation: 0, sex: FEMALE, founder: true, children: []int{2}},
+		{id: 2, generation: 1, sex: MALE, mother: 1, father: 0, children: []int{4, 5}},
+		{id: 3, generation: 1, sex: FEMALE, founder: true, children: []int{4, 5}},
+		{id: 4, generation: 3, sex: MALE, mother: 3, father: 2},
+		{id: 5, generation: 3, sex: FEMALE, mother: 3, father: 2},
+		{id: 6, generation: 3, sex: FEMALE, founder: true},
+	}
+	parameters := NewParameters()
+	simulation := NewSimulation(&parameters)
+	simulation.agents = agents
+	simulation.SetGenBdrys()
+	assert.Equal(t, []int{2, 4, 4, 7}, simulation.genBdrys, "Skipped generation is empty")
+	simulation.setCurrGen(2)
+	assert.Equal(t, 0, len(simulation.currGen), "No agents in generation 2")
+	simulation.setCurrGen(3)
+	assert.Equal(t, 3, len(simulation.currGen), "Three agents in generation 3")
+
+	simulation.setAncestorsGen(3)
+	assert.Equal(t, []int{0, 1, 2, 3}, simulation.agents[4].ancestorVec,
+		"Ancestors stop at founders of every depth")
+	assert.Equal(t, 0, len(simulation.agents[6].ancestorVec), "Late founder has no ancestors")
+	assert.False(t, isSibling(&simulation.agents[2], &simulation.agents[3]),
+		"Founder is not a sibling of an agent with a parent id matching its unset ones")
+	count, min_, max_, _ := simulation.numAncestors(3)
+	assert.Equal(t, 3, count, "Three agents in generation 3")
+	assert.Equal(t, 0, min_, "Late founder has no ancestors")
+	assert.Equal(t, 4, max_, "Descendants of every founder")
+	assert.Equal(t, map[int]int{0: 1, 1: 1, 2: 1, 3: 1}, simulation.AncestorPathCounts(5),
+		"One path to each ancestor")
+}
+
+func TestMortalityFuncLifespan(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.GrowthRate = 1.0
+	parameters.Generations = 6
+	parameters.Seed = 4
+	parameters.MortalityFunc = func(age int) float64 {
+		if age < 3 {
+			return 0.0
+		}
+		return 1.0
+	}
+	simulation := NewSimulation(&parameters)
+	assert.NotNil(t, simulation.Simulate(), "No agents survive to reproduce at age 3")
+	assert.Equal(t, 3, simulation.agents[len(simulation.agents)-1].generation,
+		"Population ends at the lifespan cutoff")
+	assert.Equal(t, 80, len(simulation.agents), "Nobody dies before the cutoff")
+	for _, agent := range simulation.agents {
+		assert.Equal(t, agent.generation == 3, agent.dead, "Only agents at the cutoff die")
+	}
+}
+
+func TestMortalityRate(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 1000
+	parameters.GrowthRate = 1.0
+	parameters.Generations = 1
+	parameters.MortalityRate = 0.25
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	deaths := 0
+	for _, agent := range simulation.agents[:1000] {
+		if agent.dead {
+			deaths++
+			assert.Equal(t, 0, len(agent.children), "Dead agents have no children")
+		}
+	}
+	assert.InDelta(t, 250, deaths, 60, "About a quarter of agents die")
+}
+
+func TestMortalityRateExtremes(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 50
+	parameters.Generations = 5
+	parameters.Seed = 21
+	parameters.MortalityRate = 1.0
+	simulation := NewSimulation(&parameters)
+	err := simulation.Simulate()
+	require.NotNil(t, err, "Everyone dying stops the simulation")
+	assert.Contains(t, err.Error(), "insufficient survivors for generation, 0, 1", "Stops at the first generation")
+
+	parameters.MortalityRate = 0.0
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	withoutMortality := NewParameters()
+	withoutMortality.NumAgents = 50
+	withoutMortality.Generations = 5
+	withoutMortality.Seed = 21
+	unchanged := NewSimulation(&withoutMortality)
+	require.Nil(t, unchanged.Simulate(), "Simulation succeeds")
+	assert.Equal(t, unchanged.agents, simulation.agents, "No mortality leaves the simulation unchanged")
+	for _, agent := range simulation.agents {
+		assert.False(t, agent.dead, "No agent dies")
+	}
+}
+
+func TestSimError(t *testing.T) {
+	parameters := NewParameters()
+	parameters.SimulationId = 4
+	parameters.NumAgents = 50
+	parameters.Generations = 5
+	parameters.Seed = 21
+	parameters.MortalityRate = 1.0
+	simulation := NewSimulation(&parameters)
+	err := simulation.Simulate()
+	var simErr *SimError
+	require.True(t, errors.As(err, &simErr), "Simulation fails with a SimError")
+	assert.Equal(t, InsufficientSurvivors, simErr.Kind, "Everyone dying leaves insufficient survivors")
+	assert.Equal(t, 4, simErr.SimID, "Error has the simulation id")
+	assert.Equal(t, 1, simErr.Generation, "Error has the generation being made")
+	assert.Equal(t, 0, simErr.Agents, "No agents survive")
+
+	parameters = NewParameters()
+	parameters.SexRatio = 2.0
+	err = NewSimulation(&parameters).Simulate()
+	require.True(t, errors.As(err, &simErr), "Invalid parameters are a SimError")
+	assert.Equal(t, InvalidParameters, simErr.Kind, "Sex ratio is invalid")
+	assert.NotNil(t, errors.Unwrap(err), "Error wraps the validation error")
+
+	parameters = NewParameters()
+	_, err = NewSimulation(&parameters).Analysis()
+	require.True(t, errors.As(err, &simErr), "Analysis fails with a SimError")
+	assert.Equal(t, NoGenerations, simErr.Kind, "Founders alone can't be analyzed")
+}
+
+func TestProjectedAgents(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 10
+	parameters.Generations = 12
+	parameters.GrowthRate = 1.3
+	parameters.Strategy = CEIL
+	parameters.Analysis = ""
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.Equal(t, len(simulation.agents), parameters.ProjectedAgents(), "Projection of a ceil run is exact")
+
+	parameters.Strategy = FLOOR
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.LessOrEqual(t, len(simulation.agents), parameters.ProjectedAgents(), "Projection bounds a floor run")
+
+	parameters.NumAgents = 1000
+	parameters.Generations = 1000
+	parameters.GrowthRate = 2.0
+	assert.Equal(t, math.MaxInt, parameters.ProjectedAgents(), "Projection saturates")
+}
+
+func TestValidate(t *testing.T) {
+	parameters := NewParameters()
+	assert.Nil(t, parameters.Validate(), "Default parameters are valid")
+	for _, c := range []struct {
+		name   string
+		change func(p *Parameters)
+	}{
+		{"Negative genes", func(p *Parameters) { p.NumGenes = -1 }},
+		{"Negative generations", func(p *Parameters) { p.Generations = -3 }},
+		{"Zero growth rate", func(p *Parameters) { p.GrowthRate = 0.0 }},
+		{"No mates searched with monogamy", func(p *Parameters) { p.Monogamous, p.MatingK = true, 0 }},
+		{"Negative mating k", func(p *Parameters) { p.MatingK = -1 }},
+		{"Mutation rate above 1", func(p *Parameters) { p.MutationRate = 1.5 }},
+		{"Negative mortality", func(p *Parameters) { p.MortalityRate = -0.1 }},
+		{"Empty nucleotide genes", func(p *Parameters) { p.MutationModel, p.GeneLength = NUCLEOTIDE, 0 }},
+		{"Negative analysis generation", func(p *Parameters) { p.AnalysisGen = -1 }},
+	} {
+		parameters := NewParameters()
+		c.change(&parameters)
+		assert.NotNil(t, parameters.Validate(), c.name+" is invalid")
+		assert.NotNil(t, NewSimulation(&parameters).Simulate(), c.name+" isn't simulated")
+	}
+}
+
+func TestFounders(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 50
+	parameters.NumGenes = 4
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	f := simulation.founders()
+	males := 0
+	for _, agent := range simulation.agents[:50] {
+		if agent.sex == MALE {
+			males++
+		}
+	}
+	assert.Equal(t, 50, f.count, "Every agent in generation 0 is a founder")
+	assert.Equal(t, males, f.males, "Male founders")
+	assert.Equal(t, 50-males, f.females, "Female founders")
+	assert.Equal(t, 200, f.alleles, "Every founder gene is a distinct allele")
+	assert.Equal(t, 0.0, f.meanKinship, "Simulated founders are unrelated")
+}
+
+func TestFounderContributions(t *testing.T) {
+	simulation := setupSim(t)
+	contributions, err := simulation.FounderContributions()
+	require.Nil(t, err, "Contributions are computed")
+	require.Len(t, contributions, 2, "One contribution per founder")
+	for _, c := range contributions {
+		assert.Equal(t, 1.0, c.Descendants, "Founder %d is an ancestor of the whole last generation", c.Founder)
+	}
+	assert.Equal(t, 0, contributions[0].Founder, "Ties are sorted by id")
+
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 4
+	parameters.NumGenes = 8
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	contributions, err = simulation.FounderContributions()
+	require.Nil(t, err, "Contributions are computed")
+	require.Len(t, contributions, 20, "One contribution per founder")
+	total := 0.0
+	for i, c := range contributions {
+		total += c.Genes
+		assert.GreaterOrEqual(t, c.Descendants, 0.0, "Descendant fraction isn't negative")
+		assert.LessOrEqual(t, c.Descendants, 1.0, "Descendant fraction is at most one")
+		if i > 0 {
+			assert.LessOrEqual(t, c.Genes, contributions[i-1].Genes, "Sorted by genetic contribution")
+		}
+	}
+	assert.InDelta(t, 1.0, total, 1e-9, "Every gene comes from a founder")
+}
+
+func TestReproductiveSuccessBySex(t *testing.T) {
+	// Male 0 fathers four children with four females, male 1 only one
+	agents := []Agent{
+		{id: 0, sex: MALE, children: []int{6, 7, 8, 9}},
+		{id: 1, sex: MALE, children: []int{10}},
+		{id: 2, sex: FEMALE, children: []int{6, 10}},
+		{id: 3, sex: FEMALE, children: []int{7}},
+		{id: 4, sex: FEMALE, children: []int{8}},
+		{id: 5, sex: FEMALE, children: []int{9}},
+		{id: 6, generation: 1, mother: 2, father: 0},
+		{id: 7, generation: 1, mother: 3, father: 0},
+		{id: 8, generation: 1, mother: 4, father: 0},
+		{id: 9, generation: 1, mother: 5, father: 0},
+		{id: 10, generation: 1, mother: 2, father: 1},
+	}
+	parameters := NewParameters()
+	simulation := NewSimulation(&parameters)
+	simulation.agents = agents
+	simulation.SetGenBdrys()
+	require.Nil(t, ValidatePedigree(simulation.agents), "Pedigree is well formed")
+	male, female := simulation.ReproductiveSuccessBySex(0)
+	assert.Equal(t, ReproductiveSuccess{2, 2.5, 2.25}, male, "Male success")
+	assert.Equal(t, ReproductiveSuccess{4, 1.25, 0.1875}, female, "Female success")
+	assert.Greater(t, male.Variance, female.Variance, "Polygyny skews male success")
+}
+
+func TestGeneDropFrequency(t *testing.T) {
+	for _, diploid := range []bool{false, true} {
+		parameters := NewParameters()
+		parameters.NumAgents = 20
+		parameters.Generations = 6
+		parameters.NumGenes = 3
+		parameters.Diploid = diploid
+		simulation := NewSimulation(&parameters)
+		require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+		for locus := range 3 {
+			total := 0.0
+			for founder := range 20 {
+				f := simulation.GeneDropFrequency(founder, locus)
+				assert.GreaterOrEqual(t, f, 0.0, "Frequency isn't negative")
+				total += f
+			}
+			assert.InDelta(t, 1.0, total, 1e-9, "Founders' frequencies at locus %d sum to 1", locus)
+		}
+		assert.True(t, math.IsNaN(simulation.GeneDropFrequency(0, 3)), "Locus out of range")
+	}
+}
+
+func TestFounderFates(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 10
+	parameters.NumGenes = 3
+	parameters.GrowthRate = 1.0
+	parameters.Generations = 60
+	parameters.Seed = 5
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	fates, err := simulation.FounderFates()
+	require.Nil(t, err, "Genes have founder origins")
+	require.Equal(t, 10, len(fates), "Every founder has a fate")
+	counts := make(map[LineageFate]int)
+	for _, fate := range fates {
+		counts[fate]++
+	}
+	assert.Greater(t, counts[FIXED], 0, "Drift fixes some lineages")
+	assert.Greater(t, counts[LOST], 0, "Drift loses some lineages")
+	last := simulation.agents[simulation.genStart(60):]
+	for founder, fate := range fates {
+		prefix := strconv.Itoa(founder) + "-"
+		carriers := 0
+		for _, agent := range last {
+			if slices.ContainsFunc(agent.genes, func(g string) bool { return strings.HasPrefix(g, prefix) }) {
+				carriers++
+			}
+		}
+		switch fate {
+		case FIXED:
+			assert.Equal(t, len(last), carriers, "Fixed lineage is in every agent")
+		case LOST:
+			assert.Equal(t, 0, carriers, "Lost lineage is in no agent")
+		default:
+			assert.True(t, carriers > 0 && carriers < len(last), "Polymorphic lineage is in some agents")
+		}
+	}
+}
+
+func TestMaxAncestorDepth(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.params.MaxAncestorDepth = 1
+	simulation.setAncestorsGen(3)
+	assert.Equal(t, []int{5, 7}, simulation.agents[9].ancestorVec, "Only parents within one generation")
+	simulation.params.MaxAncestorDepth = 2
+	simulation.setAncestorsGen(3)
+	assert.Equal(t, []int{3, 4, 5, 7}, simulation.agents[9].ancestorVec,
+		"Founders are deeper than two generations")
+	count, _, max_, _ := simulation.numAncestors(3)
+	assert.Equal(t, 5, count, "Five agents in generation 3")
+	assert.Equal(t, 4, max_, "Capped ancestor count")
+}
+
+func TestIncrementalAncestors(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		depth int
+		set   func(*Parameters)
+	}{
+		{"all generations", 0, func(p *Parameters) {}},
+		{"limited depth", 3, func(p *Parameters) {}},
+		{"overlapping generations", 0, func(p *Parameters) { p.Overlap = true; p.MortalityRate = 0.5 }},
+		{"self mating", 2, func(p *Parameters) { p.MateSelf = true }},
+	} {
+		parameters := NewParameters()
+		parameters.NumAgents = 30
+		parameters.Generations = 10
+		parameters.GrowthRate = 1.1
+		parameters.Seed = 7
+		parameters.MaxAncestorDepth = c.depth
+		parameters.IncrementalAncestors = true
+		c.set(&parameters)
+		simulation := NewSimulation(&parameters)
+		require.Nil(t, simulation.Simulate(), c.name+" simulates")
+		last := simulation.LastGeneration()
+		simulation.setAncestorsGen(last)
+		for i := simulation.genStart(last); i < simulation.genBdrys[last]; i++ {
+			vec, set := findAncestors(simulation.agents, i, c.depth)
+			assert.Equal(t, vec, simulation.agents[i].ancestorVec, "%s: agent %d has the searched ancestors", c.name, i)
+			assert.Equal(t, set, simulation.agents[i].ancestorSet, "%s: agent %d has the searched set", c.name, i)
+		}
+	}
+	simulation := setupSim(t)
+	simulation.params.IncrementalAncestors = true
+	setAncestorsFromParents(simulation.agents, 9, 0)
+	assert.Equal(t, []int{0, 1, 3, 4, 5, 7}, simulation.agents[9].ancestorVec, "Falls back to searching without parents' ancestors")
+}
 
-		vecFromSet := setToVec(agent.ancestorSet)
-		slices.Sort(vecFromSet)
-		assert.Equal(t, agent.ancestorVec, vecFromSet, "Set and vec are equal")
+func TestAncestorCacheDepth(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.setAncestorsGen(3)
+	all := simulation.Ancestors(9, 0)
+	parents := simulation.Ancestors(9, 1)
+	simulation.params.AncestorCacheDepth = 1
+	simulation.setAncestorsGen(3)
+	assert.Equal(t, []int{5, 7}, simulation.agents[9].ancestorVec, "Only parents stored")
+	assert.Equal(t, parents, simulation.Ancestors(9, 1), "Recent ancestors from the cache")
+	assert.Equal(t, all, simulation.Ancestors(9, 0), "Deeper ancestors recomputed")
+	assert.Equal(t, []int{5, 7}, simulation.agents[9].ancestorVec, "Recomputed ancestors not stored")
+	simulation.params.MaxAncestorDepth = 2
+	assert.Equal(t, []int{3, 4, 5, 7}, simulation.Ancestors(9, 0), "Still limited by the maximum depth")
+}
+
+func TestGenerationAccessors(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 12,
+		NumAgents:    4,
+		Generations:  5,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+	}
+	simulation := NewSimulation(&parameters)
+	assert.Equal(t, 1, simulation.NumGenerations(), "Only founders before simulating")
+	assert.Equal(t, 0, simulation.LastGeneration(), "Founders are generation 0")
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.Equal(t, 6, simulation.NumGenerations(), "Founders and five more generations")
+	assert.Equal(t, 5, simulation.LastGeneration(), "Last generation is the fifth")
+
+	parameters.NumAgents = 0
+	parameters.Generations = 0
+	simulation = NewSimulation(&parameters)
+	assert.Equal(t, 0, simulation.NumGenerations(), "No generations without agents")
+	assert.Equal(t, -1, simulation.LastGeneration(), "No last generation without agents")
+}
+
+func TestDiploidInheritance(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 4
+	parameters.NumGenes = 5
+	parameters.Diploid = true
+	parameters.Seed = 23
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.Equal(t, [2]string{"0-0a", "0-0b"}, simulation.Loci(0)[0], "Founder has two labelled alleles")
+	copies := make(map[byte]bool)
+	for _, agent := range simulation.agents[simulation.genBdrys[0]:] {
+		loci := simulation.Loci(agent.id)
+		require.Equal(t, 5, len(loci), "Two alleles at every locus")
+		mother, father := simulation.Loci(agent.mother), simulation.Loci(agent.father)
+		for i, locus := range loci {
+			assert.Contains(t, mother[i], locus[0], "First allele from the mother")
+			assert.Contains(t, father[i], locus[1], "Second allele from the father")
+			copies[locus[0][len(locus[0])-1]] = true
+		}
+	}
+	assert.Equal(t, map[byte]bool{'a': true, 'b': true}, copies, "Either of a parent's alleles is inherited")
+
+	parameters.Generations = 1
+	parameters.MutationRate = 1.0
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	child := &simulation.agents[simulation.genBdrys[0]]
+	for i, locus := range simulation.Loci(child.id) {
+		assert.True(t, strings.HasSuffix(locus[0], "`") && strings.HasSuffix(locus[1], "`"),
+			"Both alleles mutate")
+		assert.Contains(t, simulation.Loci(child.mother)[i], strings.TrimSuffix(locus[0], "`"),
+			"Mother's allele mutated once")
+		assert.Contains(t, simulation.Loci(child.father)[i], strings.TrimSuffix(locus[1], "`"),
+			"Father's allele mutated once")
+	}
+
+	parameters.Diploid = false
+	simulation = NewSimulation(&parameters)
+	assert.Nil(t, simulation.Loci(0), "Haploid simulation has no loci")
+	assert.Equal(t, 5, len(simulation.agents[0].genes), "One allele per locus")
+}
+
+func TestMaxOffspring(t *testing.T) {
+	for _, compatible := range []bool{false, true} {
+		parameters := NewParameters()
+		parameters.NumAgents = 12
+		parameters.Generations = 2
+		parameters.GrowthRate = 0.5
+		parameters.Compatible = compatible
+		parameters.MateSameSex = true
+		parameters.MateSibling = true
+		parameters.MaxOffspring = 1
+		parameters.Seed = 17
+		simulation := NewSimulation(&parameters)
+		require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+		for _, agent := range simulation.agents {
+			assert.LessOrEqual(t, len(agent.children), 1, "No agent is a parent more than once")
+		}
+		assert.Greater(t, len(simulation.agents), 12, "Some children are born")
+	}
+}
+
+func TestSexRatio(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 3
+	parameters.SexRatio = 1.0
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, agent := range simulation.agents {
+		assert.Equal(t, MALE, agent.sex, "Every agent is male")
+	}
+
+	parameters.SexRatio = 0.0
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation without compatibility checks succeeds")
+	for _, agent := range simulation.agents {
+		assert.Equal(t, FEMALE, agent.sex, "Every agent is female")
+	}
+
+	parameters.SexRatio = 1.5
+	simulation = NewSimulation(&parameters)
+	err := simulation.Simulate()
+	require.NotNil(t, err, "Sex ratio out of range")
+	assert.Contains(t, err.Error(), "sex ratio 1.5 not in range 0 to 1", "Error explains the problem")
+	parameters.SexRatio = -0.1
+	assert.NotNil(t, parameters.Validate(), "Negative sex ratio is invalid")
+}
+
+func TestSexDeterminer(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 3
+	parameters.SexDeterminer = func(father, mother *Agent, rng Rng) Sex {
+		return FEMALE
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, agent := range simulation.agents[20:] {
+		require.Equal(t, FEMALE, agent.Sex(), "Every child is female")
+	}
+
+	// Sex inherited from the father
+	parameters.SexDeterminer = func(father, mother *Agent, rng Rng) Sex {
+		return father.Sex()
+	}
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, agent := range simulation.agents[20:] {
+		require.Equal(t, simulation.agents[agent.father].sex, agent.sex, "Child has its father's sex")
+	}
+}
+
+func TestRealizedGrowth(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 13,
+		NumAgents:    200,
+		Generations:  3,
+		GrowthRate:   1.5,
+		Strategy:     CEIL,
+		Compatible:   true,
+		MatingK:      1,
+		Seed:         13,
+		SexRatio:     0.5,
+	}
+	// With one try each to find a mate of the opposite sex about half of
+	// the matings fail
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	growth := simulation.RealizedGrowth()
+	require.Equal(t, 3, len(growth), "Growth of every generation after the founders")
+	for _, g := range growth {
+		assert.Less(t, g.Factor, 1.0, "Realized growth below growth rate")
+		assert.True(t, g.Short, "Generation is flagged as short")
+	}
+
+	parameters.Compatible = false
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, g := range simulation.RealizedGrowth() {
+		assert.InDelta(t, 1.5, g.Factor, 0.01, "Unconstrained growth matches growth rate")
+		assert.False(t, g.Short, "Generation is not short")
+	}
+}
+
+func TestLeftoverStrategy(t *testing.T) {
+	// Three males and two females, so at least one male is always left over
+	sexes := []Sex{MALE, MALE, MALE, FEMALE, FEMALE}
+	run := func(leftover LeftoverStrategy, seed int64) *Simulation {
+		parameters := Parameters{
+			SimulationId: 14,
+			NumAgents:    5,
+			Generations:  1,
+			GrowthRate:   1.0,
+			Strategy:     CEIL,
+			Monogamous:   true,
+			Compatible:   true,
+			MatingK:      2,
+			Seed:         seed,
+			Leftover:     leftover,
+		}
+		simulation := NewSimulation(&parameters)
+		for i, sex := range sexes {
+			simulation.agents[i].sex = sex
+		}
+		simulation.Simulate()
+		return simulation
+	}
+	dropped := 0
+	for seed := range int64(20) {
+		retry := run(RETRY_ANY, seed+1)
+		assert.Equal(t, []int{1}, retry.UnmatchedCounts(), "Second chance pairs every female")
+		drop := run(DROP, seed+1)
+		require.Equal(t, 1, len(drop.UnmatchedCounts()), "Unmatched agents are counted")
+		assert.Equal(t, 1, drop.UnmatchedCounts()[0]%2, "Odd pool leaves an odd number unmatched")
+		dropped += drop.UnmatchedCounts()[0]
+	}
+	assert.Greater(t, dropped, 20, "Only pairing neighbours leaves extra agents unmatched")
+
+	var strategy LeftoverStrategy
+	require.Nil(t, strategy.Set("retry-any"), "Valid strategy")
+	assert.Equal(t, RETRY_ANY, strategy, "Strategy is parsed")
+	assert.NotNil(t, strategy.Set("sometimes"), "Invalid strategy")
+}
+
+func TestGrowthStrategy(t *testing.T) {
+	counts := func(strategy GrowthStrategy, agents int) int {
+		parameters := NewParameters()
+		parameters.NumAgents = agents
+		parameters.GrowthRate = 1.5
+		parameters.Strategy = strategy
+		parameters.Seed = 1
+		return NewSimulation(&parameters).calcNumChildrenForGeneration()
+	}
+	assert.Equal(t, 5, counts(CEIL, 3), "Ceil rounds 4.5 up")
+	assert.Equal(t, 8, counts(CEIL, 5), "Ceil rounds 7.5 up")
+	assert.Equal(t, 6, counts(CEIL, 4), "Ceil keeps whole numbers")
+	assert.Equal(t, 5, counts(ROUND, 3), "Round rounds 4.5 away from zero")
+	assert.Equal(t, 3, counts(ROUND, 2), "Round keeps whole numbers")
+	assert.Equal(t, 4, counts(FLOOR, 3), "Floor rounds 4.5 down")
+
+	parameters := NewParameters()
+	parameters.NumAgents = 100
+	parameters.GrowthRate = 1.5
+	parameters.Strategy = POISSON
+	parameters.Seed = 2
+	simulation := NewSimulation(&parameters)
+	total := 0
+	for range 1000 {
+		total += simulation.calcNumChildrenForGeneration()
+	}
+	assert.InDelta(t, 150.0, float64(total)/1000.0, 1.0, "Poisson counts have the mean")
+	assert.InDelta(t, 2000.0, float64(poisson(simulation.rng, 2000.0)), 200.0,
+		"Large Poisson means don't underflow")
+
+	var strategy GrowthStrategy
+	require.Nil(t, strategy.Set("Poisson"), "Valid strategy")
+	assert.Equal(t, POISSON, strategy, "Strategy is parsed")
+	assert.NotNil(t, strategy.Set("sometimes"), "Invalid strategy")
+}
+
+func TestFertilityWindow(t *testing.T) {
+	parameters := NewParameters()
+	parameters.FertilityMin = 1
+	parameters.FertilityMax = 2
+	simulation := NewSimulation(&parameters)
+	simulation.agents = nil
+	// Two agents in each of generations 0 to 4
+	for i := range 10 {
+		agent := Agent{id: i, generation: i / 2, sex: Sex(i % 2), founder: i < 2}
+		if !agent.founder {
+			agent.mother, agent.father = i-i%2-1, i-i%2-2
+		}
+		simulation.agents = append(simulation.agents, agent)
+	}
+	simulation.agents[5].dead = true
+	simulation.SetGenBdrys()
+	assert.Equal(t, 0, simulation.agents[8].age(4), "Latest generation has age 0")
+	assert.Equal(t, 3, simulation.agents[3].age(4), "Age counts generations")
+
+	pool := func(gen int) []int {
+		simulation.setMatingPool(gen)
+		var ids []int
+		for _, selected := range simulation.currGen {
+			ids = append(ids, selected.id)
+		}
+		return ids
+	}
+	assert.Equal(t, []int{4, 6, 7}, pool(4), "Living agents aged 1 to 2 mate")
+	assert.Equal(t, []int{0, 1}, pool(0), "Founders start at the minimum age")
+	assert.Equal(t, []int{0, 1}, pool(1), "Agents too young to mate are left out")
+	assert.Equal(t, []int{2, 3}, pool(2), "Agents too old to mate are left out")
+
+	parameters.NumAgents = 20
+	parameters.Generations = 6
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 3
+	parameters.FertilityMin = 0
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation with overlapping generations succeeds")
+	require.Nil(t, simulation.CheckInvariants(), "Pedigree is well formed")
+	older := 0
+	for _, agent := range simulation.agents {
+		if !agent.isFounder() && agent.generation-simulation.agents[agent.mother].generation > 1 {
+			older++
+		}
+	}
+	assert.Greater(t, older, 0, "Agents of earlier generations still have children")
+
+	parameters.FertilityMax = 0
+	parameters.FertilityMin = 1
+	assert.NotNil(t, parameters.Validate(), "Fertility window must be a range")
+}
+
+func TestOverlap(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 10
+	parameters.Generations = 3
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 5
+	parameters.Overlap = true
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation with overlap succeeds")
+	require.Nil(t, simulation.CheckInvariants(), "Birth generations are bounded correctly")
+	assert.Equal(t, []int{10, 20, 40, 80}, simulation.genBdrys, "Pool grows with every generation")
+	founderParent := false
+	for _, agent := range simulation.agents[simulation.genStart(2):simulation.genBdrys[2]] {
+		founderParent = founderParent ||
+			simulation.agents[agent.mother].generation == 0 || simulation.agents[agent.father].generation == 0
+	}
+	assert.True(t, founderParent, "Founder is a parent of a generation 2 child")
+
+	parameters.FertilityMin = 1
+	assert.Nil(t, parameters.Validate(), "Overlap needs no oldest fertile age")
+}
+
+func TestGeneration(t *testing.T) {
+	simulation := setupSim(t)
+	var ids []int
+	for _, agent := range simulation.Generation(2) {
+		ids = append(ids, agent.id)
+	}
+	assert.Equal(t, []int{5, 6, 7, 8}, ids, "Generation 2 is agents 5 to 8")
+	assert.Len(t, simulation.Generation(0), 2, "Founders")
+	assert.Nil(t, simulation.Generation(-1), "No negative generation")
+	assert.Nil(t, simulation.Generation(4), "No generation after the last")
+}
+
+func TestDescendants(t *testing.T) {
+	simulation := setupSim(t)
+	var everyoneAfter []int
+	for id := 2; id < len(simulation.agents); id++ {
+		everyoneAfter = append(everyoneAfter, id)
+	}
+	assert.Equal(t, everyoneAfter, simulation.Descendants(1), "Founder is an ancestor of everyone after it")
+	assert.Empty(t, simulation.Descendants(len(simulation.agents)-1), "Last generation has no descendants")
+
+	// A malformed pedigree in which agent 2 is a child of its own child
+	simulation.agents[5].children = append(simulation.agents[5].children, 2)
+	assert.Equal(t, everyoneAfter, simulation.Descendants(1), "Cycles are visited once")
+}
+
+func TestLineagePath(t *testing.T) {
+	simulation := setupSim(t)
+	path, found := simulation.LineagePath(13, 1)
+	require.True(t, found, "Founder 1 is an ancestor of agent 13")
+	require.Len(t, path, 4, "One agent per generation from 3 back to 0")
+	assert.Equal(t, 13, path[0], "Path starts at the descendant")
+	assert.Equal(t, 1, path[len(path)-1], "Path ends at the ancestor")
+	for i := 0; i < len(path)-1; i++ {
+		agent := simulation.agents[path[i]]
+		assert.Contains(t, []int{agent.mother, agent.father}, path[i+1],
+			"Agent %d is a parent of agent %d", path[i+1], path[i])
+	}
+
+	path, found = simulation.LineagePath(13, 13)
+	assert.True(t, found, "An agent is on its own line")
+	assert.Equal(t, []int{13}, path, "Path of one agent")
+	_, found = simulation.LineagePath(13, 9)
+	assert.False(t, found, "Agents of the same generation have no line of descent")
+	_, found = simulation.LineagePath(1, 13)
+	assert.False(t, found, "Descendants aren't ancestors")
+}
+
+func TestMRCA(t *testing.T) {
+	simulation := setupSim(t)
+	ancestor, generation, found := simulation.MRCA(9, 13)
+	require.True(t, found, "Agents 9 and 13 have a common ancestor")
+	// Both descend from agent 4, which is more recent than the founders
+	assert.Equal(t, 4, ancestor, "Most recent common ancestor is the latest shared one")
+	assert.Equal(t, 1, generation, "Generation of the most recent common ancestor")
+	assert.NotNil(t, simulation.agents[9].ancestorSet, "Ancestors are set when needed")
+	assert.Equal(t, simulation.agents[9].generation-generation,
+		generationDiff(simulation.agents, &simulation.agents[9], &simulation.agents[13]),
+		"Agrees with the generation difference")
+
+	ancestor, generation, found = simulation.MRCA(2, 3)
+	require.True(t, found, "Siblings have a common ancestor")
+	assert.True(t, simulation.agents[ancestor].isFounder(), "Siblings' most recent common ancestor is a founder")
+	assert.Equal(t, 0, generation, "Founders are in generation 0")
+
+	_, _, found = simulation.MRCA(0, 1)
+	assert.False(t, found, "Founders have no common ancestor")
+}
+
+func TestCommonAncestorSamples(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 100
+	parameters.Generations = 6
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 7
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	last := simulation.LastGeneration()
+	simulation.setAncestorsGen(last)
+	exhaustive := simulation.reportCommonAncestors(last)
+	assert.Equal(t, 0, exhaustive.Samples, "Every pair is compared by default")
+
+	simulation.params.CommonAncestorSamples = 1000
+	sampled := simulation.reportCommonAncestors(last)
+	assert.Equal(t, 1000, sampled.Samples, "Pairs are sampled")
+	assert.InDelta(t, exhaustive.Mean, sampled.Mean, 0.05*exhaustive.Mean, "Sampled mean estimates the exhaustive one")
+	assert.GreaterOrEqual(t, sampled.Min, exhaustive.Min, "Sample extremes are within the exhaustive ones")
+	assert.LessOrEqual(t, sampled.Max, exhaustive.Max, "Sample extremes are within the exhaustive ones")
+
+	simulation.params.CommonAncestorSamples = 100 * 99 / 2
+	assert.Equal(t, 0, simulation.reportCommonAncestors(last).Samples, "Pairs aren't sampled if there are too few")
+}
+
+func TestMatingRadius(t *testing.T) {
+	for _, compatible := range []bool{false, true} {
+		parameters := NewParameters()
+		parameters.NumAgents = 8
+		parameters.Generations = 1
+		parameters.GrowthRate = 2.0
+		parameters.Strategy = CEIL
+		parameters.Compatible = compatible
+		parameters.MatingRadius = 0.1
+		parameters.Dispersal = 0.05
+		parameters.Seed = 2
+		simulation := NewSimulation(&parameters)
+		for i := range simulation.agents {
+			x, y := simulation.agents[i].Position()
+			assert.True(t, x >= 0.0 && x < 1.0 && y >= 0.0 && y < 1.0, "Founders are in the unit square")
+			// Agents 0 to 3 are close together and far from 4 to 7
+			corner := 0.1
+			if i >= 4 {
+				corner = 0.9
+			}
+			simulation.agents[i].x = corner + 0.01*float64(i%4)
+			simulation.agents[i].y = corner
+			simulation.agents[i].sex = Sex(i % 2)
+		}
+		require.Nil(t, simulation.Simulate(), "Spatial simulation succeeds")
+		children := simulation.agents[8:]
+		assert.NotEmpty(t, children, "Nearby agents mate")
+		for _, child := range children {
+			assert.Equal(t, child.mother < 4, child.father < 4, "Far apart agents never mate")
+			x, y := child.Position()
+			assert.InDelta(t, 0.5*(simulation.agents[child.mother].x+simulation.agents[child.father].x), x,
+				0.05, "Child is placed near its parents")
+			assert.InDelta(t, 0.5*(simulation.agents[child.mother].y+simulation.agents[child.father].y), y,
+				0.05, "Child is placed near its parents")
+		}
+	}
+}
+
+func TestMatingLog(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 6
+	parameters.GrowthRate = 1.2
+	parameters.Seed = 8
+	parameters.LogMatings = true
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	log := simulation.MatingLog()
+	assert.Equal(t, len(simulation.agents)-parameters.NumAgents, len(log), "Every child is logged")
+	for i, event := range log {
+		child := simulation.agents[event.Child]
+		assert.Equal(t, parameters.NumAgents+i, event.Child, "Children are logged in order")
+		assert.Equal(t, child.generation, event.Generation, "Event has the child's generation")
+		assert.Equal(t, child.father, event.Male, "Event has the father")
+		assert.Equal(t, child.mother, event.Female, "Event has the mother")
+	}
+
+	parameters.LogMatings = false
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation without the log succeeds")
+	assert.Nil(t, simulation.MatingLog(), "Matings aren't logged unless asked")
+}
+
+func TestMatingTypes(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 60
+	parameters.Generations = 4
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Monogamous = true
+	parameters.Compatible = true
+	parameters.NumMatingTypes = 3
+	parameters.Seed = 11
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	types := make(map[Sex]int)
+	for _, agent := range simulation.agents {
+		types[agent.sex]++
+		if !agent.isFounder() {
+			father, mother := simulation.agents[agent.father], simulation.agents[agent.mother]
+			assert.NotEqual(t, father.sex, mother.sex, "Only agents of different types pair")
+			assert.Less(t, father.sex, mother.sex, "Lower type takes the male role")
+		}
+	}
+	assert.Equal(t, 3, len(types), "Agents have all three types")
+	for sex := range types {
+		assert.Less(t, int(sex), 3, "Types are in range")
+	}
+}
+
+// Returns the mean number of genes the parents of each child share
+func meanMateSimilarity(simulation *Simulation) float64 {
+	total, children := 0, 0
+	for _, agent := range simulation.agents {
+		if agent.isFounder() {
+			continue
+		}
+		mother := slices.Sorted(slices.Values(simulation.agents[agent.mother].genes))
+		father := slices.Sorted(slices.Values(simulation.agents[agent.father].genes))
+		total += CountCommonElementsSortedArray(mother, father)
+		children++
+	}
+	return float64(total) / float64(children)
+}
+
+func TestAssortativeMating(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 60
+	parameters.Generations = 8
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Compatible = true
+	parameters.MatingK = 20
+	parameters.Seed = 5
+	random := NewSimulation(&parameters)
+	require.Nil(t, random.Simulate(), "Random mating succeeds")
+	parameters.AssortativeMating = true
+	assortative := NewSimulation(&parameters)
+	require.Nil(t, assortative.Simulate(), "Assortative mating succeeds")
+	assert.Greater(t, meanMateSimilarity(assortative), meanMateSimilarity(random),
+		"Assortative mates share more genes")
+	for _, agent := range assortative.agents {
+		if !agent.isFounder() {
+			assert.NotEqual(t, assortative.agents[agent.mother].sex, assortative.agents[agent.father].sex,
+				"Assortative mates are compatible")
+		}
+	}
+}
+
+func TestAvoidInbreeding(t *testing.T) {
+	// Mean inbreeding coefficient of the last generation over several seeds
+	meanInbreeding := func(avoid bool) float64 {
+		total, count := 0.0, 0
+		for seed := range int64(5) {
+			parameters := NewParameters()
+			parameters.NumAgents = 40
+			parameters.Generations = 10
+			parameters.GrowthRate = 1.0
+			parameters.Strategy = CEIL
+			parameters.Compatible = true
+			parameters.MateSibling = true
+			parameters.MateCousin = true
+			parameters.MatingK = 20
+			parameters.Seed = seed + 1
+			parameters.AvoidInbreeding = avoid
+			simulation := NewSimulation(&parameters)
+			require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+			for _, f := range simulation.InbreedingCoefficients(simulation.LastGeneration()) {
+				total += f
+				count++
+			}
+		}
+		return total / float64(count)
+	}
+	assert.Less(t, meanInbreeding(true), meanInbreeding(false), "Avoiding inbreeding lowers it")
+
+	parameters := NewParameters()
+	parameters.AssortativeMating = true
+	parameters.AvoidInbreeding = true
+	assert.NotNil(t, parameters.Validate(), "Assortative mating and avoiding inbreeding conflict")
+}
+
+func TestMaxPopulation(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 10
+	parameters.Generations = 10
+	parameters.GrowthRate = 2.0
+	parameters.Strategy = CEIL
+	parameters.MateSelf = true
+	parameters.LogMatings = true
+	parameters.MaxPopulation = 100
+	simulation := NewSimulation(&parameters)
+	// Generations of 10, 20 and 40 agents make 70, and 80 more would make 150
+	err := simulation.Simulate()
+	var simErr *SimError
+	require.ErrorAs(t, err, &simErr, "Simulation stops with a SimError")
+	assert.Equal(t, PopulationLimit, simErr.Kind, "Population limit error")
+	assert.Equal(t, 3, simErr.Generation, "Generation 3 would exceed the limit")
+	assert.Equal(t, 150, simErr.Agents, "Agents there would have been")
+	assert.Equal(t, 70, len(simulation.agents), "Generation 3 is discarded")
+	assert.Equal(t, 3, simulation.NumGenerations(), "Generations 0 to 2 are kept")
+	assert.Nil(t, simulation.CheckInvariants(), "Parents don't refer to discarded children")
+	assert.Len(t, simulation.MatingLog(), 60, "Matings of discarded children aren't logged")
+
+	parameters.MaxPopulation = 5
+	assert.NotNil(t, parameters.Validate(), "Limit below the founders")
+}
+
+func TestNewSimulationFromAgents(t *testing.T) {
+	sexes := []Sex{MALE, FEMALE, MALE, FEMALE}
+	var founders []Agent
+	for i, sex := range sexes {
+		genes := []string{strconv.Itoa(i) + "-0", strconv.Itoa(i) + "-1"}
+		founders = append(founders, NewFounder(i, sex, genes, 0.0, 0.0))
+	}
+	parameters := NewParameters()
+	parameters.NumAgents = 100
+	parameters.Generations = 3
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 2
+	simulation, err := NewSimulationFromAgents(&parameters, founders)
+	require.Nil(t, err, "Founders are valid")
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+
+	generation0 := simulation.Generation(0)
+	require.Len(t, generation0, 4, "Generation 0 is the given founders")
+	for i, agent := range generation0 {
+		assert.Equal(t, sexes[i], agent.Sex(), "Founder %d keeps its sex", i)
+		assert.Equal(t, founders[i].Genes(), agent.Genes(), "Founder %d keeps its genes", i)
+	}
+	assert.Len(t, simulation.Generation(3), 4, "The population grows from the founders")
+	for _, agent := range simulation.Generation(3) {
+		for _, gene := range agent.Genes() {
+			founder, err := geneOrigin(gene)
+			require.Nil(t, err, "Gene is traced")
+			assert.Less(t, founder, 4, "Genes come from the given founders")
+		}
+	}
+
+	founders[2].generation = 1
+	_, err = NewSimulationFromAgents(&parameters, founders)
+	assert.NotNil(t, err, "Founders must be in generation 0")
+	founders[2].generation, founders[2].id = 0, 5
+	_, err = NewSimulationFromAgents(&parameters, founders)
+	assert.NotNil(t, err, "Founders' ids must be their indices")
+}
+
+func TestSexImbalance(t *testing.T) {
+	males, females := setupSim(t).SexCounts(1)
+	assert.Equal(t, [2]int{2, 1}, [2]int{males, females}, "Generation 1 has two males and a female")
+
+	var founders []Agent
+	for i := range 4 {
+		founders = append(founders, NewFounder(i, MALE, []string{strconv.Itoa(i) + "-0"}, 0.0, 0.0))
+	}
+	for _, monogamous := range []bool{false, true} {
+		parameters := NewParameters()
+		parameters.Generations = 2
+		parameters.Compatible = true
+		parameters.Monogamous = monogamous
+		simulation, err := NewSimulationFromAgents(&parameters, founders)
+		require.Nil(t, err, "Founders are valid")
+		males, females := simulation.SexCounts(0)
+		assert.Equal(t, [2]int{4, 0}, [2]int{males, females}, "The last generation is all male")
+		err = simulation.Simulate()
+		var simErr *SimError
+		require.ErrorAs(t, err, &simErr, "Simulation stops with a SimError")
+		assert.Equal(t, SexImbalance, simErr.Kind, "Sex imbalance error, monogamous %v", monogamous)
+		assert.Equal(t, 1, simErr.Generation, "Generation 1 can't be made")
+		assert.Equal(t, 4, simErr.Males, "Four males")
+		assert.Contains(t, err.Error(), "sex imbalance for generation, 1", "Error names the imbalance")
 	}
 }
@@ -0,0 +1,89 @@
+// Summarizing the analysis results of a batch of simulations.
+
+package abm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Mean and population variance of a metric over the simulations of a batch
+// whose results have it
+type MetricSummary struct {
+	Metric      string
+	Simulations int
+	Mean        float64
+	Variance    float64
+}
+
+// The metrics AggregateResults summarizes, in the order they are returned,
+// and how to get each from a result. ok is false if the analysis it comes
+// from wasn't selected.
+var aggregateMetrics = []struct {
+	name  string
+	value func(r *AnalysisResult) (value float64, ok bool)
+}{
+	{"mean-ancestors", func(r *AnalysisResult) (float64, bool) {
+		if r.NumAncestors == nil {
+			return 0, false
+		}
+		return r.NumAncestors.Mean, true
+	}},
+	{"mean-common-ancestors", func(r *AnalysisResult) (float64, bool) {
+		if r.CommonAncestors == nil {
+			return 0, false
+		}
+		return r.CommonAncestors.Mean, true
+	}},
+	{"mean-generation-diff", func(r *AnalysisResult) (float64, bool) {
+		if r.GenerationDiff == nil {
+			return 0, false
+		}
+		return r.GenerationDiff.Mean, true
+	}},
+	{"num-genes-last-gen", func(r *AnalysisResult) (float64, bool) {
+		if len(r.Genes) == 0 {
+			return 0, false
+		}
+		return float64(len(r.Genes[len(r.Genes)-1].GeneCounts)), true
+	}},
+}
+
+// Receives analysis results until results is closed and returns the mean and
+// variance of each metric over them. It is meant to be the single collector
+// of a batch, run in its own goroutine, with the simulations sending their
+// results as they finish so that no locking is needed. Metrics that none of
+// the results have are left out.
+func AggregateResults(results <-chan AnalysisResult) []MetricSummary {
+	sums := make([]float64, len(aggregateMetrics))
+	squares := make([]float64, len(aggregateMetrics))
+	counts := make([]int, len(aggregateMetrics))
+	for r := range results {
+		for i, m := range aggregateMetrics {
+			if value, ok := m.value(&r); ok {
+				sums[i] += value
+				squares[i] += value * value
+				counts[i]++
+			}
+		}
+	}
+	var summaries []MetricSummary
+	for i, m := range aggregateMetrics {
+		if counts[i] == 0 {
+			continue
+		}
+		n := float64(counts[i])
+		mean := sums[i] / n
+		summaries = append(summaries, MetricSummary{Metric: m.name, Simulations: counts[i],
+			Mean: mean, Variance: max(squares[i]/n-mean*mean, 0.0)})
+	}
+	return summaries
+}
+
+// Writes one line per metric summary
+func WriteAggregate(w io.Writer, summaries []MetricSummary) {
+	for _, m := range summaries {
+		fmt.Fprintf(w, "rpt-aggregate, metric, %s, simulations, %d, mean, %.4f, variance, %.4f\n",
+			m.Metric, m.Simulations, m.Mean, m.Variance)
+	}
+}
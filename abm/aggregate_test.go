@@ -0,0 +1,70 @@
+package abm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAggregateResults(t *testing.T) {
+	results := make(chan AnalysisResult, 3)
+	for _, mean := range []float64{2, 4, 9} {
+		results <- AnalysisResult{NumAncestors: &NumAncestorsResult{Mean: mean}}
+	}
+	close(results)
+	summaries := AggregateResults(results)
+	require.Len(t, summaries, 1, "Only the metric the results have is summarized")
+	assert.Equal(t, "mean-ancestors", summaries[0].Metric, "Metric is named")
+	assert.Equal(t, 3, summaries[0].Simulations, "Every result is counted")
+	assert.InDelta(t, 5.0, summaries[0].Mean, 1e-9, "Mean of 2, 4 and 9")
+	assert.InDelta(t, 26.0/3.0, summaries[0].Variance, 1e-9, "Population variance of 2, 4 and 9")
+
+	var out strings.Builder
+	WriteAggregate(&out, summaries)
+	assert.Equal(t, "rpt-aggregate, metric, mean-ancestors, simulations, 3, mean, 5.0000, variance, 8.6667\n",
+		out.String(), "Summary is written")
+}
+
+func TestAggregateBatch(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 4
+	parameters.Seed = 7
+	parameters.Analysis = "NCD"
+	batch := Replicates(parameters, 4)
+
+	results := make(chan AnalysisResult)
+	aggregated := make(chan []MetricSummary)
+	go func() { aggregated <- AggregateResults(results) }()
+	var mu sync.Mutex
+	var means []float64
+	// Emitted from the simulations' goroutines, where require can't stop the
+	// test
+	summary := RunBatch(context.Background(), batch, func(r BatchResult) {
+		r.Simulation.SetOutput(io.Discard, io.Discard)
+		result, err := r.Simulation.Analysis()
+		if !assert.Nil(t, err, "Analysis succeeds") {
+			return
+		}
+		mu.Lock()
+		means = append(means, result.NumAncestors.Mean)
+		mu.Unlock()
+		results <- result
+	})
+	close(results)
+	summaries := <-aggregated
+	require.Equal(t, 4, summary.Completed, "Every simulation completes")
+
+	total := 0.0
+	for _, mean := range means {
+		total += mean
+	}
+	require.Len(t, summaries, 3, "N, C and D are summarized")
+	assert.Equal(t, "mean-ancestors", summaries[0].Metric, "Ancestors come first")
+	assert.Equal(t, 4, summaries[0].Simulations, "Every simulation is aggregated")
+	assert.InDelta(t, total/4.0, summaries[0].Mean, 1e-9, "Mean over the simulations")
+}
@@ -0,0 +1,202 @@
+package abm
+
+import (
+	"fmt"
+	"math/bits"
+	"testing"
+)
+
+// Proposed alternative to the map and sorted slice ancestor representation:
+// one bit per agent id
+type ancestorBitset []uint64
+
+func newAncestorBitset(n int) ancestorBitset {
+	return make(ancestorBitset, (n+63)/64)
+}
+
+func (b ancestorBitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b ancestorBitset) has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+// Counts the ancestors two bitsets have in common
+func (b ancestorBitset) intersectCount(c ancestorBitset) int {
+	total := 0
+	for i := range min(len(b), len(c)) {
+		total += bits.OnesCount64(b[i] & c[i])
+	}
+	return total
+}
+
+// Bitset version of setAncestors
+func setAncestorsBitset(agents []Agent, id int) ancestorBitset {
+	ancestors := newAncestorBitset(id)
+	stack := []int{id}
+	for len(stack) > 0 {
+		curr := &agents[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if curr.isFounder() {
+			continue
+		}
+		for _, parent := range [...]int{curr.mother, curr.father} {
+			if !ancestors.has(parent) {
+				ancestors.set(parent)
+				stack = append(stack, parent)
+			}
+		}
+	}
+	return ancestors
+}
+
+// Bitset version of mrca, which finds the highest common ancestor id
+func mrcaBitset(a, b ancestorBitset) (int, bool) {
+	for i := min(len(a), len(b)) - 1; i >= 0; i-- {
+		if common := a[i] & b[i]; common != 0 {
+			return i*64 + 63 - bits.LeadingZeros64(common), true
+		}
+	}
+	return 0, false
+}
+
+// Simulates a constant sized population for the given number of generations
+// and returns it with the range of ids of its last generation
+func benchSimulation(b *testing.B, depth int) (*Simulation, int, int) {
+	parameters := NewParameters()
+	parameters.NumAgents = 200
+	parameters.GrowthRate = 1.0
+	parameters.Generations = depth
+	parameters.Seed = 1
+	simulation := NewSimulation(&parameters)
+	if err := simulation.Simulate(); err != nil {
+		b.Fatal(err)
+	}
+	return simulation, simulation.genStart(depth), simulation.genBdrys[depth]
+}
+
+var benchDepths = []int{4, 8, 16, 32}
+
+func BenchmarkAncestorConstruction(b *testing.B) {
+	for _, depth := range benchDepths {
+		simulation, start, end := benchSimulation(b, depth)
+		b.Run(fmt.Sprintf("map/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := start; i < end; i++ {
+					setAncestors(simulation.agents, i, 0)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("bitset/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := start; i < end; i++ {
+					setAncestorsBitset(simulation.agents, i)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAncestorMembership(b *testing.B) {
+	for _, depth := range benchDepths {
+		simulation, start, end := benchSimulation(b, depth)
+		simulation.setAncestorsGen(depth)
+		bitsets := make([]ancestorBitset, end-start)
+		for i := range bitsets {
+			bitsets[i] = setAncestorsBitset(simulation.agents, start+i)
+		}
+		b.Run(fmt.Sprintf("map/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := start + 1; i < end; i++ {
+					mrca(&simulation.agents[i], &simulation.agents[i-1])
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("bitset/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := 1; i < len(bitsets); i++ {
+					mrcaBitset(bitsets[i], bitsets[i-1])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAncestorIntersection(b *testing.B) {
+	for _, depth := range benchDepths {
+		simulation, start, end := benchSimulation(b, depth)
+		simulation.setAncestorsGen(depth)
+		bitsets := make([]ancestorBitset, end-start)
+		for i := range bitsets {
+			bitsets[i] = setAncestorsBitset(simulation.agents, start+i)
+		}
+		b.Run(fmt.Sprintf("map/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := start + 1; i < end; i++ {
+					CountCommonElementsSortedArray(simulation.agents[i].ancestorVec,
+						simulation.agents[i-1].ancestorVec)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("bitset/depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				for i := 1; i < len(bitsets); i++ {
+					bitsets[i].intersectCount(bitsets[i-1])
+				}
+			}
+		})
+	}
+}
+
+// Compares storing every generation of ancestors for every agent with storing
+// only the most recent few, reporting the number of ancestor ids kept
+func BenchmarkAncestorCache(b *testing.B) {
+	depth := benchDepths[len(benchDepths)-1]
+	simulation, _, _ := benchSimulation(b, depth)
+	for _, cache := range []int{0, 4, 8} {
+		simulation.params.AncestorCacheDepth = cache
+		b.Run(fmt.Sprintf("cache=%d", cache), func(b *testing.B) {
+			b.ReportAllocs()
+			stored := 0
+			for b.Loop() {
+				stored = 0
+				for gen := range simulation.genBdrys {
+					simulation.setAncestorsGen(gen)
+				}
+				for i := range simulation.agents {
+					stored += len(simulation.agents[i].ancestorVec)
+				}
+			}
+			b.ReportMetric(float64(stored), "ancestors-stored")
+		})
+	}
+}
+
+// The bitset representation must agree with the current one for the
+// benchmarks to be a fair comparison
+func TestAncestorBitsetMatches(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.setAncestorsGen(3)
+	for i := 9; i < 14; i++ {
+		a := setAncestorsBitset(simulation.agents, i)
+		for j := 9; j < 14; j++ {
+			b := setAncestorsBitset(simulation.agents, j)
+			want := CountCommonElementsSortedArray(simulation.agents[i].ancestorVec,
+				simulation.agents[j].ancestorVec)
+			if got := a.intersectCount(b); got != want {
+				t.Errorf("agents %d and %d: bitset common %d, want %d", i, j, got, want)
+			}
+			wantMRCA, wantFound := mrca(&simulation.agents[i], &simulation.agents[j])
+			if got, found := mrcaBitset(a, b); got != wantMRCA || found != wantFound {
+				t.Errorf("agents %d and %d: bitset mrca %d, want %d", i, j, got, wantMRCA)
+			}
+		}
+	}
+}
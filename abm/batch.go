@@ -0,0 +1,94 @@
+// Running batches of simulations in parallel.
+
+package abm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// Outcome of one simulation in a batch
+type BatchResult struct {
+	SimulationId int
+	Simulation   *Simulation
+	Err          error
+}
+
+// Counts of how the simulations in a batch ended
+type BatchSummary struct {
+	Completed int
+	Failed    int
+	Cancelled int
+}
+
+// Runs one simulation per set of parameters in parallel. As soon as a
+// simulation finishes, successfully or not, emit is called with its result
+// from the simulation's goroutine, so emit must be safe for concurrent use.
+// Simulations that are stopped because ctx is cancelled are counted but not
+// emitted. RunBatch returns once every simulation and call to emit is done,
+// so the results of simulations completed before a cancellation are never
+// lost.
+func RunBatch(ctx context.Context, params []Parameters, emit func(BatchResult)) BatchSummary {
+	return RunBatchSetup(ctx, params, nil, emit)
+}
+
+// Runs a batch like RunBatch, but first calls setup, if it is set, with each
+// simulation before it runs, for example to install a ProgressFunc. setup is
+// called from the simulation's goroutine.
+func RunBatchSetup(ctx context.Context, params []Parameters, setup func(*Simulation),
+	emit func(BatchResult)) BatchSummary {
+	var summary BatchSummary
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range params {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := params[i]
+			simulation := NewSimulation(&p)
+			if setup != nil {
+				setup(simulation)
+			}
+			err := simulation.SimulateContext(ctx)
+			cancelled := err != nil &&
+				(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+			mu.Lock()
+			switch {
+			case cancelled:
+				summary.Cancelled++
+			case err != nil:
+				summary.Failed++
+			default:
+				summary.Completed++
+			}
+			mu.Unlock()
+			if !cancelled {
+				emit(BatchResult{p.SimulationId, simulation, err})
+			}
+		}()
+	}
+	wg.Wait()
+	return summary
+}
+
+// Returns the parameters for n replicates of a simulation that share the same
+// founders but reproduce differently. The replicates get consecutive ids and
+// seeds. If params has no founder seed, its seed is used, and if it has no
+// seed either a random one is picked first.
+func Replicates(params Parameters, n int) []Parameters {
+	if params.Seed == 0 {
+		params.Seed = rand.Int63()
+	}
+	if params.FounderSeed == 0 {
+		params.FounderSeed = params.Seed
+	}
+	replicates := make([]Parameters, n)
+	for i := range replicates {
+		replicates[i] = params
+		replicates[i].SimulationId = params.SimulationId + i
+		replicates[i].Seed = params.Seed + int64(i)
+	}
+	return replicates
+}
@@ -0,0 +1,98 @@
+package abm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestRunBatchCancelled(t *testing.T) {
+	quick := Parameters{
+		SimulationId: 0,
+		NumAgents:    2,
+		Generations:  2,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+	}
+	// Would run practically forever unless cancelled
+	slow := Parameters{
+		SimulationId: 1,
+		NumAgents:    100,
+		Generations:  1 << 30,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var emitted []int
+	summary := RunBatch(ctx, []Parameters{quick, slow}, func(r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Nil(t, r.Err, "Emitted simulation succeeded")
+		emitted = append(emitted, r.SimulationId)
+		cancel()
+	})
+	assert.Equal(t, []int{0}, emitted, "Only the completed simulation is emitted")
+	assert.Equal(t, BatchSummary{Completed: 1, Failed: 0, Cancelled: 1}, summary,
+		"One simulation completed and one cancelled")
+}
+
+func TestReplicatesShareFounders(t *testing.T) {
+	params := NewParameters()
+	params.NumAgents = 20
+	params.Generations = 5
+	params.MutationModel = NUCLEOTIDE
+	params.Seed = 77
+	replicates := Replicates(params, 3)
+	simulations := make(map[int]*Simulation)
+	var mu sync.Mutex
+	RunBatch(context.Background(), replicates, func(r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Nil(t, r.Err, "Replicate succeeds")
+		simulations[r.SimulationId] = r.Simulation
+	})
+	assert.Equal(t, 3, len(simulations), "Every replicate is run")
+	first := simulations[0]
+	for id := 1; id < 3; id++ {
+		other := simulations[id]
+		for i := range first.genBdrys[0] {
+			assert.Equal(t, first.agents[i].sex, other.agents[i].sex, "Replicates share founder sexes")
+			assert.Equal(t, first.agents[i].genes, other.agents[i].genes, "Replicates share founder genes")
+		}
+		assert.NotEqual(t, fingerprint(first), fingerprint(other), "Replicates diverge")
+	}
+}
+
+func TestProgressFunc(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 3,
+		NumAgents:    4,
+		Generations:  5,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+	}
+	simulation := NewSimulation(&parameters)
+	var generations []int
+	simulation.ProgressFunc = func(generation, numAgents int) {
+		generations = append(generations, generation)
+		assert.Equal(t, 4*(generation+1), numAgents, "Agents so far are passed")
+	}
+	assert.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, generations, "Called once per generation")
+
+	var mu sync.Mutex
+	calls := 0
+	summary := RunBatchSetup(context.Background(), []Parameters{parameters, parameters},
+		func(s *Simulation) {
+			s.ProgressFunc = func(int, int) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+			}
+		}, func(BatchResult) {})
+	assert.Equal(t, 2, summary.Completed, "Both simulations complete")
+	assert.Equal(t, 2*5, calls, "Setup installs the progress function in every simulation")
+}
@@ -0,0 +1,73 @@
+// Bounding memory on long runs by discarding old generations.
+
+package abm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Analyses that need the whole pedigree back to the founders, so they can't
+// be done once generations have been discarded
+const ancestryAnalyses = "NCDROKIFLPX"
+
+// Discards the agents of the generations before gen. The agents left are
+// re-identified so that ids stay indices, and those whose parents are
+// discarded become founders. The discarded generations stay in genBdrys, but
+// empty, so that generation numbers don't change.
+func (s *Simulation) discardBefore(gen int) {
+	if gen <= 0 {
+		return
+	}
+	offset := s.genStart(gen)
+	if offset == 0 {
+		return
+	}
+	// Copied so that the discarded agents' memory can be freed
+	s.agents = slices.Clone(s.agents[offset:])
+	for i := range s.agents {
+		agent := &s.agents[i]
+		agent.id -= offset
+		if !agent.isFounder() {
+			if agent.mother < offset || agent.father < offset {
+				agent.founder = true
+				agent.mother, agent.father = 0, 0
+			} else {
+				agent.mother -= offset
+				agent.father -= offset
+			}
+		}
+		for j := range agent.children {
+			agent.children[j] -= offset
+		}
+		agent.ancestorVec, agent.ancestorSet = nil, nil
+	}
+	for g := range s.genBdrys {
+		s.genBdrys[g] = max(s.genBdrys[g]-offset, 0)
+	}
+	if s.kinship != nil {
+		s.kinship.start -= offset
+	}
+	s.kinships = nil
+}
+
+// Returns an error if any of the analyses need ancestors that have been
+// discarded
+func (s *Simulation) checkAncestryKept(analyses AnalysisSet) error {
+	if s.params.KeepGenerations <= 0 {
+		return nil
+	}
+	var needed strings.Builder
+	for _, letter := range ancestryAnalyses {
+		if analyses.Has(letter) {
+			needed.WriteRune(letter)
+		}
+	}
+	if needed.Len() == 0 {
+		return nil
+	}
+	return &SimError{SimID: s.id, Generation: s.LastGeneration(), Kind: AncestorsDiscarded,
+		Err: fmt.Errorf("analyses %s need the generations discarded by keeping only %d",
+			needed.String(), s.params.KeepGenerations)}
+}
@@ -0,0 +1,45 @@
+package abm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeepGenerations(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 30
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Compatible = true
+	parameters.Seed = 4
+	parameters.KeepGenerations = 3
+	parameters.Analysis = "GgYHE"
+	simulation := NewSimulation(&parameters)
+	largest := 0
+	simulation.ProgressFunc = func(generation, numAgents int) {
+		largest = max(largest, numAgents)
+	}
+	require.Nil(t, simulation.Simulate(), "Bounded simulation succeeds")
+	assert.Equal(t, 30, simulation.LastGeneration(), "Simulation advances every generation")
+	assert.Equal(t, 60, len(simulation.agents), "Only three generations are kept")
+	assert.LessOrEqual(t, largest, 60, "Agents stay bounded throughout")
+	require.Nil(t, simulation.CheckInvariants(), "Kept pedigree is well formed")
+	for _, agent := range simulation.agents[:20] {
+		assert.True(t, agent.isFounder(), "Agents whose parents are discarded are founders")
+	}
+	assert.Equal(t, 28, simulation.agents[0].generation, "Generations keep their numbers")
+
+	_, err := simulation.Analysis()
+	assert.Nil(t, err, "Analyses that don't need ancestors succeed")
+	simulation.params.Analysis = "NG"
+	_, err = simulation.Analysis()
+	var simErr *SimError
+	require.True(t, errors.As(err, &simErr), "Ancestry analyses fail")
+	assert.Equal(t, AncestorsDiscarded, simErr.Kind, "Error says the ancestors were discarded")
+
+	parameters.KeepGenerations = 2
+	assert.NotNil(t, parameters.Validate(), "Grandparents must be kept")
+}
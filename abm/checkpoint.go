@@ -0,0 +1,62 @@
+// Checkpointing long runs so that they can be resumed after a crash.
+
+package abm
+
+import (
+	"fmt"
+	"os"
+)
+
+// Writes the simulation to Parameters.CheckpointPath. It is written to a
+// temporary file first and renamed, so a crash while writing leaves the
+// previous checkpoint intact.
+func (s *Simulation) writeCheckpoint() error {
+	tmp := s.params.CheckpointPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("%d, checkpoint-err, %w", s.id, err)
+	}
+	if err := s.WriteJSON(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%d, checkpoint-err, %w", s.id, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%d, checkpoint-err, %w", s.id, err)
+	}
+	if err := os.Rename(tmp, s.params.CheckpointPath); err != nil {
+		return fmt.Errorf("%d, checkpoint-err, %w", s.id, err)
+	}
+	return nil
+}
+
+// Loads a checkpoint written during Simulate, so that simulating it carries
+// on from the generation after the last one checkpointed to
+// Parameters.Generations. Because each generation draws from its own random
+// stream, the agents made are the same as in an uninterrupted run. The
+// function parameters, such as OnGeneration, and the mating log and
+// unmatched counts of the generations before the checkpoint aren't restored.
+func ResumeSimulation(path string) (*Simulation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("resume-err, %w", err)
+	}
+	defer f.Close()
+	s, err := LoadSimulation(f)
+	if err != nil {
+		return nil, fmt.Errorf("resume-err, %s, %w", path, err)
+	}
+	return s, nil
+}
+
+// Replaces the parameters of a resumed simulation, so that it can carry on
+// with more generations, other analyses or an OnGeneration callback. The
+// simulation id and seed are kept, and parameters that only shape the
+// founders have no effect because they have already been made.
+func (s *Simulation) SetParameters(p Parameters) error {
+	if err := p.Validate(); err != nil {
+		return &SimError{SimID: s.id, Kind: InvalidParameters, Err: err}
+	}
+	p.SimulationId, p.Seed = s.params.SimulationId, s.params.Seed
+	s.params = p
+	return nil
+}
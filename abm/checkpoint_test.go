@@ -0,0 +1,60 @@
+package abm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeSimulation(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 5
+	parameters.GrowthRate = 1.1
+	parameters.Seed = 9
+	uninterrupted := NewSimulation(&parameters)
+	require.Nil(t, uninterrupted.Simulate(), "Uninterrupted run succeeds")
+
+	parameters.CheckpointEvery = 3
+	parameters.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint.json")
+	crashed := NewSimulation(&parameters)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Crashes after generation 3 has been made and checkpointed
+	crashed.ProgressFunc = func(generation, numAgents int) {
+		if generation == 3 {
+			cancel()
+		}
+	}
+	require.NotNil(t, crashed.SimulateContext(ctx), "Run crashes")
+
+	resumed, err := ResumeSimulation(parameters.CheckpointPath)
+	require.Nil(t, err, "Checkpoint loads")
+	assert.Equal(t, 4, resumed.NumGenerations(), "Checkpoint has generations 0 to 3")
+	require.Nil(t, resumed.Simulate(), "Resumed run succeeds")
+	assert.Equal(t, len(uninterrupted.agents), len(resumed.agents), "Same final agent count")
+	assert.Equal(t, uninterrupted.genBdrys, resumed.genBdrys, "Same generations")
+	assert.Equal(t, fingerprint(uninterrupted), fingerprint(resumed), "Same agents")
+
+	extended, err := ResumeSimulation(parameters.CheckpointPath)
+	require.Nil(t, err, "Checkpoint loads again")
+	more := extended.Parameters()
+	more.Generations = 6
+	more.SimulationId = 7
+	var made []int
+	more.OnGeneration = func(stats GenerationStats) { made = append(made, stats.Generation) }
+	require.Nil(t, extended.SetParameters(more), "Parameters are replaced")
+	require.Nil(t, extended.Simulate(), "Extended run succeeds")
+	assert.Equal(t, []int{4, 5, 6}, made, "Resumed run reports the generations it makes")
+	assert.Equal(t, uninterrupted.genBdrys, extended.genBdrys[:6], "Same generations up to the old end")
+	assert.Equal(t, parameters.SimulationId, extended.Parameters().SimulationId, "Simulation id is kept")
+	more.GrowthRate = -1
+	assert.NotNil(t, extended.SetParameters(more), "Invalid parameters are rejected")
+
+	_, err = ResumeSimulation(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err, "Missing checkpoint")
+	parameters.CheckpointPath = ""
+	assert.NotNil(t, parameters.Validate(), "Checkpoints need a path")
+}
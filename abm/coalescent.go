@@ -0,0 +1,126 @@
+// Theoretical expectations that simulated ancestry can be compared with.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Number of pairs of agents whose gene lineages GeneTMRCA traces
+var CoalescentPairs = 1_000
+
+// Fraction of the agents in a generation far enough back that are ancestors
+// of everyone in the present generation; the rest have no descendants left
+// (Chang 1999).
+const changCommonFraction = 0.7968
+
+// Returns the expected number of generations back to the most recent common
+// ancestor of a sample of n gene copies from a diploid Wright-Fisher
+// population of ne agents under the coalescent. With N = 2ne gene copies this
+// is 2N(1-1/n), so 2ne for a pair of copies.
+func ExpectedTMRCA(ne float64, n int) float64 {
+	return 4.0 * ne * (1.0 - 1.0/float64(n))
+}
+
+// Returns the expected number of generations back to the most recent
+// genealogical common ancestor of a whole population of n agents, about
+// log2(n) (Chang 1999). This is much more recent than the coalescent
+// expectation, because an ancestor needn't have passed on any genes.
+func ExpectedGenealogicalMRCA(n float64) float64 {
+	return math.Log2(n)
+}
+
+// Returns the number of generations back beyond which almost every agent is
+// either an ancestor of everyone in a population of n agents or of no one,
+// about 1.77 log2(n) (Chang 1999).
+func expectedIdenticalAncestors(n float64) float64 {
+	return 1.77 * math.Log2(n)
+}
+
+// Returns the effective population size of the generations up to the given
+// one: Parameters.EffectiveSize if it is set, otherwise the harmonic mean of
+// their sizes.
+func (s *Simulation) EffectiveSize(generation int) float64 {
+	if s.params.EffectiveSize > 0 {
+		return s.params.EffectiveSize
+	}
+	total := 0.0
+	for gen := 0; gen <= generation; gen++ {
+		total += 1.0 / float64(s.genBdrys[gen]-s.genStart(gen))
+	}
+	return float64(generation+1) / total
+}
+
+// Estimates the mean number of generations back to the most recent common
+// ancestor of a gene copy from each of CoalescentPairs random pairs of
+// distinct agents in the given generation. Each lineage moves to the mother
+// or father with equal probability every generation, and two lineages that
+// reach the same parent coalesce if they also pick the same one of its two
+// copies. Two lineages in one agent that haven't coalesced are in different
+// copies, so they move to different parents. Lineages that reach the founders without coalescing are counted
+// as the number of generations to the founders and returned as censored, so
+// the mean is too low if many are.
+func (s *Simulation) GeneTMRCA(generation int) (mean float64, censored int) {
+	start, end := s.genStart(generation), s.genBdrys[generation]
+	if end-start < 2 {
+		return 0.0, 0
+	}
+	rng := s.substream(coalescentStream)
+	parent := func(id int) int {
+		if rng.Intn(2) == 0 {
+			return s.agents[id].mother
+		}
+		return s.agents[id].father
+	}
+	total := 0
+	for range CoalescentPairs {
+		a := start + rng.Intn(end-start)
+		b := start + rng.Intn(end-start-1)
+		if b >= a {
+			b++
+		}
+		t := 0
+		for {
+			if s.agents[a].isFounder() {
+				censored++
+				break
+			}
+			if a == b { // Distinct copies of one agent come from different parents
+				a, b = s.agents[a].mother, s.agents[a].father
+			} else {
+				a, b = parent(a), parent(b)
+			}
+			t++
+			if a == b && rng.Intn(2) == 0 {
+				break
+			}
+		}
+		total += t
+	}
+	return float64(total) / float64(CoalescentPairs), censored
+}
+
+// Reports the coalescent and genealogical expectations of the time to the
+// most recent common ancestor next to the simulated values for the D analysis
+func (s *Simulation) reportCoalescentGenDiff(generation int) {
+	ne := s.EffectiveSize(generation)
+	mean, censored := s.GeneTMRCA(generation)
+	fmt.Fprintf(s.out, "%d, rpt-generation-diff, coalescent, ne, %.1f, expected-genealogical-mrca, %.1f, "+
+		"expected-gene-tmrca, %.1f, simulated-gene-tmrca, %.1f, censored, %d\n",
+		s.id, ne, ExpectedGenealogicalMRCA(ne), ExpectedTMRCA(ne, 2), mean, censored)
+}
+
+// Reports the expected minimum number of common ancestors of a pair of agents
+// for the C analysis: those in generations far enough back that almost every
+// agent with descendants is an ancestor of everyone
+func (s *Simulation) reportCoalescentCommonAncestors(generation int) {
+	ne := s.EffectiveSize(generation)
+	back := int(math.Ceil(expectedIdenticalAncestors(ne)))
+	deep := 0
+	if back <= generation {
+		deep = s.genBdrys[generation-back]
+	}
+	fmt.Fprintf(s.out, "%d, rpt-common-ancestors-last-gen, coalescent, ne, %.1f, identical-ancestors-generations, %d, "+
+		"expected-min-common-ancestors, %.1f\n", s.id, ne, back, changCommonFraction*float64(deep))
+}
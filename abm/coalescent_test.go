@@ -0,0 +1,43 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExpectedTMRCA(t *testing.T) {
+	assert.Equal(t, 20.0, ExpectedTMRCA(10, 2), "Pair of genes is 2Ne generations")
+	assert.InDelta(t, 40.0, ExpectedTMRCA(10, 1_000_000), 0.001, "Large sample approaches 4Ne generations")
+	assert.Equal(t, 3.0, ExpectedGenealogicalMRCA(8), "Genealogical MRCA is log2 N generations")
+}
+
+func TestEffectiveSize(t *testing.T) {
+	simulation := setupSim(t)
+	assert.InDelta(t, 3.117, simulation.EffectiveSize(3), 0.001, "Harmonic mean of 2, 3, 4 and 5")
+	simulation.params.EffectiveSize = 50
+	assert.Equal(t, 50.0, simulation.EffectiveSize(3), "Supplied effective size")
+}
+
+// In a constant sized population the gene lineages of a pair of agents should
+// coalesce after about 2Ne generations
+func TestGeneTMRCAWrightFisher(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 9,
+		NumAgents:    20,
+		Generations:  400,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+		NumGenes:     1,
+		Seed:         9,
+		StableRng:    true,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	last := simulation.LastGeneration()
+	ne := simulation.EffectiveSize(last)
+	assert.InDelta(t, 20.0, ne, 0.001, "Constant size is the effective size")
+	mean, censored := simulation.GeneTMRCA(last)
+	assert.Equal(t, 0, censored, "Every pair coalesces within the run")
+	assert.InEpsilon(t, ExpectedTMRCA(ne, 2), mean, 0.15, "Simulated TMRCA is close to theory")
+}
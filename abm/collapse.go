@@ -0,0 +1,51 @@
+// Pedigree collapse, when ancestors are reached by more than one path so that
+// agents have fewer distinct ancestors than the 2^(g+1) - 2 they would have
+// in g generations of unrelated parents.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Pedigree collapse of an agent
+type PedigreeCollapse struct {
+	Agent     int
+	Ancestors int
+	// Distinct ancestors divided by the number possible without collapse,
+	// 1 without collapse and falling towards 0 as it increases
+	Ratio float64
+}
+
+// Returns the pedigree collapse of every agent in the given generation, in
+// id order. The agents' ancestors are set if they haven't been, and are
+// compared with the maximum possible within the stored ancestor depth.
+func (s *Simulation) PedigreeCollapse(generation int) []PedigreeCollapse {
+	s.ensureAncestorsGen(generation)
+	_, maxPossible := s.maxPossibleAncestors(generation)
+	var collapse []PedigreeCollapse
+	for _, agent := range s.Generation(generation) {
+		c := PedigreeCollapse{Agent: agent.id, Ancestors: len(agent.ancestorVec), Ratio: math.NaN()}
+		if maxPossible > 0 {
+			c.Ratio = float64(c.Ancestors) / maxPossible
+		}
+		collapse = append(collapse, c)
+	}
+	return collapse
+}
+
+// Reports the pedigree collapse ratio of every agent in the given generation
+// and their mean
+func (s *Simulation) reportPedigreeCollapse(generation int) {
+	total := 0.0
+	collapse := s.PedigreeCollapse(generation)
+	for _, c := range collapse {
+		fmt.Fprintf(s.out, "%d, rpt-pedigree-collapse, agent, %d, ancestors, %d, ratio, %.4f\n",
+			s.id, c.Agent, c.Ancestors, c.Ratio)
+		total += c.Ratio
+	}
+	if len(collapse) > 0 {
+		fmt.Fprintf(s.out, "%d, rpt-pedigree-collapse, mean-ratio, %.4f\n", s.id, total/float64(len(collapse)))
+	}
+}
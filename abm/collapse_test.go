@@ -0,0 +1,20 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPedigreeCollapse(t *testing.T) {
+	// Two founders are the only grandparents of generation 2 and the
+	// only great-grandparents of generation 3
+	simulation := setupSim(t)
+	collapse := simulation.PedigreeCollapse(3)
+	require.Len(t, collapse, 5, "One ratio per agent of generation 3")
+	for _, c := range collapse {
+		assert.Less(t, c.Ratio, 0.5, "Agent %d's pedigree collapses", c.Agent)
+	}
+	assert.Equal(t, 9, collapse[0].Agent, "Agents are in id order")
+	assert.InDelta(t, 6.0/14.0, collapse[0].Ratio, 1e-9, "Six of fourteen possible ancestors")
+}
@@ -0,0 +1,41 @@
+// Loading parameters from a configuration file.
+
+package abm
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Reads parameters from a JSON file of Parameters field names and values,
+// such as {"NumAgents": 100, "Strategy": "ceil"}. Fields missing from the
+// file keep their NewParameters defaults. Unknown fields, invalid strategies
+// and analyses, and out of range values are errors.
+func LoadParameters(path string) (Parameters, error) {
+	p := NewParameters()
+	f, err := os.Open(path)
+	if err != nil {
+		return p, fmt.Errorf("config-err, %w", err)
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return p, fmt.Errorf("config-err, %s, %w", path, err)
+	}
+	// Checks the names and gives them the case of the constants
+	for _, value := range [...]flag.Value{&p.Strategy, &p.MutationModel, &p.Leftover} {
+		if err := value.Set(value.String()); err != nil {
+			return p, fmt.Errorf("config-err, %s, %w", path, err)
+		}
+	}
+	if _, err := ParseAnalysis(p.Analysis); err != nil {
+		return p, fmt.Errorf("config-err, %s, %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("config-err, %s, %w", path, err)
+	}
+	return p, nil
+}
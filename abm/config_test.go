@@ -0,0 +1,40 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes a config file to a temporary directory and returns its path
+func writeConfig(t *testing.T, config string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.Nil(t, os.WriteFile(path, []byte(config), 0o644), "Config file is written")
+	return path
+}
+
+func TestLoadParameters(t *testing.T) {
+	path := writeConfig(t, `{"NumAgents": 100, "GrowthRate": 1.5, "Strategy": "ceil", "Leftover": "RetryAny"}`)
+	p, err := LoadParameters(path)
+	require.Nil(t, err, "Config loads")
+	assert.Equal(t, 100, p.NumAgents, "Number of agents is loaded")
+	assert.Equal(t, 1.5, p.GrowthRate, "Growth rate is loaded")
+	assert.Equal(t, CEIL, p.Strategy, "Strategy is loaded in any case")
+	assert.Equal(t, RETRY_ANY, p.Leftover, "Leftover strategy is loaded")
+	assert.Equal(t, NewParameters().Generations, p.Generations, "Missing fields keep their defaults")
+
+	for _, config := range []string{
+		`{"NumAgent": 100}`,
+		`{"SexRatio": 1.5}`,
+		`{"Strategy": "sideways"}`,
+		`{"Analysis": "NZ"}`,
+		`{"NumAgents": "many"}`,
+	} {
+		_, err := LoadParameters(writeConfig(t, config))
+		assert.NotNil(t, err, "Invalid config is an error: "+config)
+	}
+	_, err = LoadParameters(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err, "Missing config is an error")
+}
@@ -0,0 +1,76 @@
+// Gene diversity over the generations, which drift erodes.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Diversity of the alleles at each locus in a generation, averaged over the
+// loci
+type GeneDiversity struct {
+	Generation int
+	// Number of distinct alleles per locus
+	Alleles float64
+	// Shannon index, -sum p ln p over the allele frequencies p
+	Shannon float64
+	// Expected heterozygosity, 1 - sum p^2, the chance that two alleles
+	// drawn with replacement differ
+	Heterozygosity float64
+}
+
+// Returns the gene diversity of every generation, oldest first. Empty
+// generations, such as those discarded by Parameters.KeepGenerations, have no
+// diversity.
+func (s *Simulation) GeneDiversity() []GeneDiversity {
+	copies := 1
+	if s.params.Diploid {
+		copies = 2
+	}
+	var diversity []GeneDiversity
+	for gen := range s.genBdrys {
+		d := GeneDiversity{Generation: gen}
+		agents := s.Generation(gen)
+		loci := 0
+		if len(agents) > 0 {
+			loci = len(agents[0].genes) / copies
+		}
+		for locus := range loci {
+			counts := make(map[string]int)
+			total := 0
+			for _, agent := range agents {
+				for _, gene := range agent.genes[locus*copies : (locus+1)*copies] {
+					counts[gene]++
+					total++
+				}
+			}
+			d.Alleles += float64(len(counts))
+			homozygosity := 0.0
+			for _, n := range counts {
+				p := float64(n) / float64(total)
+				d.Shannon -= p * math.Log(p)
+				homozygosity += p * p
+			}
+			d.Heterozygosity += 1.0 - homozygosity
+		}
+		if loci > 0 {
+			d.Alleles /= float64(loci)
+			d.Shannon /= float64(loci)
+			d.Heterozygosity /= float64(loci)
+		}
+		diversity = append(diversity, d)
+	}
+	return diversity
+}
+
+// Reports the gene diversity of every generation
+func (s *Simulation) reportGeneDiversity() {
+	for _, d := range s.GeneDiversity() {
+		if s.genStart(d.Generation) == s.genBdrys[d.Generation] {
+			continue
+		}
+		fmt.Fprintf(s.out, "%d, rpt-gene-diversity, generation, %d, alleles, %.2f, shannon, %.4f, heterozygosity, %.4f\n",
+			s.id, d.Generation, d.Alleles, d.Shannon, d.Heterozygosity)
+	}
+}
@@ -0,0 +1,32 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestGeneDiversity(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 30
+	parameters.NumGenes = 5
+	parameters.Generations = 15
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 6
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	diversity := simulation.GeneDiversity()
+	require.Equal(t, 16, len(diversity), "Every generation has a diversity")
+	founders := diversity[0]
+	assert.Equal(t, 30.0, founders.Alleles, "Founders' alleles are all unique")
+	assert.InDelta(t, math.Log(30), founders.Shannon, 1e-9, "Founders have the largest Shannon index")
+	assert.InDelta(t, 1.0-1.0/30, founders.Heterozygosity, 1e-9, "Founders have the largest heterozygosity")
+	for _, d := range diversity[1:] {
+		assert.LessOrEqual(t, d.Shannon, founders.Shannon, "Drift can't raise the Shannon index")
+		assert.LessOrEqual(t, d.Heterozygosity, founders.Heterozygosity, "Drift can't raise heterozygosity")
+	}
+	last := diversity[len(diversity)-1]
+	assert.Less(t, last.Alleles, founders.Alleles, "Drift loses alleles")
+}
@@ -0,0 +1,79 @@
+// Estimating the effective population size from the variance in the number
+// of offspring.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Effective size of a generation estimated from the number of children of
+// each of its agents
+type EffectiveSizeEstimate struct {
+	Generation int
+	// Number of agents in the generation
+	Census int
+	// Mean and population variance of the number of children per agent
+	MeanOffspring     float64
+	OffspringVariance float64
+	Ne                float64
+}
+
+// Estimates the effective size of every generation that has had children,
+// oldest first, with Crow and Denniston's (1988) Ne = (Nk - 1)/(k - 1 + V/k)
+// for N agents having a mean of k children with variance V. In a population
+// of constant size k is 2 and this is the familiar (4N - 2)/(V + 2), which is
+// about N when the number of children is Poisson, as under Wright-Fisher
+// mating, and 2N - 1 when every agent has exactly two children. Ne is NaN for
+// a generation without children.
+func (s *Simulation) EffectiveSizeEstimates() []EffectiveSizeEstimate {
+	var estimates []EffectiveSizeEstimate
+	for gen := 0; gen < len(s.genBdrys)-1; gen++ {
+		agents := s.Generation(gen)
+		e := EffectiveSizeEstimate{Generation: gen, Census: len(agents), Ne: math.NaN()}
+		if len(agents) == 0 {
+			estimates = append(estimates, e)
+			continue
+		}
+		sum, squares := 0.0, 0.0
+		for _, agent := range agents {
+			k := float64(len(agent.children))
+			sum += k
+			squares += k * k
+		}
+		n := float64(len(agents))
+		e.MeanOffspring = sum / n
+		e.OffspringVariance = squares/n - e.MeanOffspring*e.MeanOffspring
+		if e.MeanOffspring > 0.0 {
+			k := e.MeanOffspring
+			e.Ne = (n*k - 1.0) / (k - 1.0 + e.OffspringVariance/k)
+		}
+		estimates = append(estimates, e)
+	}
+	return estimates
+}
+
+// Reports the estimated effective size of every generation that has had
+// children and their harmonic mean, which is the effective size of the whole
+// run
+func (s *Simulation) reportEffectiveSizes() {
+	total, count := 0.0, 0
+	for _, e := range s.EffectiveSizeEstimates() {
+		// Generations discarded by Parameters.KeepGenerations are empty
+		if e.Census == 0 {
+			continue
+		}
+		fmt.Fprintf(s.out, "%d, rpt-effective-size, generation, %d, census, %d, mean-offspring, %.3f, variance, %.3f, ne, %.2f\n",
+			s.id, e.Generation, e.Census, e.MeanOffspring, e.OffspringVariance, e.Ne)
+		if e.Ne > 0.0 {
+			total += 1.0 / e.Ne
+			count++
+		}
+	}
+	harmonic := math.NaN()
+	if count > 0 {
+		harmonic = float64(count) / total
+	}
+	fmt.Fprintf(s.out, "%d, rpt-effective-size, harmonic-mean, %.2f\n", s.id, harmonic)
+}
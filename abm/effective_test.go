@@ -0,0 +1,42 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEffectiveSizeEstimates(t *testing.T) {
+	// Every founder has exactly two children with one partner
+	parameters := NewParameters()
+	parameters.NumAgents = 10
+	simulation := NewSimulation(&parameters)
+	simulation.rng = simulation.substream(1)
+	for father := 0; father < 10; father += 2 {
+		simulation.addChild(father, father+1, 1)
+		simulation.addChild(father, father+1, 1)
+	}
+	simulation.genBdrys = append(simulation.genBdrys, len(simulation.agents))
+	simulation.setCurrGen(1)
+	estimates := simulation.EffectiveSizeEstimates()
+	require.Equal(t, 1, len(estimates), "Only the founders have children")
+	assert.Equal(t, 10, estimates[0].Census, "Census is the number of founders")
+	assert.Equal(t, 2.0, estimates[0].MeanOffspring, "Every founder has two children")
+	assert.Equal(t, 0.0, estimates[0].OffspringVariance, "Offspring numbers don't vary")
+	assert.InDelta(t, 19.0, estimates[0].Ne, 1e-9, "Equal offspring gives 2N - 1")
+
+	// Random mating gives about Poisson offspring numbers
+	parameters = NewParameters()
+	parameters.NumAgents = 400
+	parameters.Generations = 5
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Seed = 13
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	estimates = simulation.EffectiveSizeEstimates()
+	require.Equal(t, 5, len(estimates), "Every generation but the last has children")
+	for _, e := range estimates {
+		assert.InEpsilon(t, float64(e.Census), e.Ne, 0.15, "Random mating gives about the census size")
+	}
+}
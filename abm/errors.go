@@ -0,0 +1,107 @@
+// Errors that stop a simulation or its analysis.
+
+package abm
+
+import (
+	"fmt"
+)
+
+// The ways a simulation or its analysis can fail
+type ErrorKind int
+
+const (
+	// The parameters failed Parameters.Validate
+	InvalidParameters ErrorKind = iota
+	// Fewer than two agents of the current generation survived to mate
+	InsufficientSurvivors
+	// Monogamous mating found no compatible pairs
+	NoMatingPairs
+	// The simulation to analyze has no agents
+	NoAgents
+	// The simulation to analyze has only the founders
+	NoGenerations
+	// The analysis letters or generation to analyze are invalid
+	InvalidAnalysis
+	// The analyses need generations that Parameters.KeepGenerations discarded
+	AncestorsDiscarded
+	// Making the next generation would take the number of agents over
+	// Parameters.MaxPopulation
+	PopulationLimit
+	// Mating needs agents of different sexes but every agent available to
+	// mate has the same sex
+	SexImbalance
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case InvalidParameters:
+		return "invalid parameters"
+	case InsufficientSurvivors:
+		return "insufficient survivors"
+	case NoMatingPairs:
+		return "no mating pairs"
+	case NoAgents:
+		return "no agents"
+	case NoGenerations:
+		return "no generations"
+	case InvalidAnalysis:
+		return "invalid analysis"
+	case AncestorsDiscarded:
+		return "ancestors discarded"
+	case PopulationLimit:
+		return "population limit"
+	case SexImbalance:
+		return "sex imbalance"
+	default:
+		return fmt.Sprintf("unknown error kind %d", int(k))
+	}
+}
+
+// A failure of a simulation or its analysis, which callers can identify with
+// errors.As and its Kind rather than by its message
+type SimError struct {
+	SimID int
+	// The generation being made, or analyzed, when the failure happened
+	Generation int
+	Kind       ErrorKind
+	// The number of agents available to mate, for InsufficientSurvivors,
+	// NoMatingPairs and SexImbalance, or the number there would have been,
+	// for PopulationLimit
+	Agents int
+	// The number of males and females available to mate, for SexImbalance
+	Males, Females int
+	// The underlying error, for InvalidParameters, InvalidAnalysis and
+	// AncestorsDiscarded
+	Err error
+}
+
+func (e *SimError) Error() string {
+	switch e.Kind {
+	case InvalidParameters:
+		return fmt.Sprintf("%d, sim-eng-err, %v", e.SimID, e.Err)
+	case InsufficientSurvivors:
+		return fmt.Sprintf("%d, sim-eng-err, insufficient survivors for generation, %d, %d",
+			e.SimID, e.Agents, e.Generation)
+	case NoMatingPairs:
+		return fmt.Sprintf("%d, sim-eng-err, no mating pairs for generation, %d, agents, %d",
+			e.SimID, e.Generation, e.Agents)
+	case NoAgents:
+		return fmt.Sprintf("%d, analysis-err, no agents in simulation", e.SimID)
+	case NoGenerations:
+		return fmt.Sprintf("%d, analysis-err, only zero generation exists", e.SimID)
+	case PopulationLimit:
+		return fmt.Sprintf("%d, sim-eng-err, population limit exceeded by generation, %d, agents, %d",
+			e.SimID, e.Generation, e.Agents)
+	case SexImbalance:
+		return fmt.Sprintf("%d, sim-eng-err, sex imbalance for generation, %d, agents, %d, males, %d, females, %d",
+			e.SimID, e.Generation, e.Agents, e.Males, e.Females)
+	case InvalidAnalysis, AncestorsDiscarded:
+		return fmt.Sprintf("%d, analysis-err, %v", e.SimID, e.Err)
+	default:
+		return fmt.Sprintf("%d, sim-err, %s, generation, %d", e.SimID, e.Kind, e.Generation)
+	}
+}
+
+func (e *SimError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,421 @@
+// Exporting simulation data for analysis by other tools.
+
+package abm
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Largest number of pairs WriteRawPairs will write, to stop quadratic output
+// from filling the disk
+var MaxRawPairs = 10_000_000
+
+// Writes a CSV header and then one row a,b,common,gendiff for every unordered
+// pair of agents in the given generation, where a and b are global ids (see
+// GlobalID), common is the number of
+// common ancestors of a and b and gendiff is the number of generations back
+// to their nearest common ancestor. Generation 0 means the last generation.
+// Returns an error without writing anything if there are more than
+// MaxRawPairs pairs.
+func (s *Simulation) WriteRawPairs(w io.Writer, generation int) error {
+	if len(s.agents) == 0 {
+		return fmt.Errorf("%d, raw-pairs-err, no agents in simulation", s.id)
+	}
+	lastGen := s.agents[len(s.agents)-1].generation
+	if generation == 0 {
+		generation = lastGen
+	}
+	if generation < 1 || generation > lastGen {
+		return fmt.Errorf("%d, raw-pairs-err, generation %d not in range 1 to %d",
+			s.id, generation, lastGen)
+	}
+	start := s.genBdrys[generation-1]
+	end := s.genBdrys[generation]
+	n := end - start
+	if pairs := n * (n - 1) / 2; pairs > MaxRawPairs {
+		return fmt.Errorf("%d, raw-pairs-err, %d pairs exceeds maximum of %d",
+			s.id, pairs, MaxRawPairs)
+	}
+	s.ensureAncestorsGen(generation)
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"a", "b", "common", "gendiff"}); err != nil {
+		return err
+	}
+	for _, agent := range s.agents[start : end-1] {
+		for j := agent.id + 1; j < end; j++ {
+			common := CountCommonElementsSortedArray(agent.ancestorVec, s.agents[j].ancestorVec)
+			difference := generationDiff(s.agents, &s.agents[j], &s.agents[agent.id])
+			record := []string{
+				s.GlobalID(&agent),
+				s.GlobalID(&s.agents[j]),
+				strconv.Itoa(common),
+				strconv.Itoa(difference),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Returns the number of agents in each generation
+func (s *Simulation) PopulationTrajectory() []int {
+	sizes := make([]int, len(s.genBdrys))
+	for gen := range s.genBdrys {
+		sizes[gen] = s.genBdrys[gen] - s.genStart(gen)
+	}
+	return sizes
+}
+
+// Returns the number of agents in each generation, the sizes analysis P
+// reports the growth of. It is the same as PopulationTrajectory.
+func (s *Simulation) PopulationSizes() []int {
+	return s.PopulationTrajectory()
+}
+
+// Writes a CSV header and then one row generation,size for every generation
+func (s *Simulation) WriteTrajectoryCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"generation", "size"}); err != nil {
+		return err
+	}
+	for gen, size := range s.PopulationTrajectory() {
+		if err := writer.Write([]string{strconv.Itoa(gen), strconv.Itoa(size)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Returns M for males, F for females and U for the other mating types
+func sexLetter(sex Sex) string {
+	switch sex {
+	case MALE:
+		return "M"
+	case FEMALE:
+		return "F"
+	default:
+		return "U"
+	}
+}
+
+// Returns an id for the agent that is unique across simulations with
+// different ids, <simulation id>-<agent id>, for output that may be combined
+// with that of other simulations. Every export names agents with it except
+// WriteJSON, whose agent ids stay indices because LoadSimulation reads them
+// back as such, and which holds the simulation id once for all of them.
+// Report lines start with the simulation id instead.
+func (s *Simulation) GlobalID(a *Agent) string {
+	return strconv.Itoa(s.id) + "-" + strconv.Itoa(a.id)
+}
+
+// Writes a CSV header and then one row per agent, as WriteAgents does with
+// commas between the fields
+func (s *Simulation) WriteAgentsCSV(w io.Writer) error {
+	return s.WriteAgents(w, ',')
+}
+
+// Writes a header and then one row per agent with its global id, generation,
+// sex as M or F, parents' global ids, number of children, number of genes and
+// genes, with the fields separated by delimiter, such as ',' for CSV or '\t'
+// for TSV. The parents of founders are left empty. The genes are separated by
+// semicolons, or by bars if the delimiter is a semicolon, so that they are
+// read back as one field.
+func (s *Simulation) WriteAgents(w io.Writer, delimiter rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	separator := geneSeparator(delimiter)
+	header := []string{"id", "generation", "sex", "mother", "father", "num_children", "num_genes", "genes"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i := range s.agents {
+		agent := &s.agents[i]
+		mother, father := "", ""
+		if !agent.isFounder() {
+			mother, father = s.GlobalID(&s.agents[agent.mother]), s.GlobalID(&s.agents[agent.father])
+		}
+		if err := writer.Write([]string{s.GlobalID(agent), strconv.Itoa(agent.generation),
+			sexLetter(agent.sex), mother, father, strconv.Itoa(len(agent.children)),
+			strconv.Itoa(len(agent.genes)), strings.Join(agent.genes, separator)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Returns the separator of the genes in a field of a row whose fields are
+// separated by delimiter. Genes are made of digits, letters and the marks
+// -, #, : and `, so neither choice can occur in them.
+func geneSeparator(delimiter rune) string {
+	if delimiter == ';' {
+		return "|"
+	}
+	return ";"
+}
+
+// One generation of a population trajectory
+type trajectoryPoint struct {
+	Generation int `json:"generation"`
+	Size       int `json:"size"`
+}
+
+// Writes the population trajectory as a JSON array of generation and size
+// objects
+func (s *Simulation) WriteTrajectoryJSON(w io.Writer) error {
+	sizes := s.PopulationTrajectory()
+	points := make([]trajectoryPoint, len(sizes))
+	for gen, size := range sizes {
+		points[gen] = trajectoryPoint{gen, size}
+	}
+	return json.NewEncoder(w).Encode(points)
+}
+
+// Writes a Graphviz digraph of the given agents, all their ancestors and the
+// edges from parents to children among them. The given agents are drawn as
+// boxes and ancestors shared by more than one of them are filled.
+func (s *Simulation) ExportAncestorSubgraphDOT(agentIDs []int, w io.Writer) error {
+	// Number of the given agents each node is, or is an ancestor of
+	descendants := make(map[int]int)
+	selected := make(map[int]struct{})
+	for _, id := range agentIDs {
+		if id < 0 || id >= len(s.agents) {
+			return fmt.Errorf("%d, ancestor-dot-err, agent %d not in range 0 to %d",
+				s.id, id, len(s.agents)-1)
+		}
+		if _, found := selected[id]; found {
+			continue
+		}
+		selected[id] = struct{}{}
+		if s.agents[id].ancestorSet == nil {
+			setAncestors(s.agents, id, s.storedAncestorDepth())
+		}
+		descendants[id]++
+		for _, ancestor := range s.agents[id].ancestorVec {
+			descendants[ancestor]++
+		}
+	}
+	nodes := make([]int, 0, len(descendants))
+	for id := range descendants {
+		nodes = append(nodes, id)
+	}
+	slices.Sort(nodes)
+	if _, err := fmt.Fprintln(w, "digraph ancestors {"); err != nil {
+		return err
+	}
+	for _, id := range nodes {
+		node := s.GlobalID(&s.agents[id])
+		attrs := fmt.Sprintf("label=\"%s\\ngen %d\"", node, s.agents[id].generation)
+		if _, found := selected[id]; found {
+			attrs += ", shape=box"
+		} else if descendants[id] > 1 {
+			attrs += ", style=filled, fillcolor=gold"
+		}
+		if _, err := fmt.Fprintf(w, "  \"%s\" [%s];\n", node, attrs); err != nil {
+			return err
+		}
+	}
+	for _, id := range nodes {
+		agent := &s.agents[id]
+		if agent.isFounder() {
+			continue
+		}
+		parents := []int{agent.mother}
+		if agent.father != agent.mother {
+			parents = append(parents, agent.father)
+		}
+		for _, parent := range parents {
+			if _, found := descendants[parent]; !found {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "  \"%s\" -> \"%s\";\n",
+				s.GlobalID(&s.agents[parent]), s.GlobalID(agent)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// Writes a Graphviz digraph of the pedigree of the first maxGen generations,
+// or of every generation if maxGen is 0, with males drawn blue and females
+// pink, and an edge from each parent to each of its children
+func (s *Simulation) WriteDOT(w io.Writer, maxGen int) error {
+	end := len(s.agents)
+	if maxGen > 0 && maxGen < len(s.genBdrys) {
+		end = s.genBdrys[maxGen-1]
+	}
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph pedigree {")
+	fmt.Fprintln(out, "  node [style=filled];")
+	for i := range end {
+		color := "lightblue"
+		if s.agents[i].sex == FEMALE {
+			color = "pink"
+		}
+		id := s.GlobalID(&s.agents[i])
+		fmt.Fprintf(out, "  \"%s\" [label=\"%s\\ngen %d\", fillcolor=%s];\n", id, id, s.agents[i].generation, color)
+	}
+	for i := range end {
+		for _, child := range s.agents[i].children {
+			if child < end {
+				fmt.Fprintf(out, "  \"%s\" -> \"%s\";\n", s.GlobalID(&s.agents[i]), s.GlobalID(&s.agents[child]))
+			}
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// An agent in a replay frame, with its position in the unit square if the
+// simulation is spatial, otherwise in a layout in which each generation is a
+// row centred on x = 0
+type frameAgent struct {
+	Id         string  `json:"id"`
+	Generation int     `json:"generation"`
+	Sex        Sex     `json:"sex"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+}
+
+// A link from a parent to a child in a replay frame
+type frameLink struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// The agents added in one generation and the links to their parents
+type replayFrame struct {
+	Generation int          `json:"generation"`
+	Agents     []frameAgent `json:"agents"`
+	Links      []frameLink  `json:"links"`
+}
+
+// Writes one JSON frame per line for each generation, oldest first, holding
+// the agents born in that generation and the links from their parents, so
+// that the growth of the family tree can be animated. Agents are named by
+// their global ids, and placed where they live if the simulation is spatial.
+func (s *Simulation) WriteReplayFrames(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for gen := range s.genBdrys {
+		start, end := s.genStart(gen), s.genBdrys[gen]
+		frame := replayFrame{
+			Generation: gen,
+			Agents:     make([]frameAgent, 0, end-start),
+			Links:      make([]frameLink, 0, 2*(end-start)),
+		}
+		centre := float64(end-start-1) / 2.0
+		for i := range s.agents[start:end] {
+			agent := &s.agents[start+i]
+			id := s.GlobalID(agent)
+			x, y := float64(i)-centre, float64(agent.generation)
+			if s.params.MatingRadius > 0.0 {
+				x, y = agent.Position()
+			}
+			frame.Agents = append(frame.Agents, frameAgent{id, agent.generation, agent.sex, x, y})
+			if agent.isFounder() {
+				continue
+			}
+			frame.Links = append(frame.Links, frameLink{s.GlobalID(&s.agents[agent.mother]), id})
+			if agent.father != agent.mother {
+				frame.Links = append(frame.Links, frameLink{s.GlobalID(&s.agents[agent.father]), id})
+			}
+		}
+		if err := encoder.Encode(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Year the agents of the last generation are born in GEDCOM output, and the
+// number of years between generations
+var (
+	GEDCOMLastYear        = 2000
+	GEDCOMGenerationYears = 25
+)
+
+// Writes the pedigree in GEDCOM 5.5.1 format for genealogy programs: an INDI
+// record for every agent, named after its global id and generation and born
+// GEDCOMGenerationYears after the previous generation, and a FAM record for
+// every distinct mother and father with children. The mother is the WIFE and
+// the father the HUSB whatever their sexes; the father is left out of the
+// families of agents that mated with themselves. Founders have no parents.
+func (s *Simulation) WriteGEDCOM(w io.Writer) error {
+	// Families in order of their first child, and the families each agent
+	// is a parent in
+	type family struct {
+		mother, father int
+		children       []int
+	}
+	var families []family
+	familyOf := make(map[[2]int]int)
+	spouseIn := make([][]int, len(s.agents))
+	for i := range s.agents {
+		agent := &s.agents[i]
+		if agent.isFounder() {
+			continue
+		}
+		key := [2]int{agent.mother, agent.father}
+		f, found := familyOf[key]
+		if !found {
+			f = len(families)
+			familyOf[key] = f
+			families = append(families, family{mother: agent.mother, father: agent.father})
+			spouseIn[agent.mother] = append(spouseIn[agent.mother], f)
+			if agent.father != agent.mother {
+				spouseIn[agent.father] = append(spouseIn[agent.father], f)
+			}
+		}
+		families[f].children = append(families[f].children, i)
+	}
+	// Cross-references are made from global ids, and families are prefixed
+	// with the simulation id, so that files of different simulations can be
+	// merged
+	person := func(i int) string {
+		return "@I" + s.GlobalID(&s.agents[i]) + "@"
+	}
+	familyRef := func(f int) string {
+		return fmt.Sprintf("@F%d-%d@", s.id, f)
+	}
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "0 HEAD\n1 SOUR ANCESTRY\n1 GEDC\n2 VERS 5.5.1\n2 FORM LINEAGE-LINKED\n1 CHAR UTF-8\n")
+	lastGen := s.LastGeneration()
+	for i := range s.agents {
+		agent := &s.agents[i]
+		sex := sexLetter(agent.sex)
+		year := GEDCOMLastYear - GEDCOMGenerationYears*(lastGen-agent.generation)
+		fmt.Fprintf(out, "0 %s INDI\n1 NAME Agent %s /Generation %d/\n1 SEX %s\n1 BIRT\n2 DATE %d\n",
+			person(i), s.GlobalID(agent), agent.generation, sex, year)
+		if !agent.isFounder() {
+			fmt.Fprintf(out, "1 FAMC %s\n", familyRef(familyOf[[2]int{agent.mother, agent.father}]))
+		}
+		for _, f := range spouseIn[i] {
+			fmt.Fprintf(out, "1 FAMS %s\n", familyRef(f))
+		}
+	}
+	for f, fam := range families {
+		fmt.Fprintf(out, "0 %s FAM\n", familyRef(f))
+		if fam.father != fam.mother {
+			fmt.Fprintf(out, "1 HUSB %s\n", person(fam.father))
+		}
+		fmt.Fprintf(out, "1 WIFE %s\n", person(fam.mother))
+		for _, child := range fam.children {
+			fmt.Fprintf(out, "1 CHIL %s\n", person(child))
+		}
+	}
+	fmt.Fprintf(out, "0 TRLR\n")
+	return out.Flush()
+}
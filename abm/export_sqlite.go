@@ -0,0 +1,111 @@
+//go:build sqlite
+
+// Exporting the pedigree to an SQLite database. This is only built with the
+// sqlite build tag, so that the SQLite driver is only a dependency of
+// programs that want it.
+
+package abm
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// Tables the pedigree is exported to. Agents are identified by their global
+// ids, so that the tables of different simulations can be combined. Founders
+// have NULL parents.
+const sqliteSchema = `
+CREATE TABLE agents (
+	id TEXT PRIMARY KEY,
+	generation INTEGER NOT NULL,
+	sex INTEGER NOT NULL,
+	mother TEXT REFERENCES agents(id),
+	father TEXT REFERENCES agents(id)
+);
+CREATE TABLE children (
+	parent TEXT NOT NULL REFERENCES agents(id),
+	child TEXT NOT NULL REFERENCES agents(id)
+);
+CREATE TABLE genes (
+	agent TEXT NOT NULL REFERENCES agents(id),
+	locus INTEGER NOT NULL,
+	allele TEXT NOT NULL
+);
+CREATE INDEX children_parent ON children(parent);
+CREATE INDEX genes_agent ON genes(agent);
+`
+
+// Creates an SQLite database at path holding the agents, their children and
+// their genes in the agents, children and genes tables. The two alleles of a
+// diploid locus are in two rows. The path must not hold a database with these
+// tables already.
+func (s *Simulation) ExportSQLite(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("%d, sqlite-err, %w", s.id, err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("%d, sqlite-err, %w", s.id, err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("%d, sqlite-err, %w", s.id, err)
+	}
+	if err := s.insertPedigree(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%d, sqlite-err, %w", s.id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%d, sqlite-err, %w", s.id, err)
+	}
+	return nil
+}
+
+// Inserts every agent, child link and gene in one transaction
+func (s *Simulation) insertPedigree(tx *sql.Tx) error {
+	agents, err := tx.Prepare("INSERT INTO agents (id, generation, sex, mother, father) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer agents.Close()
+	children, err := tx.Prepare("INSERT INTO children (parent, child) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer children.Close()
+	genes, err := tx.Prepare("INSERT INTO genes (agent, locus, allele) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer genes.Close()
+	ploidy := 1
+	if s.params.Diploid {
+		ploidy = 2
+	}
+	for i := range s.agents {
+		agent := &s.agents[i]
+		id := s.GlobalID(agent)
+		var mother, father sql.NullString
+		if !agent.isFounder() {
+			mother = sql.NullString{String: s.GlobalID(&s.agents[agent.mother]), Valid: true}
+			father = sql.NullString{String: s.GlobalID(&s.agents[agent.father]), Valid: true}
+		}
+		if _, err := agents.Exec(id, agent.generation, int(agent.sex), mother, father); err != nil {
+			return err
+		}
+		for _, child := range agent.children {
+			if _, err := children.Exec(id, s.GlobalID(&s.agents[child])); err != nil {
+				return err
+			}
+		}
+		for j, allele := range agent.genes {
+			if _, err := genes.Exec(id, j/ploidy, allele); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
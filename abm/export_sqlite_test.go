@@ -0,0 +1,43 @@
+//go:build sqlite
+
+package abm
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportSQLite(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 15,
+		NumAgents:    10,
+		Generations:  3,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+		NumGenes:     2,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	path := filepath.Join(t.TempDir(), "pedigree.db")
+	require.Nil(t, simulation.ExportSQLite(path), "Pedigree is exported")
+
+	db, err := sql.Open("sqlite", path)
+	require.Nil(t, err, "Database opens")
+	defer db.Close()
+	var agents, founders, genes int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM agents").Scan(&agents), "Agents are counted")
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM agents WHERE mother IS NULL").Scan(&founders),
+		"Founders are counted")
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM genes").Scan(&genes), "Genes are counted")
+	assert.Equal(t, len(simulation.agents), agents, "Every agent is exported")
+	assert.Equal(t, 10, founders, "Founders have no parents")
+	assert.Equal(t, 2*len(simulation.agents), genes, "Every gene is exported")
+	var mother string
+	require.Nil(t, db.QueryRow("SELECT mother FROM agents WHERE id = '15-10'").Scan(&mother),
+		"Agent is found by its global id")
+	assert.Equal(t, simulation.GlobalID(&simulation.agents[simulation.agents[10].mother]), mother,
+		"Parents are global ids")
+}
@@ -0,0 +1,265 @@
+package abm
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteRawPairs(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 8,
+		NumAgents:    10,
+		Generations:  3,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteRawPairs(&buf, 0), "Raw pairs are written")
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err, "Output is valid CSV")
+	assert.Equal(t, []string{"a", "b", "common", "gendiff"}, records[0], "Header row")
+	assert.Equal(t, 10*9/2, len(records)-1, "One row per unordered pair")
+}
+
+func TestWriteRawPairsTooMany(t *testing.T) {
+	simulation := setupSim(t)
+	saved := MaxRawPairs
+	defer func() { MaxRawPairs = saved }()
+	MaxRawPairs = 9
+	var buf bytes.Buffer
+	assert.NotNil(t, simulation.WriteRawPairs(&buf, 3), "Ten pairs exceeds cap of nine")
+	assert.Equal(t, 0, buf.Len(), "Nothing written when cap exceeded")
+}
+
+func TestPopulationTrajectory(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 9,
+		NumAgents:    4,
+		Generations:  4,
+		GrowthRate:   1.5,
+		Strategy:     CEIL,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	// 4, then 4*1.5, 6*1.5, 9*1.5 rounded up, 14*1.5
+	assert.Equal(t, []int{4, 6, 9, 14, 21}, simulation.PopulationTrajectory(), "Sizes grow by half")
+
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteTrajectoryCSV(&buf), "Trajectory CSV is written")
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err, "Output is valid CSV")
+	assert.Equal(t, [][]string{{"generation", "size"}, {"0", "4"}, {"1", "6"}, {"2", "9"},
+		{"3", "14"}, {"4", "21"}}, records, "One row per generation")
+
+	buf.Reset()
+	require.Nil(t, simulation.WriteTrajectoryJSON(&buf), "Trajectory JSON is written")
+	assert.JSONEq(t, `[{"generation":0,"size":4},{"generation":1,"size":6},{"generation":2,"size":9},
+		{"generation":3,"size":14},{"generation":4,"size":21}]`, buf.String(), "One object per generation")
+}
+
+func TestWriteAgentsCSV(t *testing.T) {
+	simulation := setupSim(t)
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteAgentsCSV(&buf), "Agents CSV is written")
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err, "Output is valid CSV")
+	assert.Equal(t, []string{"id", "generation", "sex", "mother", "father", "num_children", "num_genes",
+		"genes"}, records[0], "Header row")
+	assert.Equal(t, len(simulation.agents)+1, len(records), "One row per agent")
+	assert.Equal(t, "", records[1][3], "Founders have no mother")
+	assert.Equal(t, "", records[1][4], "Founders have no father")
+	agent := &simulation.agents[9]
+	assert.Equal(t, []string{"0-9", strconv.Itoa(agent.generation), "M", "0-" + strconv.Itoa(agent.mother),
+		"0-" + strconv.Itoa(agent.father), strconv.Itoa(len(agent.children)), strconv.Itoa(len(agent.genes)),
+		strings.Join(agent.genes, ";")}, records[10], "Row of a child")
+}
+
+func TestWriteAgentsTSV(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 12
+	parameters.Generations = 2
+	parameters.NumGenes = 3
+	parameters.MutationRate = 0.5
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteAgents(&buf, '\t'), "Agents TSV is written")
+	reader := csv.NewReader(&buf)
+	reader.Comma = '\t'
+	// Every row must have as many columns as the header
+	reader.FieldsPerRecord = 0
+	records, err := reader.ReadAll()
+	require.Nil(t, err, "Output is valid TSV with the same number of columns in every row")
+	assert.Equal(t, len(simulation.agents)+1, len(records), "One row per agent")
+	assert.Len(t, records[0], 8, "Eight columns")
+	for i, agent := range simulation.agents {
+		assert.Equal(t, agent.genes, strings.Split(records[i+1][7], ";"), "Genes of agent %d read back", i)
+	}
+}
+
+func TestGeneSeparator(t *testing.T) {
+	for _, delimiter := range []rune{',', '\t', ';', ' '} {
+		assert.NotContains(t, geneSeparator(delimiter), string(delimiter),
+			"Gene separator differs from the delimiter %q", delimiter)
+	}
+}
+
+func TestGlobalID(t *testing.T) {
+	ids := make(map[string]int)
+	// Individuals and families of the GEDCOM files, and nodes of the DOT
+	// files, of both simulations
+	references := make(map[string]int)
+	records := regexp.MustCompile(`(?m)^0 (@[IF][\d-]+@) (?:INDI|FAM)$`)
+	nodes := regexp.MustCompile(`(?m)^  ("[\d-]+") \[`)
+	for _, id := range []int{1, 11} {
+		parameters := NewParameters()
+		parameters.SimulationId = id
+		parameters.NumAgents = 12
+		parameters.Generations = 2
+		simulation := NewSimulation(&parameters)
+		require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+		for i := range simulation.agents {
+			ids[simulation.GlobalID(&simulation.agents[i])]++
+		}
+		assert.Equal(t, strconv.Itoa(id)+"-1", simulation.GlobalID(&simulation.agents[1]),
+			"Global id is the simulation id and agent id")
+		var gedcom, dot bytes.Buffer
+		require.Nil(t, simulation.WriteGEDCOM(&gedcom), "GEDCOM is written")
+		require.Nil(t, simulation.WriteDOT(&dot, 0), "DOT is written")
+		for _, match := range records.FindAllStringSubmatch(gedcom.String(), -1) {
+			references["gedcom "+match[1]]++
+		}
+		for _, match := range nodes.FindAllStringSubmatch(dot.String(), -1) {
+			references["dot "+match[1]]++
+		}
+	}
+	for id, count := range ids {
+		assert.Equal(t, 1, count, "Global id %s is used by one agent only", id)
+	}
+	assert.Greater(t, len(references), 2*len(ids), "Every agent and family is exported")
+	for reference, count := range references {
+		assert.Equal(t, 1, count, "%s is used by one simulation only", reference)
+	}
+}
+
+func TestExportAncestorSubgraphDOT(t *testing.T) {
+	simulation := setupSim(t)
+	var buf bytes.Buffer
+	require.Nil(t, simulation.ExportAncestorSubgraphDOT([]int{9, 11}, &buf), "Subgraph is written")
+	nodes := regexp.MustCompile(`(?m)^  "([\d-]+)" \[(.*)\];$`).FindAllStringSubmatch(buf.String(), -1)
+	var ids []string
+	shared := make(map[string]bool)
+	for _, node := range nodes {
+		ids = append(ids, node[1])
+		shared[node[1]] = strings.Contains(node[2], "filled")
+	}
+	// Agents 9 and 11 and the union of their ancestors
+	assert.Equal(t, []string{"0-0", "0-1", "0-3", "0-4", "0-5", "0-6", "0-7", "0-8", "0-9", "0-11"}, ids,
+		"Node set")
+	assert.True(t, shared["0-3"], "Shared grandparent is highlighted")
+	assert.False(t, shared["0-5"], "Parent of only one agent is not highlighted")
+	assert.Contains(t, buf.String(), "  \"0-5\" -> \"0-9\";\n", "Edge from parent to child")
+	assert.NotContains(t, buf.String(), "-> \"0-10\";", "No edges to agents outside the subgraph")
+	assert.NotNil(t, simulation.ExportAncestorSubgraphDOT([]int{14}, &buf), "Agent out of range")
+}
+
+func TestWriteDOT(t *testing.T) {
+	simulation := setupSim(t)
+	edges := 0
+	for _, agent := range simulation.agents {
+		edges += len(agent.children)
+	}
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteDOT(&buf, 0), "Pedigree DOT is written")
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph pedigree {"), "Output is a digraph")
+	assert.Equal(t, edges, strings.Count(dot, "->"), "One edge per child of each agent")
+	assert.Equal(t, len(simulation.agents), strings.Count(dot, "fillcolor="), "One node per agent")
+	assert.NotRegexp(t, regexp.MustCompile(`-> "0-[01]";`), dot, "Founders have no incoming edges")
+
+	buf.Reset()
+	require.Nil(t, simulation.WriteDOT(&buf, 2), "Capped pedigree DOT is written")
+	assert.Equal(t, simulation.genBdrys[1], strings.Count(buf.String(), "fillcolor="),
+		"Only the first two generations are drawn")
+	assert.Equal(t, 6, strings.Count(buf.String(), "->"), "Edges from the founders to their children")
+}
+
+func TestWriteReplayFrames(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 11,
+		NumAgents:    6,
+		Generations:  4,
+		GrowthRate:   1.3,
+		Strategy:     CEIL,
+		Compatible:   true,
+		MateSameSex:  true,
+		MateSibling:  true,
+		MatingK:      50,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	frames := replayFrames(t, simulation)
+	require.Equal(t, len(simulation.genBdrys), len(frames), "One frame per generation")
+	for gen, frame := range frames {
+		assert.Equal(t, gen, frame.Generation, "Frames in generation order")
+		assert.Equal(t, simulation.genBdrys[gen]-simulation.genStart(gen), len(frame.Agents),
+			"Frame has the agents born in its generation")
+	}
+	assert.Equal(t, 0, len(frames[0].Links), "Founders have no parent links")
+	assert.Equal(t, 2*len(frames[1].Agents), len(frames[1].Links), "Every child links to two parents")
+	assert.Equal(t, "11-0", frames[0].Agents[0].Id, "Agents are named by their global ids")
+	assert.Equal(t, frames[1].Agents[0].Id, frames[1].Links[0].Child, "Links name the child by its global id")
+	assert.Equal(t, float64(1), frames[1].Agents[0].Y, "Generations are rows")
+
+	parameters.MatingRadius = 0.5
+	spatial := NewSimulation(&parameters)
+	require.Nil(t, spatial.Simulate(), "Spatial simulation succeeds")
+	for _, frame := range replayFrames(t, spatial) {
+		for i, agent := range frame.Agents {
+			x, y := spatial.agents[spatial.genStart(frame.Generation)+i].Position()
+			assert.Equal(t, [2]float64{x, y}, [2]float64{agent.X, agent.Y},
+				"Spatial agents are placed where they live")
+		}
+	}
+}
+
+// Writes the replay frames of a simulation and reads them back
+func replayFrames(t *testing.T, simulation *Simulation) []replayFrame {
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteReplayFrames(&buf), "Frames are written")
+	decoder := json.NewDecoder(&buf)
+	var frames []replayFrame
+	for decoder.More() {
+		var frame replayFrame
+		require.Nil(t, decoder.Decode(&frame), "Frame is valid JSON")
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestWriteGEDCOM(t *testing.T) {
+	simulation := setupSim(t)
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteGEDCOM(&buf), "GEDCOM written")
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "0 HEAD\n"), "Starts with header")
+	assert.True(t, strings.HasSuffix(out, "0 TRLR\n"), "Ends with trailer")
+	assert.Contains(t, out, "2 VERS 5.5.1\n", "GEDCOM version")
+	assert.Equal(t, 14, strings.Count(out, " INDI\n"), "One individual per agent")
+	assert.Equal(t, 4, strings.Count(out, " FAM\n"), "One family per distinct couple")
+	assert.Contains(t, out, "0 @I0-0@ INDI\n1 NAME Agent 0-0 /Generation 0/\n1 SEX M\n1 BIRT\n2 DATE 1925\n"+
+		"1 FAMS @F0-0@\n0 @I0-1@", "Founder has no parents")
+	assert.Contains(t, out, "0 @I0-9@ INDI\n1 NAME Agent 0-9 /Generation 3/\n1 SEX M\n1 BIRT\n2 DATE 2000\n"+
+		"1 FAMC @F0-2@\n0 @I0-10@", "Child links to its parents' family")
+	assert.Contains(t, out, "0 @F0-1@ FAM\n1 HUSB @I0-4@\n1 WIFE @I0-3@\n1 CHIL @I0-5@\n1 CHIL @I0-6@\n"+
+		"1 CHIL @I0-7@\n1 CHIL @I0-8@\n", "Family of parents and children")
+}
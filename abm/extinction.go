@@ -0,0 +1,56 @@
+// Extinction of the founders' lineages over the generations, which shows the
+// coalescent process forwards in time.
+
+package abm
+
+import (
+	"fmt"
+)
+
+// Number of founder lineages that reach a generation
+type LineageSurvival struct {
+	Generation int
+	// Founders with at least one descendant in the generation
+	Surviving int
+	// Founders without any
+	Extinct int
+}
+
+// Returns, for every generation, the number of founders in generation 0 that
+// have at least one descendant in it, found with Descendants. A lineage
+// without descendants in the last generation has gone extinct. Every founder
+// survives in generation 0, where it is its own lineage.
+func (s *Simulation) LineageSurvival() []LineageSurvival {
+	if len(s.genBdrys) == 0 {
+		return nil
+	}
+	founders := s.genBdrys[0]
+	survival := make([]LineageSurvival, len(s.genBdrys))
+	for gen := range survival {
+		survival[gen].Generation = gen
+	}
+	survival[0].Surviving = founders
+	for founder := range founders {
+		reached := make([]bool, len(s.genBdrys))
+		for _, id := range s.Descendants(founder) {
+			reached[s.agents[id].generation] = true
+		}
+		for gen := 1; gen < len(reached); gen++ {
+			if reached[gen] {
+				survival[gen].Surviving++
+			}
+		}
+	}
+	for gen := range survival {
+		survival[gen].Extinct = founders - survival[gen].Surviving
+	}
+	return survival
+}
+
+// Reports the number of founder lineages surviving in each generation
+func (s *Simulation) reportLineageExtinction() {
+	for _, l := range s.LineageSurvival() {
+		fmt.Fprintf(s.out, "%d, rpt-lineage-extinction, generation, %d, surviving, %d, extinct, %d\n",
+			s.id, l.Generation, l.Surviving, l.Extinct)
+	}
+}
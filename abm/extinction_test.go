@@ -0,0 +1,31 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLineageSurvival(t *testing.T) {
+	// Founder 2's only child has no children, so its lineage is extinct in
+	// the last generation
+	agents := []Agent{
+		{id: 0, generation: 0, sex: MALE, children: []int{3, 4, 5}},
+		{id: 1, generation: 0, sex: FEMALE, children: []int{3, 4}},
+		{id: 2, generation: 0, sex: FEMALE, children: []int{5}},
+		{id: 3, generation: 1, sex: FEMALE, mother: 1, father: 0, children: []int{6}},
+		{id: 4, generation: 1, sex: MALE, mother: 1, father: 0, children: []int{6}},
+		{id: 5, generation: 1, sex: MALE, mother: 2, father: 0},
+		{id: 6, generation: 2, sex: FEMALE, mother: 3, father: 4},
+	}
+	parameters := NewParameters()
+	simulation := NewSimulation(&parameters)
+	simulation.agents = agents
+	simulation.SetGenBdrys()
+	survival := simulation.LineageSurvival()
+	require.Len(t, survival, 3, "One count per generation")
+	assert.Equal(t, LineageSurvival{Generation: 0, Surviving: 3}, survival[0], "Every founder survives in generation 0")
+	assert.Equal(t, LineageSurvival{Generation: 1, Surviving: 3}, survival[1], "Every founder has a child")
+	assert.Equal(t, LineageSurvival{Generation: 2, Surviving: 2, Extinct: 1}, survival[2],
+		"Founder 2's lineage is extinct")
+}
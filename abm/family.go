@@ -0,0 +1,104 @@
+// Founders divided into families that share alleles, so that the population
+// starts with structure, and how much of it is left in the last generation.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Returns the family of a founder, 0 for all of them without founder families
+func (p *Parameters) founderFamily(id int) int {
+	if p.FounderFamilies <= 1 {
+		return 0
+	}
+	return id % p.FounderFamilies
+}
+
+// Returns the number of loci, counted from the first, at which the founders
+// of a family share alleles
+func familyLoci(numGenes int) int {
+	return (numGenes + 1) / 2
+}
+
+// Mean number of genes shared by pairs of agents of the same family and of
+// different families
+type FamilySharing struct {
+	Generation int
+	// Number of pairs compared
+	WithinPairs  int
+	BetweenPairs int
+	// Mean genes shared by the pairs, NaN if there are none
+	Within  float64
+	Between float64
+}
+
+// Returns the family of an agent, the founder family most of its genes come
+// from, the lowest on ties
+func (s *Simulation) agentFamily(agent *Agent) (int, error) {
+	counts := make([]int, max(s.params.FounderFamilies, 1))
+	for _, gene := range agent.genes {
+		founder, err := geneOrigin(gene)
+		if err != nil {
+			return 0, fmt.Errorf("%d, family-err, invalid gene %s", s.id, gene)
+		}
+		counts[s.params.founderFamily(founder)]++
+	}
+	return slices.Index(counts, slices.Max(counts)), nil
+}
+
+// Compares the genes shared by every pair of agents in the last generation
+// that belong to the same founder family with those shared by pairs from
+// different families. An agent belongs to the family most of its genes come
+// from. Without founder families every pair is within the one family.
+func (s *Simulation) FamilySharing() (FamilySharing, error) {
+	sharing := FamilySharing{Generation: s.LastGeneration(), Within: math.NaN(), Between: math.NaN()}
+	if sharing.Generation < 0 {
+		return sharing, nil
+	}
+	agents := s.Generation(sharing.Generation)
+	families := make([]int, len(agents))
+	genes := make([][]string, len(agents))
+	for i := range agents {
+		family, err := s.agentFamily(&agents[i])
+		if err != nil {
+			return sharing, err
+		}
+		families[i] = family
+		genes[i] = slices.Sorted(slices.Values(agents[i].genes))
+	}
+	within, between := 0, 0
+	for i := range agents {
+		for j := i + 1; j < len(agents); j++ {
+			shared := CountCommonElementsSortedArray(genes[i], genes[j])
+			if families[i] == families[j] {
+				within += shared
+				sharing.WithinPairs++
+			} else {
+				between += shared
+				sharing.BetweenPairs++
+			}
+		}
+	}
+	if sharing.WithinPairs > 0 {
+		sharing.Within = float64(within) / float64(sharing.WithinPairs)
+	}
+	if sharing.BetweenPairs > 0 {
+		sharing.Between = float64(between) / float64(sharing.BetweenPairs)
+	}
+	return sharing, nil
+}
+
+// Reports the genes shared within and between founder families in the last
+// generation
+func (s *Simulation) reportFamilySharing() {
+	f, err := s.FamilySharing()
+	if err != nil {
+		fmt.Fprintf(s.errOut, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "%d, rpt-family-sharing, generation, %d, families, %d, within-pairs, %d, within, %.3f, between-pairs, %d, between, %.3f\n",
+		s.id, f.Generation, max(s.params.FounderFamilies, 1), f.WithinPairs, f.Within, f.BetweenPairs, f.Between)
+}
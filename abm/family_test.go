@@ -0,0 +1,47 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+)
+
+func TestFounderFamilies(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 12
+	parameters.NumGenes = 6
+	parameters.FounderFamilies = 3
+	parameters.Diploid = true
+	simulation := NewSimulation(&parameters)
+	genes := func(id int) []string {
+		return slices.Sorted(slices.Values(simulation.agents[id].genes))
+	}
+	for a := range 12 {
+		for b := a + 1; b < 12; b++ {
+			shared := CountCommonElementsSortedArray(genes(a), genes(b))
+			if a%3 == b%3 {
+				assert.GreaterOrEqual(t, shared, 1, "Founders %d and %d of the same family share a gene", a, b)
+				assert.Equal(t, 6, shared, "Both alleles of the first three loci are shared")
+			} else {
+				assert.Zero(t, shared, "Founders %d and %d of different families share no genes", a, b)
+			}
+		}
+	}
+	assert.Equal(t, simulation.agents[0].genes[:6], simulation.agents[9].genes[:6], "Shared alleles are the first founder's")
+	assert.Equal(t, "9-3a", simulation.agents[9].genes[6], "Other loci are the founder's own")
+
+	parameters.NumAgents = 40
+	parameters.Generations = 3
+	parameters.NumGenes = 10
+	parameters.FounderFamilies = 4
+	parameters.Diploid = false
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	sharing, err := simulation.FamilySharing()
+	require.Nil(t, err, "Sharing is computed")
+	assert.Equal(t, 3, sharing.Generation, "Last generation is compared")
+	assert.Positive(t, sharing.WithinPairs, "Some pairs are in the same family")
+	assert.Positive(t, sharing.BetweenPairs, "Some pairs are in different families")
+	assert.Greater(t, sharing.Within, sharing.Between, "Families share more genes within than between them")
+}
@@ -0,0 +1,90 @@
+// Reproduction weighted by fitness.
+
+package abm
+
+import (
+	"sort"
+	"strings"
+)
+
+// Returns the fitness of an agent. Parameters.FitnessFunc gives it if it is
+// set, otherwise agents carrying a mutated allele of Parameters.FitnessGene
+// have fitness 1 + FitnessAdvantage and the rest 1.
+func (s *Simulation) fitness(a *Agent) float64 {
+	if s.params.FitnessFunc != nil {
+		return s.params.FitnessFunc(a.genes)
+	}
+	if s.params.FitnessAdvantage != 0.0 && s.carriesMutation(a, s.params.FitnessGene) {
+		return 1.0 + s.params.FitnessAdvantage
+	}
+	return 1.0
+}
+
+// Returns whether agents differ in fitness
+func (s *Simulation) hasFitness() bool {
+	return s.params.FitnessFunc != nil || s.params.FitnessAdvantage != 0.0
+}
+
+// Returns whether either of the agent's alleles at the locus, or its only
+// allele if it is haploid, has a backtick mutation
+func (s *Simulation) carriesMutation(a *Agent, locus int) bool {
+	alleles := a.genes[locus : locus+1]
+	if s.params.Diploid {
+		alleles = a.genes[2*locus : 2*locus+2]
+	}
+	for _, allele := range alleles {
+		if strings.Contains(allele, "`") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the cumulative fitness of the agents in the current generation, or
+// nil if they are all equally fit
+func (s *Simulation) currGenWeights() []float64 {
+	if !s.hasFitness() {
+		return nil
+	}
+	weights := make([]float64, len(s.currGen))
+	for i, selected := range s.currGen {
+		weights[i] = s.fitness(&s.agents[selected.id])
+	}
+	return cumulativeWeights(weights)
+}
+
+// Picks an agent of the current generation in proportion to the cumulative
+// weights, or uniformly if they are nil
+func (s *Simulation) randomCurrGen(cumulative []float64) int {
+	if cumulative != nil {
+		return s.currGen[weightedIndex(s.rng, cumulative)].id
+	}
+	return s.currGen[s.rng.Intn(len(s.currGen))].id
+}
+
+// Returns the fitness of a mating pair, the mean fitness of its parents
+func (s *Simulation) pairFitness(pair matingPair) float64 {
+	return 0.5 * (s.fitness(&s.agents[pair.male]) + s.fitness(&s.agents[pair.female]))
+}
+
+// Returns the running totals of the weights. Negative weights count as 0.
+func cumulativeWeights(weights []float64) []float64 {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, w := range weights {
+		total += max(w, 0.0)
+		cumulative[i] = total
+	}
+	return cumulative
+}
+
+// Draws an index with probability proportional to its weight, given the
+// cumulative weights. If every weight is 0 each index is equally likely.
+func weightedIndex(rng Rng, cumulative []float64) int {
+	total := cumulative[len(cumulative)-1]
+	if total <= 0.0 {
+		return rng.Intn(len(cumulative))
+	}
+	x := rng.Float64() * total
+	return sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > x })
+}
@@ -0,0 +1,91 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMonogamousFitness(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 10,
+		NumAgents:    4,
+		Generations:  1,
+		GrowthRate:   250.0,
+		Strategy:     CEIL,
+		Monogamous:   true,
+		MatingK:      50,
+		NumGenes:     1,
+		Seed:         6,
+		// Agent 0's gene makes it ten times as fit
+		FitnessFunc: func(genes []string) float64 {
+			if slices.Contains(genes, "0-0") {
+				return 10.0
+			}
+			return 1.0
+		},
+	}
+	simulation := NewSimulation(&parameters)
+	simulation.agents[0].sex = MALE
+	simulation.agents[1].sex = MALE
+	simulation.agents[2].sex = FEMALE
+	simulation.agents[3].sex = FEMALE
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	children := len(simulation.agents) - 4
+	require.Equal(t, 1000, children, "All children are born")
+	// The pair with agent 0 has fitness 5.5 and the other pair 1
+	assert.InDelta(t, 5.5/6.5, float64(len(simulation.agents[0].children))/float64(children), 0.05,
+		"Fitter pair has proportionately more children")
+}
+
+func TestWeightedIndex(t *testing.T) {
+	simulation := NewSimulation(&Parameters{Seed: 1})
+	cumulative := cumulativeWeights([]float64{0.0, 3.0, -1.0, 1.0})
+	counts := make([]int, 4)
+	for range 10000 {
+		counts[weightedIndex(simulation.rng, cumulative)]++
+	}
+	assert.Equal(t, 0, counts[0], "Zero weight is never drawn")
+	assert.Equal(t, 0, counts[2], "Negative weight is never drawn")
+	assert.InDelta(t, 7500, counts[1], 300, "Drawn in proportion to weight")
+}
+
+// Returns the fraction of the genes of a generation with a backtick mutation
+func mutatedFrequency(t *testing.T, s *Simulation, gen int) float64 {
+	r, err := s.analyzeGenes(s.Generation(gen))
+	require.Nil(t, err, "Genes are analyzed")
+	mutated, total := 0, 0
+	for gene, count := range r.GeneCounts {
+		if strings.Contains(gene, "`") {
+			mutated += count
+		}
+		total += count
+	}
+	return float64(mutated) / float64(total)
+}
+
+func TestGeneFitness(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 100
+	parameters.Generations = 10
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.NumGenes = 2
+	parameters.Seed = 4
+	parameters.FitnessGene = 1
+	parameters.FitnessAdvantage = 4.0
+	simulation := NewSimulation(&parameters)
+	for i := range 10 {
+		simulation.agents[i].genes[1] += "`"
+	}
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	before := mutatedFrequency(t, simulation, 0)
+	after := mutatedFrequency(t, simulation, simulation.LastGeneration())
+	assert.InDelta(t, 0.05, before, 1e-9, "Tenth of the founders carry the mutated allele")
+	assert.Greater(t, after, 0.3, "Fitter allele spreads")
+
+	parameters.FitnessGene = 2
+	assert.NotNil(t, parameters.Validate(), "Fitness gene must be one of the genes")
+}
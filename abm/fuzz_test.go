@@ -0,0 +1,187 @@
+package abm
+
+import (
+	"slices"
+	"testing"
+)
+
+// The pedigree of setupSim encoded for pedigreeFromBytes
+var setupSimPedigree = []byte{
+	1,
+	2, 0, 1, 0, 1, 0, 1,
+	3, 1, 2, 1, 2, 1, 2, 1, 2,
+	4, 0, 2, 0, 2, 3, 1, 3, 1, 3, 1,
+}
+
+// Builds a valid pedigree from fuzzer input. The first byte is one less than
+// the number of founders, then each generation is one less than its number of
+// agents followed by the mother and father of each agent as indices into the
+// previous generation.
+// Input that runs out ends the pedigree.
+func pedigreeFromBytes(data []byte) *Simulation {
+	next := func() (int, bool) {
+		if len(data) == 0 {
+			return 0, false
+		}
+		b := int(data[0])
+		data = data[1:]
+		return b, true
+	}
+	parameters := NewParameters()
+	s := NewSimulation(&parameters)
+	s.agents = nil
+	founders, _ := next()
+	for i := range founders%8 + 1 {
+		s.agents = append(s.agents, Agent{id: i, sex: Sex(i % 2), founder: true})
+	}
+	prevStart, prevEnd := 0, len(s.agents)
+	for generation := 1; generation <= 8; generation++ {
+		size, ok := next()
+		if !ok {
+			break
+		}
+		for i := range size%8 + 1 {
+			mother, ok1 := next()
+			father, ok2 := next()
+			if !ok1 || !ok2 {
+				break
+			}
+			id := len(s.agents)
+			mother = prevStart + mother%(prevEnd-prevStart)
+			father = prevStart + father%(prevEnd-prevStart)
+			s.agents = append(s.agents, Agent{id: id, generation: generation, sex: Sex(i % 2),
+				mother: mother, father: father})
+			s.agents[mother].children = append(s.agents[mother].children, id)
+			if father != mother {
+				s.agents[father].children = append(s.agents[father].children, id)
+			}
+		}
+		if len(s.agents) == prevEnd {
+			break
+		}
+		prevStart, prevEnd = prevEnd, len(s.agents)
+	}
+	s.SetGenBdrys()
+	s.setCurrGen(len(s.genBdrys) - 1)
+	return s
+}
+
+func TestPedigreeFromBytes(t *testing.T) {
+	want := setupSim(t)
+	got := pedigreeFromBytes(setupSimPedigree)
+	if len(got.agents) != len(want.agents) {
+		t.Fatalf("%d agents, want %d", len(got.agents), len(want.agents))
+	}
+	for i := range want.agents {
+		g, w := &got.agents[i], &want.agents[i]
+		if g.generation != w.generation || (!w.isFounder() && (g.mother != w.mother || g.father != w.father)) {
+			t.Errorf("agent %d: generation %d parents %d and %d, want generation %d parents %d and %d",
+				i, g.generation, g.mother, g.father, w.generation, w.mother, w.father)
+		}
+	}
+}
+
+func FuzzSetAncestors(f *testing.F) {
+	f.Add(setupSimPedigree, uint8(0))
+	f.Add(setupSimPedigree, uint8(1))
+	f.Add(setupSimPedigree, uint8(2))
+	f.Add([]byte{0, 0, 0, 0}, uint8(0))
+	f.Fuzz(func(t *testing.T, data []byte, maxDepth uint8) {
+		s := pedigreeFromBytes(data)
+		if err := s.CheckInvariants(); err != nil {
+			t.Fatalf("generated pedigree: %v", err)
+		}
+		depth := int(maxDepth % 10)
+		for i := range s.agents {
+			setAncestors(s.agents, i, depth)
+		}
+		if err := s.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+		for i := range s.agents {
+			agent := &s.agents[i]
+			for _, ancestor := range agent.ancestorVec {
+				if diff := agent.generation - s.agents[ancestor].generation; diff < 1 ||
+					(depth > 0 && diff > depth) {
+					t.Fatalf("agent %d: ancestor %d is %d generations back with depth %d",
+						i, ancestor, diff, depth)
+				}
+			}
+			if !agent.isFounder() &&
+				(!slices.Contains(agent.ancestorVec, agent.mother) || !slices.Contains(agent.ancestorVec, agent.father)) {
+				t.Fatalf("agent %d: parents missing from ancestors %v", i, agent.ancestorVec)
+			}
+		}
+	})
+}
+
+func FuzzGenerationDiff(f *testing.F) {
+	f.Add(setupSimPedigree, uint8(0), uint8(4))
+	f.Add(setupSimPedigree, uint8(1), uint8(3))
+	f.Add(setupSimPedigree, uint8(2), uint8(2))
+	f.Add([]byte{1, 1, 0, 1, 0, 0}, uint8(0), uint8(1))
+	f.Fuzz(func(t *testing.T, data []byte, x, y uint8) {
+		s := pedigreeFromBytes(data)
+		gen := len(s.genBdrys) - 1
+		start, end := s.genStart(gen), s.genBdrys[gen]
+		s.setAncestorsGen(gen)
+		a := &s.agents[start+int(x)%(end-start)]
+		b := &s.agents[start+int(y)%(end-start)]
+		diff := generationDiff(s.agents, a, b)
+		if diff < 0 || diff > a.generation {
+			t.Fatalf("agents %d and %d: generation difference %d out of range 0 to %d",
+				a.id, b.id, diff, a.generation)
+		}
+		if other := generationDiff(s.agents, b, a); other != diff {
+			t.Fatalf("agents %d and %d: generation difference %d one way but %d the other",
+				a.id, b.id, diff, other)
+		}
+		if ancestor, found := mrca(a, b); found {
+			if _, inA := a.ancestorSet[ancestor]; !inA {
+				t.Fatalf("most recent common ancestor %d not an ancestor of %d", ancestor, a.id)
+			}
+			if _, inB := b.ancestorSet[ancestor]; !inB {
+				t.Fatalf("most recent common ancestor %d not an ancestor of %d", ancestor, b.id)
+			}
+		}
+	})
+}
+
+// Returns the bytes as a sorted slice of ints
+func sortedInts(data []byte) []int {
+	v := make([]int, len(data))
+	for i, b := range data {
+		v[i] = int(b)
+	}
+	slices.Sort(v)
+	return v
+}
+
+func FuzzCountCommonElements(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 5}, []byte{0, 2, 4})
+	f.Add([]byte{24, 25, 26, 27, 31, 32, 36, 40, 52, 58, 59, 60, 66, 68, 109},
+		[]byte{24, 25, 26, 27, 31, 32, 36, 40, 52, 58, 59, 60, 66, 68, 109})
+	f.Add([]byte{2, 2}, []byte{1, 2})
+	f.Add([]byte{1, 2, 3}, []byte{2, 3, 4})
+	f.Add([]byte{2, 2, 3}, []byte{2, 2, 2})
+	f.Add([]byte{}, []byte{1})
+	f.Fuzz(func(t *testing.T, x, y []byte) {
+		a, b := sortedInts(x), sortedInts(y)
+		count := CountCommonElementsSortedArray(a, b)
+		if count > min(len(a), len(b)) {
+			t.Fatalf("%v and %v: %d in common, more than the shorter has", a, b, count)
+		}
+		if other := CountCommonElementsSortedArray(b, a); other != count {
+			t.Fatalf("%v and %v: %d in common one way but %d the other", a, b, count, other)
+		}
+		if multiset := CountCommonMultiset(x, y); multiset != count {
+			t.Fatalf("%v and %v: sorted count %d but multiset count %d", a, b, count, multiset)
+		}
+		if set := CountCommonSet(x, y); set > count {
+			t.Fatalf("%v and %v: set count %d more than multiset count %d", a, b, set, count)
+		}
+		if distinct, set := CountDistinctCommonElementsSortedArray(a, b), CountCommonSet(x, y); distinct != set {
+			t.Fatalf("%v and %v: sorted distinct count %d but set count %d", a, b, distinct, set)
+		}
+	})
+}
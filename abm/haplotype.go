@@ -0,0 +1,99 @@
+// Uniparental markers, which follow a single line of descent and so show the
+// coalescence of paternal and maternal lines without the mixing of
+// recombination.
+
+package abm
+
+import (
+	"fmt"
+)
+
+// Appends a nucleotide sequence to the haplotypes of each agent, which must
+// all be founders, from a stream of their own so that the founders' genes
+// don't change
+func (s *Simulation) addHaplotypeSequences(rng Rng) {
+	for i := range s.agents {
+		agent := &s.agents[i]
+		if agent.yHaplotype != "" {
+			agent.yHaplotype += ":" + randomSequence(rng, s.params.GeneLength)
+		}
+		if agent.mtHaplotype != "" {
+			agent.mtHaplotype += ":" + randomSequence(rng, s.params.GeneLength)
+		}
+	}
+}
+
+// Mutates each of a child's haplotypes with probability
+// Parameters.HaplotypeMutationRate, using the simulation's mutation model
+func (s *Simulation) mutateHaplotypes(a *Agent) {
+	if a.yHaplotype != "" && s.rng.Float64() < s.params.HaplotypeMutationRate {
+		a.yHaplotype = s.mutate(a.yHaplotype)
+	}
+	if a.mtHaplotype != "" && s.rng.Float64() < s.params.HaplotypeMutationRate {
+		a.mtHaplotype = s.mutate(a.mtHaplotype)
+	}
+}
+
+// Returns the number of males in the given generation carrying each Y
+// haplotype. Males whose parents are both female, which is possible when
+// compatibility isn't checked, have none and aren't counted.
+func (s *Simulation) YHaplotypes(gen int) map[string]int {
+	counts := make(map[string]int)
+	for _, agent := range s.Generation(gen) {
+		if agent.sex == MALE && agent.yHaplotype != "" {
+			counts[agent.yHaplotype]++
+		}
+	}
+	return counts
+}
+
+// Reports the number of distinct Y haplotypes that survive among the males of
+// the last generation, out of the number of male founders
+func (s *Simulation) reportYHaplotypes() {
+	founders := 0
+	for _, agent := range s.agents[:s.genBdrys[0]] {
+		if agent.sex == MALE {
+			founders++
+		}
+	}
+	last := s.LastGeneration()
+	counts := s.YHaplotypes(last)
+	males := 0
+	for _, n := range counts {
+		males += n
+	}
+	fmt.Fprintf(s.out, "%d, rpt-y-haplotypes, generation, %d, males, %d, distinct, %d, male-founders, %d\n",
+		s.id, last, males, len(counts), founders)
+}
+
+// Returns the number of agents in the given generation carrying each
+// mitochondrial haplotype. Agents whose parents are both male, which is
+// possible when compatibility isn't checked, have none and aren't counted.
+func (s *Simulation) MtHaplotypes(gen int) map[string]int {
+	counts := make(map[string]int)
+	for _, agent := range s.Generation(gen) {
+		if agent.mtHaplotype != "" {
+			counts[agent.mtHaplotype]++
+		}
+	}
+	return counts
+}
+
+// Reports the number of distinct maternal lineages that survive in the last
+// generation, out of the number of female founders
+func (s *Simulation) reportMtHaplotypes() {
+	founders := 0
+	for _, agent := range s.agents[:s.genBdrys[0]] {
+		if agent.sex == FEMALE {
+			founders++
+		}
+	}
+	last := s.LastGeneration()
+	counts := s.MtHaplotypes(last)
+	carriers := 0
+	for _, n := range counts {
+		carriers += n
+	}
+	fmt.Fprintf(s.out, "%d, rpt-mt-haplotypes, generation, %d, agents, %d, distinct, %d, female-founders, %d\n",
+		s.id, last, carriers, len(counts), founders)
+}
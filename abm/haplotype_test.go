@@ -0,0 +1,87 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestYHaplotypes(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 40
+	parameters.Generations = 10
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Compatible = true
+	parameters.Seed = 3
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, agent := range simulation.agents {
+		switch {
+		case agent.sex == FEMALE:
+			assert.Equal(t, "", agent.yHaplotype, "Females have no Y haplotype")
+		case agent.isFounder():
+			assert.Equal(t, strconv.Itoa(agent.id)+"-Y", agent.yHaplotype, "Male founders have their own")
+		default:
+			father := &simulation.agents[agent.father]
+			if father.sex == FEMALE {
+				father = &simulation.agents[agent.mother]
+			}
+			assert.Equal(t, MALE, father.sex, "Compatible parents include a male")
+			assert.Equal(t, father.yHaplotype, agent.yHaplotype, "Sons inherit their father's")
+		}
+	}
+	distinct := len(simulation.YHaplotypes(0))
+	for gen := 1; gen <= simulation.LastGeneration(); gen++ {
+		next := len(simulation.YHaplotypes(gen))
+		assert.LessOrEqual(t, next, distinct, "Paternal lines are never gained")
+		distinct = next
+	}
+	assert.Less(t, distinct, len(simulation.YHaplotypes(0)), "Paternal lines are lost")
+
+	parameters.HaplotypeMutationRate = 1.0
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation with mutation succeeds")
+	for _, agent := range simulation.agents {
+		if agent.sex == MALE {
+			assert.Equal(t, agent.generation, strings.Count(agent.yHaplotype, "`"),
+				"Y haplotypes mutate every generation")
+		}
+	}
+}
+
+func TestMtHaplotypes(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 40
+	parameters.Generations = 10
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	parameters.Compatible = true
+	parameters.Seed = 5
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	byMother := make(map[int]string)
+	for _, agent := range simulation.agents {
+		if agent.isFounder() {
+			if agent.sex == FEMALE {
+				assert.Equal(t, strconv.Itoa(agent.id)+"-mt", agent.mtHaplotype, "Female founders have their own")
+			} else {
+				assert.Equal(t, "", agent.mtHaplotype, "Male founders have none")
+			}
+			continue
+		}
+		mother := agent.mother
+		if simulation.agents[mother].sex == MALE {
+			mother = agent.father
+		}
+		assert.Equal(t, simulation.agents[mother].mtHaplotype, agent.mtHaplotype, "Children inherit their mother's")
+		if sibling, ok := byMother[mother]; ok {
+			assert.Equal(t, sibling, agent.mtHaplotype, "Children of the same mother share it")
+		}
+		byMother[mother] = agent.mtHaplotype
+	}
+	last := simulation.LastGeneration()
+	assert.Less(t, len(simulation.MtHaplotypes(last)), len(simulation.MtHaplotypes(0)), "Maternal lines are lost")
+}
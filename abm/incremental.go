@@ -0,0 +1,124 @@
+// Statistics calculated generation by generation while a simulation runs.
+
+package abm
+
+import (
+	"fmt"
+)
+
+// Statistics of one generation, calculated as soon as it is made
+type GenerationStats struct {
+	Generation     int
+	PopulationSize int
+	// Number of distinct alleles carried by the generation
+	Alleles int
+	// Mean kinship of the distinct pairs of agents in the generation, only
+	// calculated if Parameters.IncrementalKinship is set
+	MeanKinship float64
+}
+
+// Kinship of every pair of agents in the latest generation. Because every
+// parent of a simulated agent is in the generation before it, this is all
+// that is needed to calculate the kinship of the next generation.
+type kinshipMatrix struct {
+	start  int
+	n      int
+	matrix []float64
+}
+
+// Returns the kinship of agents a and b, which must be in the generation
+func (k *kinshipMatrix) at(a, b int) float64 {
+	return k.matrix[(a-k.start)*k.n+b-k.start]
+}
+
+// Creates the kinship matrix of the agents from start to end
+func newKinshipMatrix(agents []Agent, start, end int) *kinshipMatrix {
+	table := newKinshipTable(agents)
+	k := &kinshipMatrix{start, end - start, make([]float64, (end-start)*(end-start))}
+	for i := start; i < end; i++ {
+		for j := i; j < end; j++ {
+			k.matrix[(i-start)*k.n+j-start] = table.kinship(i, j)
+			k.matrix[(j-start)*k.n+i-start] = k.matrix[(i-start)*k.n+j-start]
+		}
+	}
+	return k
+}
+
+// Returns the kinship matrix of the agents from start to end, whose parents
+// must all be in the generation of k
+func (k *kinshipMatrix) next(agents []Agent, start, end int) *kinshipMatrix {
+	n := end - start
+	next := &kinshipMatrix{start, n, make([]float64, n*n)}
+	for i := start; i < end; i++ {
+		a := &agents[i]
+		next.matrix[(i-start)*n+i-start] = 0.5 * (1.0 + k.at(a.mother, a.father))
+		for j := i + 1; j < end; j++ {
+			b := &agents[j]
+			f := 0.25 * (k.at(a.mother, b.mother) + k.at(a.mother, b.father) +
+				k.at(a.father, b.mother) + k.at(a.father, b.father))
+			next.matrix[(i-start)*n+j-start] = f
+			next.matrix[(j-start)*n+i-start] = f
+		}
+	}
+	return next
+}
+
+// Returns the mean kinship of the distinct pairs in the matrix
+func (k *kinshipMatrix) mean() float64 {
+	if k.n < 2 {
+		return 0.0
+	}
+	total := 0.0
+	for i := range k.n {
+		for j := i + 1; j < k.n; j++ {
+			total += k.matrix[i*k.n+j]
+		}
+	}
+	return total / float64(k.n*(k.n-1)/2)
+}
+
+// Calculates the statistics of the given generation and passes them to
+// Parameters.OnGeneration. Only the kinship of the previous generation is
+// kept, so the memory used doesn't grow with the number of generations.
+func (s *Simulation) emitGenerationStats(gen int) {
+	if s.params.OnGeneration == nil {
+		return
+	}
+	start, end := s.genStart(gen), s.genBdrys[gen]
+	stats := GenerationStats{Generation: gen, PopulationSize: end - start}
+	alleles := make(map[string]struct{})
+	for _, agent := range s.agents[start:end] {
+		for _, gene := range agent.genes {
+			alleles[gene] = struct{}{}
+		}
+	}
+	stats.Alleles = len(alleles)
+	if s.params.IncrementalKinship {
+		// With overlapping generations parents can be in any earlier one
+		if s.kinship == nil || s.params.overlapping() {
+			s.kinship = newKinshipMatrix(s.agents, start, end)
+		} else {
+			s.kinship = s.kinship.next(s.agents, start, end)
+		}
+		stats.MeanKinship = s.kinship.mean()
+	}
+	s.params.OnGeneration(stats)
+}
+
+// Returns a function for Parameters.OnGeneration that prints the statistics
+// of each generation of the simulation with the given id. With a window of
+// more than 1 their rolling means are printed too.
+func PrintGenerationStats(simulationId, window int) func(GenerationStats) {
+	population := NewRollingMean(window)
+	alleles := NewRollingMean(window)
+	kinship := NewRollingMean(window)
+	return func(g GenerationStats) {
+		fmt.Printf("%d, inc-stats, generation, %d, population, %d, alleles, %d, mean-kinship, %.6f\n",
+			simulationId, g.Generation, g.PopulationSize, g.Alleles, g.MeanKinship)
+		if window > 1 {
+			fmt.Printf("%d, inc-stats-rolling, generation, %d, population, %.1f, alleles, %.1f, mean-kinship, %.6f\n",
+				simulationId, g.Generation, population.Add(float64(g.PopulationSize)),
+				alleles.Add(float64(g.Alleles)), kinship.Add(g.MeanKinship))
+		}
+	}
+}
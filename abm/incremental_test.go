@@ -0,0 +1,37 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIncrementalMatchesPostHoc(t *testing.T) {
+	var series []GenerationStats
+	parameters := NewParameters()
+	parameters.NumAgents = 30
+	parameters.Generations = 8
+	parameters.MutationRate = 0.05
+	parameters.Seed = 11
+	parameters.IncrementalKinship = true
+	parameters.OnGeneration = func(g GenerationStats) {
+		series = append(series, g)
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	require.Equal(t, 9, len(series), "Statistics for every generation")
+	kinship := simulation.MeanKinshipByGeneration()
+	for gen, g := range series {
+		start, end := simulation.genStart(gen), simulation.genBdrys[gen]
+		alleles := make(map[string]struct{})
+		for _, agent := range simulation.agents[start:end] {
+			for _, gene := range agent.genes {
+				alleles[gene] = struct{}{}
+			}
+		}
+		assert.Equal(t, gen, g.Generation, "Generations in order")
+		assert.Equal(t, end-start, g.PopulationSize, "Population size")
+		assert.Equal(t, len(alleles), g.Alleles, "Allele diversity")
+		assert.InDelta(t, kinship[gen].MeanKinship, g.MeanKinship, 1e-12, "Mean kinship")
+	}
+}
@@ -0,0 +1,269 @@
+// Running simulations as islands that exchange migrants.
+
+package abm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Removes n agents picked at random from the last generation and returns
+// them, or all of them if it has fewer. The agents left are re-identified so
+// that ids stay indices, and their parents' children are changed to match.
+// The emigrants keep their genes but their ids and parents are those of this
+// simulation, so they must be passed to Immigrate to join another one.
+func (s *Simulation) EmigrateRandom(n int) []Agent {
+	if len(s.genBdrys) == 0 {
+		return nil
+	}
+	last := len(s.genBdrys) - 1
+	start, end := s.genStart(last), s.genBdrys[last]
+	n = min(n, end-start)
+	order := make([]int, end-start)
+	for i := range order {
+		order[i] = start + i
+	}
+	s.rng.Shuffle(len(order), func(x, y int) {
+		order[x], order[y] = order[y], order[x]
+	})
+	leaving := make(map[int]bool, n)
+	for _, id := range order[:n] {
+		leaving[id] = true
+	}
+	newIds := make(map[int]int, end-start)
+	parents := make(map[int]struct{})
+	var emigrants []Agent
+	staying := start
+	for id := start; id < end; id++ {
+		agent := s.agents[id]
+		if !agent.isFounder() {
+			parents[agent.mother] = struct{}{}
+			parents[agent.father] = struct{}{}
+		}
+		if leaving[id] {
+			agent.children, agent.ancestorVec, agent.ancestorSet = nil, nil, nil
+			emigrants = append(emigrants, agent)
+			continue
+		}
+		newIds[id] = staying
+		agent.id = staying
+		s.agents[staying] = agent
+		staying++
+	}
+	s.agents = s.agents[:staying]
+	for parent := range parents {
+		agent := &s.agents[parent]
+		children := agent.children[:0]
+		for _, child := range agent.children {
+			if newId, ok := newIds[child]; ok {
+				children = append(children, newId)
+			} else if child < start {
+				children = append(children, child)
+			}
+		}
+		agent.children = children
+	}
+	s.migrated(last)
+	return emigrants
+}
+
+// Adds agents from another simulation to the last generation. They become
+// founders of this one, with new ids, because their parents aren't in it. The
+// agents must all come from the same simulation. Their genes and haplotypes
+// are relabelled for the same reason: each founder of the other simulation is
+// given the id of the first immigrant carrying its genes, so that genes that
+// were identical there stay identical here.
+func (s *Simulation) Immigrate(agents []Agent) {
+	if len(s.genBdrys) == 0 || len(agents) == 0 {
+		return
+	}
+	last := len(s.genBdrys) - 1
+	founders := make(map[string]string)
+	for _, agent := range agents {
+		id := strconv.Itoa(len(s.agents))
+		relabel := func(gene string) string {
+			founder, rest, _ := strings.Cut(gene, "-")
+			if _, ok := founders[founder]; !ok {
+				founders[founder] = id
+			}
+			return founders[founder] + "-" + rest
+		}
+		genes := make([]string, len(agent.genes))
+		for i, gene := range agent.genes {
+			genes[i] = relabel(gene)
+		}
+		yHaplotype, mtHaplotype := "", ""
+		if agent.yHaplotype != "" {
+			yHaplotype = relabel(agent.yHaplotype)
+		}
+		if agent.mtHaplotype != "" {
+			mtHaplotype = relabel(agent.mtHaplotype)
+		}
+		s.agents = append(s.agents, Agent{
+			id:          len(s.agents),
+			generation:  last,
+			sex:         agent.sex,
+			founder:     true,
+			dead:        agent.dead,
+			genes:       genes,
+			x:           agent.x,
+			y:           agent.y,
+			yHaplotype:  yHaplotype,
+			mtHaplotype: mtHaplotype,
+			phenotype:   agent.phenotype,
+		})
+	}
+	s.migrated(last)
+}
+
+// Updates the simulation after agents have left or joined the last
+// generation
+func (s *Simulation) migrated(last int) {
+	s.genBdrys[last] = len(s.agents)
+	s.setCurrGen(last)
+	// The kinship of the changed generation is recalculated when needed
+	s.kinship, s.kinships = nil, nil
+}
+
+// Simulations run in step that exchange migrants. Every MigrationInterval
+// generations each island sends MigrationRate of its current generation,
+// picked at random, to the next island, and the last sends them to the
+// first, so migration preserves the total number of agents.
+type Islands struct {
+	sims     []*Simulation
+	interval int
+	rate     float64
+	// Why each island stopped early, nil if it didn't
+	errs []error
+}
+
+// Creates one island per set of parameters. The migration interval and rate
+// are those of the first.
+func NewIslands(params []Parameters) *Islands {
+	islands := &Islands{errs: make([]error, len(params))}
+	for i := range params {
+		islands.sims = append(islands.sims, NewSimulation(&params[i]))
+	}
+	if len(params) > 0 {
+		islands.interval = params[0].MigrationInterval
+		islands.rate = params[0].MigrationRate
+	}
+	return islands
+}
+
+// Returns the islands' simulations
+func (is *Islands) Simulations() []*Simulation {
+	return is.sims
+}
+
+// Returns why the island stopped before its last generation, or nil
+func (is *Islands) Err(i int) error {
+	return is.errs[i]
+}
+
+// Runs the islands in parallel, one generation at a time, migrating between
+// islands that are still running after every MigrationInterval generations.
+// An island that fails stops without stopping the others, and its error is
+// kept for Err. If ctx is cancelled the islands stop and the context's error
+// is returned wrapped.
+func (is *Islands) SimulateContext(ctx context.Context) error {
+	pairFuncs := make([]func(int) error, len(is.sims))
+	generations := 0
+	for i, s := range is.sims {
+		pairFuncs[i], is.errs[i] = s.begin()
+		generations = max(generations, s.params.Generations)
+	}
+	for gen := 1; gen <= generations; gen++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("islands, sim-eng-cancelled, generation, %d, %w", gen, err)
+		}
+		running := is.running(gen)
+		var wg sync.WaitGroup
+		for _, i := range running {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				is.errs[i] = is.sims[i].step(gen, pairFuncs[i])
+			}()
+		}
+		wg.Wait()
+		if is.interval > 0 && gen%is.interval == 0 {
+			is.migrate(is.running(gen))
+		}
+	}
+	return nil
+}
+
+// Returns the islands that haven't failed and have generation gen to make
+func (is *Islands) running(gen int) []int {
+	var running []int
+	for i, s := range is.sims {
+		if is.errs[i] == nil && gen <= s.params.Generations {
+			running = append(running, i)
+		}
+	}
+	return running
+}
+
+// Moves migrants from each of the islands to the next one
+func (is *Islands) migrate(islands []int) {
+	if len(islands) < 2 {
+		return
+	}
+	emigrants := make([][]Agent, len(islands))
+	for j, i := range islands {
+		s := is.sims[i]
+		n := int(math.Round(is.rate * float64(len(s.currGen))))
+		emigrants[j] = s.EmigrateRandom(n)
+	}
+	for j, i := range islands {
+		from := (j + len(islands) - 1) % len(islands)
+		is.sims[i].Immigrate(emigrants[from])
+	}
+}
+
+// Runs one island per set of parameters, with migration between them, and
+// emits the result of each when they are all done, in the order of params.
+// Islands that are stopped because ctx is cancelled are counted but not
+// emitted.
+func RunIslands(ctx context.Context, params []Parameters, emit func(BatchResult)) BatchSummary {
+	return RunIslandsSetup(ctx, params, nil, emit)
+}
+
+// Runs islands like RunIslands, but first calls setup, if it is set, with
+// each island's simulation before they run
+func RunIslandsSetup(ctx context.Context, params []Parameters, setup func(*Simulation),
+	emit func(BatchResult)) BatchSummary {
+	var summary BatchSummary
+	islands := NewIslands(slices.Clone(params))
+	if setup != nil {
+		for _, s := range islands.sims {
+			setup(s)
+		}
+	}
+	if err := islands.SimulateContext(ctx); err != nil {
+		for i := range islands.sims {
+			if islands.errs[i] != nil {
+				summary.Failed++
+			} else {
+				summary.Cancelled++
+			}
+		}
+		return summary
+	}
+	for i, s := range islands.sims {
+		err := islands.errs[i]
+		if err != nil {
+			summary.Failed++
+		} else {
+			summary.Completed++
+		}
+		emit(BatchResult{s.id, s, err})
+	}
+	return summary
+}
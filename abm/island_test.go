@@ -0,0 +1,101 @@
+package abm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigration(t *testing.T) {
+	a := mergeSim(t, 0, 6, 2)
+	b := mergeSim(t, 1, 4, 2)
+	total := len(a.agents) + len(b.agents)
+	lastA, lastB := len(a.currGen), len(b.currGen)
+
+	fromA := a.EmigrateRandom(2)
+	fromB := b.EmigrateRandom(1)
+	assert.Equal(t, 2, len(fromA), "Emigrants leave a")
+	assert.Equal(t, 1, len(fromB), "Emigrants leave b")
+	a.Immigrate(fromB)
+	b.Immigrate(fromA)
+
+	assert.Equal(t, total, len(a.agents)+len(b.agents), "Migration conserves the agents")
+	assert.Equal(t, lastA-1, len(a.currGen), "Current generation of a loses one agent on balance")
+	assert.Equal(t, lastB+1, len(b.currGen), "Current generation of b gains one agent on balance")
+	for _, s := range []*Simulation{a, b} {
+		require.Nil(t, s.CheckInvariants(), "Pedigree stays well formed")
+		assert.Equal(t, len(s.agents), s.genBdrys[len(s.genBdrys)-1], "Last generation ends with the agents")
+	}
+	immigrant := b.agents[len(b.agents)-2]
+	assert.True(t, immigrant.founder, "Immigrants are founders")
+	assert.Equal(t, 2, immigrant.generation, "Immigrants join the last generation")
+	assert.Equal(t, immigrant.id, geneFounder(t, immigrant.genes[0]), "Immigrant genes are relabelled")
+}
+
+func TestMigrationKeepsAlleles(t *testing.T) {
+	a := mergeSim(t, 0, 6, 2)
+	b := mergeSim(t, 1, 4, 2)
+	alleles := currAlleles(a) + currAlleles(b)
+
+	b.Immigrate(a.EmigrateRandom(len(a.currGen)))
+	assert.Equal(t, 0, len(a.currGen), "Current generation of a has left")
+	assert.Equal(t, alleles, currAlleles(a)+currAlleles(b), "Identical alleles stay identical")
+	for _, agent := range b.currGen {
+		for _, gene := range b.agents[agent.id].genes {
+			assert.Less(t, geneFounder(t, gene), len(b.agents), "Alleles are labelled with local ids")
+		}
+	}
+}
+
+// Returns the number of distinct alleles in the current generation
+func currAlleles(s *Simulation) int {
+	alleles := make(map[string]bool)
+	for _, agent := range s.currGen {
+		for _, gene := range s.agents[agent.id].genes {
+			alleles[gene] = true
+		}
+	}
+	return len(alleles)
+}
+
+// Returns the founder id a gene is labelled with
+func geneFounder(t *testing.T, gene string) int {
+	founder, err := geneOrigin(gene)
+	require.Nil(t, err, "Gene has a founder")
+	return founder
+}
+
+func TestIslands(t *testing.T) {
+	params := make([]Parameters, 2)
+	for i := range params {
+		params[i] = NewParameters()
+		params[i].SimulationId = i
+		params[i].Seed = int64(i + 1)
+		params[i].NumAgents = 10
+		params[i].Generations = 6
+		params[i].GrowthRate = 1.0
+		params[i].Strategy = CEIL
+		params[i].MigrationInterval = 2
+		params[i].MigrationRate = 0.2
+	}
+	var results []BatchResult
+	summary := RunIslands(context.Background(), params, func(r BatchResult) {
+		results = append(results, r)
+	})
+	assert.Equal(t, 2, summary.Completed, "Both islands complete")
+	require.Equal(t, 2, len(results), "Both islands are emitted")
+	for i, r := range results {
+		require.Nil(t, r.Err, "Island succeeds")
+		assert.Equal(t, i, r.SimulationId, "Islands are emitted in order")
+		assert.Nil(t, r.Simulation.CheckInvariants(), "Island pedigree is well formed")
+		assert.Equal(t, 6, r.Simulation.LastGeneration(), "Island runs every generation")
+		migrants := 0
+		for _, agent := range r.Simulation.agents {
+			if agent.founder && agent.generation > 0 {
+				migrants++
+			}
+		}
+		assert.Greater(t, migrants, 0, "Island receives migrants")
+	}
+}
@@ -0,0 +1,106 @@
+// Saving whole simulations as JSON for analysis by other tools, and loading
+// them again.
+
+package abm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// An agent as it is saved in JSON
+type jsonAgent struct {
+	Id          int      `json:"id"`
+	Generation  int      `json:"generation"`
+	Sex         Sex      `json:"sex"`
+	Founder     bool     `json:"founder"`
+	Dead        bool     `json:"dead"`
+	Mother      int      `json:"mother"`
+	Father      int      `json:"father"`
+	Children    []int    `json:"children"`
+	Genes       []string `json:"genes"`
+	X           float64  `json:"x,omitempty"`
+	Y           float64  `json:"y,omitempty"`
+	YHaplotype  string   `json:"y_haplotype,omitempty"`
+	MtHaplotype string   `json:"mt_haplotype,omitempty"`
+	Phenotype   float64  `json:"phenotype,omitempty"`
+}
+
+// A simulation as it is saved in JSON. Ancestors aren't saved because they
+// can be recalculated from the parents.
+type jsonSimulation struct {
+	Id           int         `json:"id"`
+	Seed         int64       `json:"seed"`
+	Parameters   Parameters  `json:"parameters"`
+	GenBdrys     []int       `json:"gen_bdrys"`
+	NumMutations int         `json:"num_mutations"`
+	Agents       []jsonAgent `json:"agents"`
+}
+
+// Encodes the simulation's parameters, generation boundaries and every agent
+// with its parents, children and genes
+func (s *Simulation) MarshalJSON() ([]byte, error) {
+	js := jsonSimulation{
+		Id:           s.id,
+		Seed:         s.seed,
+		Parameters:   s.params,
+		GenBdrys:     s.genBdrys,
+		NumMutations: s.numMutations,
+		Agents:       make([]jsonAgent, len(s.agents)),
+	}
+	for i := range s.agents {
+		a := &s.agents[i]
+		js.Agents[i] = jsonAgent{a.id, a.generation, a.sex, a.founder, a.dead,
+			a.mother, a.father, a.children, a.genes, a.x, a.y, a.yHaplotype, a.mtHaplotype, a.phenotype}
+	}
+	return json.Marshal(js)
+}
+
+// Decodes a simulation encoded by MarshalJSON. The last generation becomes
+// the current one and ancestors are left to be recalculated.
+func (s *Simulation) UnmarshalJSON(data []byte) error {
+	var js jsonSimulation
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	*s = Simulation{
+		id:           js.Id,
+		params:       js.Parameters,
+		seed:         js.Seed,
+		genBdrys:     js.GenBdrys,
+		numMutations: js.NumMutations,
+		agents:       make([]Agent, len(js.Agents)),
+		out:          os.Stdout,
+		errOut:       os.Stderr,
+	}
+	for i, a := range js.Agents {
+		s.agents[i] = Agent{id: a.Id, generation: a.Generation, sex: a.Sex, founder: a.Founder,
+			dead: a.Dead, mother: a.Mother, father: a.Father, children: a.Children, genes: a.Genes, x: a.X, y: a.Y,
+			yHaplotype: a.YHaplotype, mtHaplotype: a.MtHaplotype, phenotype: a.Phenotype}
+	}
+	if len(s.genBdrys) > 0 {
+		s.setCurrGen(len(s.genBdrys) - 1)
+	}
+	return nil
+}
+
+// Writes the whole simulation as one JSON document
+func (s *Simulation) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Reads a simulation written by WriteJSON so that it can be analyzed without
+// simulating it again. The simulation is checked with CheckInvariants.
+func LoadSimulation(r io.Reader) (*Simulation, error) {
+	var s Simulation
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("load-err, %w", err)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		return nil, err
+	}
+	s.rng = s.substream(uint64(len(s.genBdrys)))
+	return &s, nil
+}
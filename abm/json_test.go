@@ -0,0 +1,63 @@
+package abm
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 5
+	parameters.MutationRate = 0.05
+	parameters.Seed = 31
+	parameters.FitnessFunc = func(genes []string) float64 { return 1.0 }
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteJSON(&buf), "Simulation written")
+
+	var loaded Simulation
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &loaded), "Simulation read")
+	assert.Equal(t, len(simulation.agents), len(loaded.agents), "Same number of agents")
+	assert.Equal(t, simulation.LastGeneration(), loaded.LastGeneration(), "Same last generation")
+	assert.Equal(t, simulation.agents, loaded.agents, "Same agents")
+	assert.Equal(t, simulation.genBdrys, loaded.genBdrys, "Same generation boundaries")
+	assert.Equal(t, simulation.currGen, loaded.currGen, "Last generation is current")
+	assert.Equal(t, simulation.seed, loaded.seed, "Same seed")
+	assert.Equal(t, simulation.params.NumAgents, loaded.params.NumAgents, "Parameters saved")
+	assert.Nil(t, loaded.params.FitnessFunc, "Function parameters aren't saved")
+}
+
+func TestLoadSimulation(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 30
+	parameters.Generations = 6
+	parameters.Seed = 32
+	parameters.Analysis = "NCD"
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteJSON(&buf), "Simulation written")
+	want, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+
+	loaded, err := LoadSimulation(&buf)
+	require.Nil(t, err, "Simulation loaded")
+	for _, agent := range loaded.agents {
+		require.Nil(t, agent.ancestorSet, "Ancestors left to be recalculated")
+	}
+	got, err := loaded.Analysis()
+	require.Nil(t, err, "Loaded simulation can be analyzed")
+	assert.Equal(t, want, got, "Same results as the original")
+	assert.Equal(t, simulation.currGen, loaded.currGen, "Last generation is current")
+
+	_, err = LoadSimulation(strings.NewReader(`{"gen_bdrys": [1], "agents": [{"id": 3}]}`))
+	assert.NotNil(t, err, "Malformed simulation isn't loaded")
+	_, err = LoadSimulation(strings.NewReader(`{`))
+	assert.NotNil(t, err, "Invalid JSON isn't loaded")
+}
@@ -0,0 +1,107 @@
+// Grouping the agents being paired by their parents and grandparents, so that
+// the sibling and cousin checks of compatible are cheap.
+
+package abm
+
+// The parents and grandparents of an agent, with -1 for those that aren't
+// known because the agent or its parent is a founder
+type kinFamily struct {
+	// Id of the agent, so that a stale Agent.kin isn't mistaken for its family
+	id             int
+	mother, father int
+	// Mothers and fathers of the agent's mother and father, in that order
+	grandmothers, grandfathers [2]int
+}
+
+// The families of the agents that can mate in a generation, grouped once
+// before pairing so that checking a pair compares ids instead of looking up,
+// and copying, the agents' parents every time. There is one family per agent
+// of the mating pool, in the pool's order, and each agent's Agent.kin is the
+// index of its family.
+type kinGroups struct {
+	families []kinFamily
+}
+
+// Groups the agents of the mating pool by their parents and grandparents
+func newKinGroups(agents []Agent, pool []selectedAgent) *kinGroups {
+	if len(pool) == 0 {
+		return nil
+	}
+	groups := kinGroups{families: make([]kinFamily, len(pool))}
+	for i, selected := range pool {
+		agents[selected.id].kin = i
+		groups.families[i] = newKinFamily(agents, &agents[selected.id])
+	}
+	return &groups
+}
+
+func newKinFamily(agents []Agent, a *Agent) kinFamily {
+	f := kinFamily{id: a.id, mother: -1, father: -1,
+		grandmothers: [2]int{-1, -1}, grandfathers: [2]int{-1, -1}}
+	if a.isFounder() {
+		return f
+	}
+	f.mother, f.father = a.mother, a.father
+	for i, parent := range [2]int{a.mother, a.father} {
+		if p := &agents[parent]; !p.isFounder() {
+			f.grandmothers[i], f.grandfathers[i] = p.mother, p.father
+		}
+	}
+	return f
+}
+
+// Returns the family of an agent, or nil if it isn't grouped
+func (g *kinGroups) family(a *Agent) *kinFamily {
+	if g == nil || a.kin < 0 || a.kin >= len(g.families) || g.families[a.kin].id != a.id {
+		return nil
+	}
+	return &g.families[a.kin]
+}
+
+// Returns the families of two agents, and false if either isn't grouped
+func (g *kinGroups) lookup(a, b *Agent) (*kinFamily, *kinFamily, bool) {
+	fa, fb := g.family(a), g.family(b)
+	return fa, fb, fa != nil && fb != nil
+}
+
+// Checks if two known parents are the same agent
+func sameParent(x, y int) bool {
+	return x >= 0 && x == y
+}
+
+// Checks if two agents share a mother or father, as isSibling does
+func (f *kinFamily) siblingOf(g *kinFamily) bool {
+	return sameParent(f.mother, g.mother) || sameParent(f.father, g.father)
+}
+
+// Checks if a parent of one agent shares a mother or father with a parent of
+// the other, as isCousin does
+func (f *kinFamily) cousinOf(g *kinFamily) bool {
+	for i := range 2 {
+		for j := range 2 {
+			if sameParent(f.grandmothers[i], g.grandmothers[j]) ||
+				sameParent(f.grandfathers[i], g.grandfathers[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks if two agents are siblings, with the kin groups of the generation
+// being paired if they cover both agents
+func (s *Simulation) siblings(a, b *Agent) bool {
+	if fa, fb, ok := s.kinGroups.lookup(a, b); ok {
+		return fa.siblingOf(fb)
+	}
+	return isSibling(a, b)
+}
+
+// Checks if two agents are cousins, with the kin groups of the generation
+// being paired if they cover both agents
+func (s *Simulation) cousins(a, b *Agent) bool {
+	if fa, fb, ok := s.kinGroups.lookup(a, b); ok {
+		return fa.cousinOf(fb)
+	}
+	return isCousin(s.agents, a, b)
+}
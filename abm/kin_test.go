@@ -0,0 +1,84 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Parameters under which pairing checks for siblings and cousins
+func kinParameters(monogamous bool) Parameters {
+	parameters := NewParameters()
+	parameters.NumAgents = 60
+	parameters.Generations = 6
+	parameters.GrowthRate = 1.0
+	parameters.Compatible = true
+	parameters.MateCousin = true
+	parameters.MatingK = 10
+	parameters.Monogamous = monogamous
+	parameters.Seed = 5
+	return parameters
+}
+
+func TestKinGroupsMatchNaiveChecks(t *testing.T) {
+	parameters := kinParameters(false)
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for gen := 1; gen <= parameters.Generations; gen++ {
+		simulation.setCurrGen(gen)
+		groups := newKinGroups(simulation.agents, simulation.currGen)
+		for _, a := range simulation.currGen {
+			for _, b := range simulation.currGen {
+				agentA, agentB := &simulation.agents[a.id], &simulation.agents[b.id]
+				fa, fb, ok := groups.lookup(agentA, agentB)
+				require.True(t, ok, "Agents of the pool are grouped")
+				assert.Equal(t, isSibling(agentA, agentB), fa.siblingOf(fb),
+					"Sibling check of %d and %d", a.id, b.id)
+				assert.Equal(t, isCousin(simulation.agents, agentA, agentB), fa.cousinOf(fb),
+					"Cousin check of %d and %d", a.id, b.id)
+			}
+		}
+	}
+	var none *kinGroups
+	_, _, ok := none.lookup(&simulation.agents[0], &simulation.agents[1])
+	assert.False(t, ok, "Nothing is grouped without kin groups")
+	groups := newKinGroups(simulation.agents, simulation.currGen)
+	assert.Equal(t, len(simulation.currGen), len(groups.families), "One family per agent of the pool")
+	assert.Nil(t, groups.family(&simulation.agents[0]), "Agents outside the pool aren't grouped")
+}
+
+func TestKinGroupsKeepPairings(t *testing.T) {
+	for _, overlap := range []bool{false, true} {
+		for _, monogamous := range []bool{false, true} {
+			checkKinPairings(t, monogamous, overlap)
+		}
+	}
+}
+
+// Checks that a simulation pairs the same agents with and without kin groups
+func checkKinPairings(t *testing.T, monogamous, overlap bool) {
+	parameters := kinParameters(monogamous)
+	parameters.FertilityMax = 0
+	if overlap {
+		parameters.FertilityMax = 2
+	}
+	grouped := NewSimulation(&parameters)
+	require.Nil(t, grouped.Simulate(), "Simulation with kin groups succeeds")
+
+	naive := NewSimulation(&parameters)
+	pairFunc, err := naive.begin()
+	require.Nil(t, err, "Naive simulation begins")
+	for i := 1; i <= parameters.Generations; i++ {
+		require.Nil(t, naive.step(i, func(i int) error {
+			naive.kinGroups = nil
+			return pairFunc(i)
+		}), "Naive generation %d is made", i)
+	}
+
+	require.Equal(t, len(naive.agents), len(grouped.agents), "Same number of agents")
+	for i := range naive.agents {
+		assert.Equal(t, [2]int{naive.agents[i].mother, naive.agents[i].father},
+			[2]int{grouped.agents[i].mother, grouped.agents[i].father},
+			"Parents of agent %d are unchanged, monogamous %v, overlap %v", i, monogamous, overlap)
+	}
+}
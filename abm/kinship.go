@@ -0,0 +1,166 @@
+// Kinship coefficients and how they change over generations.
+
+package abm
+
+import (
+	"fmt"
+)
+
+// Largest number of pairs MeanKinshipByGeneration compares in a generation.
+// Larger generations are estimated from this many randomly sampled pairs.
+var MaxKinshipPairs = 10_000
+
+// Memoized kinship coefficients of pairs of agents. The kinship of two agents
+// is the probability that alleles drawn at random from the same locus of
+// each are identical by descent. Founders are unrelated to each other.
+type kinshipTable struct {
+	agents []Agent
+	memo   map[[2]int]float64
+}
+
+func newKinshipTable(agents []Agent) *kinshipTable {
+	return &kinshipTable{agents, make(map[[2]int]float64)}
+}
+
+// Returns the kinship coefficient of agents a and b. Because children always
+// have higher ids than their parents, the agent with the higher id can't be
+// an ancestor of the other, so it is the one replaced by its parents.
+func (k *kinshipTable) kinship(a, b int) float64 {
+	if a > b {
+		a, b = b, a
+	}
+	if f, found := k.memo[[2]int{a, b}]; found {
+		return f
+	}
+	agent := &k.agents[b]
+	var f float64
+	switch {
+	case a == b && agent.isFounder():
+		f = 0.5
+	case a == b:
+		f = 0.5 * (1.0 + k.kinship(agent.mother, agent.father))
+	case agent.isFounder():
+		f = 0.0
+	default:
+		f = 0.5 * (k.kinship(a, agent.mother) + k.kinship(a, agent.father))
+	}
+	k.memo[[2]int{a, b}] = f
+	return f
+}
+
+// Returns the kinship coefficient of agents a and b: half the mean of the
+// kinship of one with each parent of the other, 0 between distinct founders
+// and 0.5 for a founder with itself. Coefficients are memoized across calls
+// until agents are added or removed.
+func (s *Simulation) Kinship(a, b int) float64 {
+	if s.kinships == nil || len(s.kinships.agents) != len(s.agents) {
+		s.kinships = newKinshipTable(s.agents)
+	}
+	return s.kinships.kinship(a, b)
+}
+
+// Mean kinship of the pairs of agents in a generation
+type GenerationKinship struct {
+	Generation  int
+	MeanKinship float64
+	// Number of pairs the mean is calculated over, fewer than every pair
+	// when the generation is sampled
+	Pairs int
+}
+
+// Calculates the mean kinship coefficient of the distinct pairs of agents in
+// every generation with at least two agents, oldest generation first.
+// Generations with more than MaxKinshipPairs pairs are estimated from that
+// many random pairs, drawn from the simulation's kinship stream.
+func (s *Simulation) MeanKinshipByGeneration() []GenerationKinship {
+	table := newKinshipTable(s.agents)
+	rng := s.substream(kinshipStream)
+	var series []GenerationKinship
+	for gen := range s.genBdrys {
+		start := s.genStart(gen)
+		n := s.genBdrys[gen] - start
+		if n < 2 {
+			continue
+		}
+		total := 0.0
+		pairs := n * (n - 1) / 2
+		if pairs > MaxKinshipPairs {
+			pairs = MaxKinshipPairs
+			for range pairs {
+				i := rng.Intn(n)
+				j := rng.Intn(n - 1)
+				if j >= i {
+					j++
+				}
+				total += table.kinship(start+i, start+j)
+			}
+		} else {
+			for i := start; i < s.genBdrys[gen]-1; i++ {
+				for j := i + 1; j < s.genBdrys[gen]; j++ {
+					total += table.kinship(i, j)
+				}
+			}
+		}
+		series = append(series, GenerationKinship{gen, total / float64(pairs), pairs})
+	}
+	return series
+}
+
+// Reports the mean kinship of each generation, which shows how related a
+// closed population becomes over time. With a window the rolling mean is
+// reported too.
+func (s *Simulation) reportKinshipDecay() {
+	rolling := NewRollingMean(s.params.Window)
+	for _, k := range s.MeanKinshipByGeneration() {
+		mean := rolling.Add(k.MeanKinship)
+		if s.params.Window > 1 {
+			fmt.Fprintf(s.out, "%d, rpt-kinship-decay, generation, %d, mean-kinship, %.6f, pairs, %d, rolling-mean, %.6f\n",
+				s.id, k.Generation, k.MeanKinship, k.Pairs, mean)
+		} else {
+			fmt.Fprintf(s.out, "%d, rpt-kinship-decay, generation, %d, mean-kinship, %.6f, pairs, %d\n",
+				s.id, k.Generation, k.MeanKinship, k.Pairs)
+		}
+	}
+}
+
+// Returns Wright's inbreeding coefficient of each agent in the given
+// generation, in agent order. An agent's coefficient is the kinship of its
+// parents, the probability that its two alleles at a locus are identical by
+// descent. Founders aren't inbred.
+func (s *Simulation) InbreedingCoefficients(gen int) []float64 {
+	if gen < 0 || gen >= len(s.genBdrys) {
+		return nil
+	}
+	table := newKinshipTable(s.agents)
+	start := s.genStart(gen)
+	coefficients := make([]float64, 0, s.genBdrys[gen]-start)
+	for i := start; i < s.genBdrys[gen]; i++ {
+		agent := &s.agents[i]
+		if agent.isFounder() {
+			coefficients = append(coefficients, 0.0)
+			continue
+		}
+		coefficients = append(coefficients, table.kinship(agent.mother, agent.father))
+	}
+	return coefficients
+}
+
+// Reports the minimum, maximum and mean inbreeding coefficient of the agents
+// in the given generation, and how many are inbred
+func (s *Simulation) reportInbreeding(generation int) {
+	coefficients := s.InbreedingCoefficients(generation)
+	if len(coefficients) == 0 {
+		return
+	}
+	min_, max_, total, inbred := coefficients[0], coefficients[0], 0.0, 0
+	for _, f := range coefficients {
+		min_ = min(min_, f)
+		max_ = max(max_, f)
+		total += f
+		if f > 0.0 {
+			inbred++
+		}
+	}
+	fmt.Fprintf(s.out, "%d, rpt-inbreeding, generation, %d, min, %.6f, max, %.6f, mean, %.6f, inbred, %d\n",
+		s.id, generation, min_, max_, total/float64(len(coefficients)), inbred)
+}
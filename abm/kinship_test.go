@@ -0,0 +1,87 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKinship(t *testing.T) {
+	simulation := setupSim(t)
+	table := newKinshipTable(simulation.agents)
+	assert.Equal(t, 0.0, table.kinship(0, 1), "Founders are unrelated")
+	assert.Equal(t, 0.5, table.kinship(0, 0), "Founder kinship with self")
+	assert.Equal(t, 0.25, table.kinship(3, 4), "Full siblings")
+	assert.Equal(t, 0.25, table.kinship(0, 3), "Parent and child")
+	assert.Equal(t, 0.625, table.kinship(5, 5), "Child of full siblings is inbred")
+}
+
+func TestSimulationKinship(t *testing.T) {
+	parameters := NewParameters()
+	simulation := NewSimulation(&parameters)
+	// Founders 0 and 1 have full siblings 2 and 3, and 3 has a child 5 with
+	// founder 4
+	simulation.agents = []Agent{
+		{id: 0, sex: MALE, founder: true, children: []int{2, 3}},
+		{id: 1, sex: FEMALE, founder: true, children: []int{2, 3}},
+		{id: 2, generation: 1, sex: MALE, mother: 1, father: 0},
+		{id: 3, generation: 1, sex: FEMALE, mother: 1, father: 0, children: []int{5}},
+		{id: 4, generation: 1, sex: MALE, founder: true, children: []int{5}},
+		{id: 5, generation: 2, sex: FEMALE, mother: 3, father: 4},
+	}
+	simulation.SetGenBdrys()
+	require.Nil(t, simulation.ValidatePedigree(), "Pedigree is well formed")
+	assert.Equal(t, 0.25, simulation.Kinship(2, 3), "Full siblings")
+	assert.Equal(t, 0.25, simulation.Kinship(0, 2), "Parent and child")
+	assert.Equal(t, 0.25, simulation.Kinship(5, 3), "Child and parent")
+	assert.Equal(t, 0.125, simulation.Kinship(2, 5), "Uncle and niece")
+	assert.Equal(t, 0.0, simulation.Kinship(4, 2), "Unrelated founder")
+	assert.Equal(t, 0.5, simulation.Kinship(5, 5), "Outbred agent with itself")
+
+	simulation.agents = append(simulation.agents,
+		Agent{id: 6, generation: 2, sex: MALE, mother: 3, father: 2})
+	simulation.agents[2].children = []int{6}
+	simulation.agents[3].children = append(simulation.agents[3].children, 6)
+	simulation.SetGenBdrys()
+	assert.Equal(t, 0.625, simulation.Kinship(6, 6), "Memo is renewed when agents are added")
+}
+
+func TestMeanKinshipRises(t *testing.T) {
+	parameters := Parameters{
+		SimulationId: 8,
+		NumAgents:    20,
+		Generations:  12,
+		GrowthRate:   1.0,
+		Strategy:     CEIL,
+		MatingK:      50,
+		Seed:         8,
+	}
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	series := simulation.MeanKinshipByGeneration()
+	require.Equal(t, 13, len(series), "One mean per generation")
+	assert.Equal(t, 0.0, series[0].MeanKinship, "Founders are unrelated")
+	assert.Equal(t, 190, series[0].Pairs, "Every pair of founders is compared")
+	assert.Greater(t, series[1].MeanKinship, series[0].MeanKinship, "Siblings raise kinship")
+	assert.Greater(t, series[12].MeanKinship, series[1].MeanKinship,
+		"Closed population becomes more related")
+
+	MaxKinshipPairs = 50
+	defer func() { MaxKinshipPairs = 10_000 }()
+	sampled := simulation.MeanKinshipByGeneration()
+	assert.Equal(t, 50, sampled[12].Pairs, "Large generations are sampled")
+	assert.InDelta(t, series[12].MeanKinship, sampled[12].MeanKinship, 0.05,
+		"Sampled mean estimates the full mean")
+}
+
+func TestInbreedingCoefficients(t *testing.T) {
+	simulation := setupSim(t)
+	assert.Equal(t, []float64{0, 0}, simulation.InbreedingCoefficients(0), "Founders aren't inbred")
+	assert.Equal(t, []float64{0, 0, 0}, simulation.InbreedingCoefficients(1), "Children of unrelated founders")
+	assert.Equal(t, []float64{0.25, 0.25, 0.25, 0.25}, simulation.InbreedingCoefficients(2),
+		"Children of full siblings")
+	for _, f := range simulation.InbreedingCoefficients(3) {
+		assert.Greater(t, f, 0.25, "Children of inbred siblings are more inbred")
+	}
+	assert.Nil(t, simulation.InbreedingCoefficients(4), "Generation out of range")
+}
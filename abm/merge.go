@@ -0,0 +1,140 @@
+// Merging simulations into one population.
+
+package abm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Combines two simulations into a new one whose agents are those of a
+// followed by those of b within each generation, re-identified so that the
+// agents stay ordered by generation. Parent and child links and the founder
+// ids that label genes and haplotypes are changed to match. The new
+// simulation has a's id and parameters. The simulations must have the same
+// number of genes per agent and both be haploid or both diploid.
+func Merge(a, b *Simulation) (*Simulation, error) {
+	merged, _, err := merge(a, b)
+	return merged, err
+}
+
+// Merges two simulations and returns the new ids of the agents of each
+func merge(a, b *Simulation) (*Simulation, [2][]int, error) {
+	newIds := [2][]int{make([]int, len(a.agents)), make([]int, len(b.agents))}
+	if a.params.NumGenes != b.params.NumGenes {
+		return nil, newIds, fmt.Errorf("%d, merge-err, %d genes per agent not compatible with %d in simulation %d",
+			a.id, a.params.NumGenes, b.params.NumGenes, b.id)
+	}
+	if a.params.Diploid != b.params.Diploid {
+		return nil, newIds, fmt.Errorf("%d, merge-err, diploid %t not compatible with %t in simulation %d",
+			a.id, a.params.Diploid, b.params.Diploid, b.id)
+	}
+	merged := &Simulation{
+		id:           a.id,
+		params:       a.params,
+		seed:         a.seed,
+		numMutations: a.numMutations + b.numMutations,
+		out:          a.out,
+		errOut:       a.errOut,
+	}
+	merged.agents = make([]Agent, 0, len(a.agents)+len(b.agents))
+	sources := [2]*Simulation{a, b}
+	for gen := range max(len(a.genBdrys), len(b.genBdrys)) {
+		for i, source := range sources {
+			if gen >= len(source.genBdrys) {
+				continue
+			}
+			for id := source.genStart(gen); id < source.genBdrys[gen]; id++ {
+				newIds[i][id] = len(merged.agents)
+				merged.agents = append(merged.agents, Agent{
+					generation: source.agents[id].generation,
+					sex:        source.agents[id].sex,
+					founder:    source.agents[id].founder,
+					dead:       source.agents[id].dead,
+					x:          source.agents[id].x,
+					y:          source.agents[id].y,
+					phenotype:  source.agents[id].phenotype,
+				})
+			}
+		}
+		merged.genBdrys = append(merged.genBdrys, len(merged.agents))
+	}
+	for i, source := range sources {
+		for id := range source.agents {
+			from := &source.agents[id]
+			to := &merged.agents[newIds[i][id]]
+			to.id = newIds[i][id]
+			if !from.isFounder() {
+				to.mother = newIds[i][from.mother]
+				to.father = newIds[i][from.father]
+			}
+			for _, child := range from.children {
+				to.children = append(to.children, newIds[i][child])
+			}
+			for _, gene := range from.genes {
+				relabelled, err := relabelGene(gene, newIds[i])
+				if err != nil {
+					return nil, newIds, fmt.Errorf("%d, merge-err, %w", a.id, err)
+				}
+				to.genes = append(to.genes, relabelled)
+			}
+			for _, h := range [...]struct{ from, to *string }{
+				{&from.yHaplotype, &to.yHaplotype}, {&from.mtHaplotype, &to.mtHaplotype}} {
+				if *h.from == "" {
+					continue
+				}
+				relabelled, err := relabelGene(*h.from, newIds[i])
+				if err != nil {
+					return nil, newIds, fmt.Errorf("%d, merge-err, %w", a.id, err)
+				}
+				*h.to = relabelled
+			}
+		}
+	}
+	merged.setCurrGen(len(merged.genBdrys) - 1)
+	return merged, newIds, nil
+}
+
+// Replaces the founder id that a gene starts with by its new id
+func relabelGene(gene string, newIds []int) (string, error) {
+	founder, rest, _ := strings.Cut(gene, "-")
+	id, err := strconv.Atoi(founder)
+	if err != nil || id < 0 || id >= len(newIds) {
+		return "", fmt.Errorf("invalid gene %s", gene)
+	}
+	return strconv.Itoa(newIds[id]) + "-" + rest, nil
+}
+
+// Merges two simulations and then adds a generation of the given number of
+// admixed children, each with one parent drawn at random from the last
+// generation of a and the other from the last generation of b.
+func MergeAdmixed(a, b *Simulation, children int) (*Simulation, error) {
+	if a.NumGenerations() == 0 || b.NumGenerations() == 0 {
+		return nil, fmt.Errorf("%d, merge-err, simulations to admix must have agents", a.id)
+	}
+	merged, newIds, err := merge(a, b)
+	if err != nil {
+		return nil, err
+	}
+	// The last generations of a and b in the merged simulation
+	var parents [2][]int
+	for i, source := range [...]*Simulation{a, b} {
+		last := source.LastGeneration()
+		parents[i] = newIds[i][source.genStart(last):source.genBdrys[last]]
+	}
+	generation := len(merged.genBdrys)
+	merged.rng = merged.substream(uint64(generation))
+	for range children {
+		x := parents[0][merged.rng.Intn(len(parents[0]))]
+		y := parents[1][merged.rng.Intn(len(parents[1]))]
+		father, mother := x, y
+		if merged.agents[x].sex == FEMALE {
+			father, mother = y, x
+		}
+		merged.addChild(father, mother, generation)
+	}
+	merged.genBdrys = append(merged.genBdrys, len(merged.agents))
+	merged.setCurrGen(generation)
+	return merged, nil
+}
@@ -0,0 +1,60 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Runs a tiny simulation for merging
+func mergeSim(t *testing.T, id, agents, generations int) *Simulation {
+	parameters := NewParameters()
+	parameters.SimulationId = id
+	parameters.NumAgents = agents
+	parameters.Generations = generations
+	parameters.GrowthRate = 1.0
+	parameters.NumGenes = 2
+	parameters.Seed = int64(id + 1)
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	return simulation
+}
+
+func TestMerge(t *testing.T) {
+	a := mergeSim(t, 0, 4, 2)
+	b := mergeSim(t, 1, 3, 3)
+	merged, err := Merge(a, b)
+	require.Nil(t, err, "Simulations merge")
+	assert.Equal(t, len(a.agents)+len(b.agents), len(merged.agents), "Every agent is kept")
+	assert.Equal(t, []int{7, 14, 21, 24}, merged.genBdrys, "Agents are ordered by generation")
+	require.Nil(t, merged.ValidatePedigree(), "Merged pedigree is well formed")
+	assert.Equal(t, 1, merged.agents[7].generation, "Generation 1 follows both sets of founders")
+	assert.Equal(t, "0-0", merged.agents[0].genes[0], "Genes of a's founders keep their labels")
+	assert.Equal(t, "4-1", merged.agents[4].genes[1], "Genes of b's founders are relabelled")
+
+	b.params.NumGenes = 3
+	_, err = Merge(a, b)
+	assert.NotNil(t, err, "Gene counts must match")
+}
+
+func TestMergeAdmixed(t *testing.T) {
+	a := mergeSim(t, 0, 4, 2)
+	b := mergeSim(t, 1, 3, 2)
+	merged, err := MergeAdmixed(a, b, 6)
+	require.Nil(t, err, "Simulations merge")
+	require.Nil(t, merged.ValidatePedigree(), "Admixed pedigree is well formed")
+	assert.Equal(t, 3, merged.LastGeneration(), "Admixed generation follows both")
+	merged.setAncestorsGen(3)
+	for _, agent := range merged.agents[merged.genStart(3):] {
+		// Founders 0 to 3 come from a and 4 to 6 from b
+		fromA, fromB := false, false
+		for _, ancestor := range agent.ancestorVec {
+			fromA = fromA || (merged.agents[ancestor].isFounder() && ancestor < 4)
+			fromB = fromB || (merged.agents[ancestor].isFounder() && ancestor >= 4)
+		}
+		assert.True(t, fromA && fromB, "Admixed agents descend from both populations")
+	}
+	fates, err := merged.FounderFates()
+	require.Nil(t, err, "Genes have founder origins")
+	assert.Equal(t, 7, len(fates), "Founders of both populations")
+}
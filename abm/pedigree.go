@@ -0,0 +1,179 @@
+// Checking that a pedigree is well formed.
+
+package abm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Checks that agents form a pedigree the analyses can use: each agent's id is
+// its index, parents are in range, no agent is its own parent or ancestor,
+// parents come before and are in earlier generations than their children,
+// and the children of each agent are exactly the agents naming it as a
+// parent. Founders' parents are ignored. Every problem found is returned in
+// one joined error.
+func ValidatePedigree(agents []Agent) error {
+	var errs []error
+	inRange := func(id int) bool {
+		return id >= 0 && id < len(agents)
+	}
+	for i := range agents {
+		agent := &agents[i]
+		if agent.id != i {
+			errs = append(errs, fmt.Errorf("agent at index %d has id %d", i, agent.id))
+		}
+		if agent.isFounder() {
+			continue
+		}
+		for _, parent := range [...]struct {
+			role string
+			id   int
+		}{{"mother", agent.mother}, {"father", agent.father}} {
+			switch {
+			case !inRange(parent.id):
+				errs = append(errs, fmt.Errorf("agent %d: %s %d out of range", i, parent.role, parent.id))
+			case parent.id == i:
+				errs = append(errs, fmt.Errorf("agent %d: is its own %s", i, parent.role))
+			case parent.id > i:
+				errs = append(errs, fmt.Errorf("agent %d: %s %d comes after child", i, parent.role, parent.id))
+			case agents[parent.id].generation >= agent.generation:
+				errs = append(errs, fmt.Errorf("agent %d: %s %d not in an earlier generation",
+					i, parent.role, parent.id))
+			case !slices.Contains(agents[parent.id].children, i):
+				errs = append(errs, fmt.Errorf("agent %d: missing from children of %s %d",
+					i, parent.role, parent.id))
+			}
+		}
+	}
+	for i := range agents {
+		for _, child := range agents[i].children {
+			if !inRange(child) {
+				errs = append(errs, fmt.Errorf("agent %d: child %d out of range", i, child))
+				continue
+			}
+			c := &agents[child]
+			if c.isFounder() || (c.mother != i && c.father != i) {
+				errs = append(errs, fmt.Errorf("agent %d: child %d does not have it as a parent", i, child))
+			}
+		}
+	}
+	if cycle := findAncestryCycle(agents); cycle >= 0 {
+		errs = append(errs, fmt.Errorf("agent %d: is its own ancestor", cycle))
+	}
+	return errors.Join(errs...)
+}
+
+// Returns an agent that is its own ancestor, or -1 if there is none. Parent
+// references that are out of range are ignored.
+func findAncestryCycle(agents []Agent) int {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(agents))
+	// An agent being visited and its parents that are still to be visited
+	type frame struct {
+		id      int
+		parents []int
+	}
+	parentsOf := func(id int) []int {
+		agent := &agents[id]
+		if agent.isFounder() {
+			return nil
+		}
+		var parents []int
+		for _, p := range [...]int{agent.mother, agent.father} {
+			if p >= 0 && p < len(agents) {
+				parents = append(parents, p)
+			}
+		}
+		return parents
+	}
+	for root := range agents {
+		if state[root] != unvisited {
+			continue
+		}
+		state[root] = visiting
+		stack := []frame{{root, parentsOf(root)}}
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if len(top.parents) == 0 {
+				state[top.id] = done
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			parent := top.parents[0]
+			top.parents = top.parents[1:]
+			switch state[parent] {
+			case visiting:
+				return parent
+			case unvisited:
+				state[parent] = visiting
+				stack = append(stack, frame{parent, parentsOf(parent)})
+			}
+		}
+	}
+	return -1
+}
+
+// Checks that the simulation's agents form a well formed pedigree
+func (s *Simulation) ValidatePedigree() error {
+	if err := ValidatePedigree(s.agents); err != nil {
+		return fmt.Errorf("%d, pedigree-err, %w", s.id, err)
+	}
+	return nil
+}
+
+// Checks every invariant the analyses rely on: the pedigree is well formed,
+// generation boundaries are non-decreasing and end at the last agent, each
+// agent is in the generation its boundaries say, and each stored ancestor
+// vector is sorted without repeats, holds only earlier agents and has the same
+// elements as the agent's ancestor set. Every problem found is returned in one
+// joined error.
+func (s *Simulation) CheckInvariants() error {
+	var errs []error
+	if err := ValidatePedigree(s.agents); err != nil {
+		errs = append(errs, err)
+	}
+	for gen, bdry := range s.genBdrys {
+		if bdry < s.genStart(gen) {
+			errs = append(errs, fmt.Errorf("generation %d: boundary %d before boundary %d of previous generation",
+				gen, bdry, s.genStart(gen)))
+			continue
+		}
+		for id := s.genStart(gen); id < min(bdry, len(s.agents)); id++ {
+			if s.agents[id].generation != gen {
+				errs = append(errs, fmt.Errorf("agent %d: generation %d within boundaries of generation %d",
+					id, s.agents[id].generation, gen))
+			}
+		}
+	}
+	if n := len(s.genBdrys); n > 0 && s.genBdrys[n-1] != len(s.agents) {
+		errs = append(errs, fmt.Errorf("last generation boundary %d but %d agents", s.genBdrys[n-1], len(s.agents)))
+	}
+	for i := range s.agents {
+		agent := &s.agents[i]
+		if len(agent.ancestorVec) != len(agent.ancestorSet) {
+			errs = append(errs, fmt.Errorf("agent %d: %d ancestors in vector but %d in set",
+				i, len(agent.ancestorVec), len(agent.ancestorSet)))
+		}
+		for j, ancestor := range agent.ancestorVec {
+			if j > 0 && ancestor <= agent.ancestorVec[j-1] {
+				errs = append(errs, fmt.Errorf("agent %d: ancestor vector not strictly increasing at %d", i, j))
+			}
+			if ancestor < 0 || ancestor >= i {
+				errs = append(errs, fmt.Errorf("agent %d: ancestor %d does not come before it", i, ancestor))
+			}
+			if _, found := agent.ancestorSet[ancestor]; !found {
+				errs = append(errs, fmt.Errorf("agent %d: ancestor %d in vector but not set", i, ancestor))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%d, invariant-err, %w", s.id, err)
+	}
+	return nil
+}
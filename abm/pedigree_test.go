@@ -0,0 +1,101 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidatePedigreeWellFormed(t *testing.T) {
+	simulation := setupSim(t)
+	assert.Nil(t, ValidatePedigree(simulation.agents), "Test pedigree is well formed")
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 6
+	parameters.MateSelf = true
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	assert.Nil(t, simulation.ValidatePedigree(), "Simulated pedigree is well formed")
+}
+
+func TestValidatePedigreeMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(agents []Agent)
+		message string
+	}{
+		{"wrong id", func(a []Agent) { a[4].id = 40 }, "agent at index 4 has id 40"},
+		{"dangling parent", func(a []Agent) { a[9].mother = 99 }, "agent 9: mother 99 out of range"},
+		{"self parent", func(a []Agent) { a[9].father = 9 }, "agent 9: is its own father"},
+		{"parent after child", func(a []Agent) {
+			a[5].father = 9
+			a[9].children = append(a[9].children, 5)
+		}, "agent 5: father 9 comes after child"},
+		{"parent in same generation", func(a []Agent) {
+			a[10].mother = 9
+			a[9].children = append(a[9].children, 10)
+		}, "agent 10: mother 9 not in an earlier generation"},
+		{"missing child link", func(a []Agent) { a[5].children = []int{10} }, "agent 9: missing from children of mother 5"},
+		{"extra child link", func(a []Agent) { a[2].children = []int{9} }, "agent 2: child 9 does not have it as a parent"},
+		{"dangling child", func(a []Agent) { a[2].children = []int{-1} }, "agent 2: child -1 out of range"},
+		{"cycle", func(a []Agent) {
+			a[3].mother = 9
+			a[9].children = append(a[9].children, 3)
+		}, "is its own ancestor"},
+	}
+	for _, tt := range tests {
+		simulation := setupSim(t)
+		tt.corrupt(simulation.agents)
+		err := ValidatePedigree(simulation.agents)
+		require.NotNil(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.message, tt.name)
+	}
+}
+
+func TestCheckInvariants(t *testing.T) {
+	simulation := setupSim(t)
+	simulation.setAncestorsGen(3)
+	assert.Nil(t, simulation.CheckInvariants(), "Test simulation holds its invariants")
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 6
+	parameters.Monogamous = true
+	simulation = NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	_, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	assert.Nil(t, simulation.CheckInvariants(), "Simulated and analyzed simulation holds its invariants")
+}
+
+func TestCheckInvariantsCorrupted(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(s *Simulation)
+		message string
+	}{
+		{"pedigree", func(s *Simulation) { s.agents[9].mother = 99 }, "agent 9: mother 99 out of range"},
+		{"unsorted ancestors", func(s *Simulation) {
+			vec := s.agents[9].ancestorVec
+			vec[0], vec[1] = vec[1], vec[0]
+		}, "agent 9: ancestor vector not strictly increasing at 1"},
+		{"set differs from vector", func(s *Simulation) {
+			delete(s.agents[10].ancestorSet, s.agents[10].ancestorVec[0])
+		}, "agent 10: 6 ancestors in vector but 5 in set"},
+		{"later ancestor", func(s *Simulation) {
+			s.agents[11].ancestorVec = append(s.agents[11].ancestorVec, 12)
+			s.agents[11].ancestorSet[12] = struct{}{}
+		}, "agent 11: ancestor 12 does not come before it"},
+		{"boundaries decrease", func(s *Simulation) { s.genBdrys[1] = 1 }, "boundary 1 before boundary 2"},
+		{"boundaries end early", func(s *Simulation) { s.genBdrys[3] = 13 }, "last generation boundary 13 but 14 agents"},
+		{"wrong generation", func(s *Simulation) { s.agents[4].generation = 2 },
+			"agent 4: generation 2 within boundaries of generation 1"},
+	}
+	for _, tt := range tests {
+		simulation := setupSim(t)
+		simulation.setAncestorsGen(3)
+		tt.corrupt(simulation)
+		err := simulation.CheckInvariants()
+		require.NotNil(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.message, tt.name)
+	}
+}
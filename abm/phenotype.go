@@ -0,0 +1,58 @@
+// A continuous quantitative trait, such as height, that children inherit as
+// the mean of their parents' values plus environmental noise.
+
+package abm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Draws from the standard normal distribution with the Box-Muller transform
+func normal(rng Rng) float64 {
+	u := 1.0 - rng.Float64() // In (0, 1] so that the log is finite
+	return math.Sqrt(-2.0*math.Log(u)) * math.Cos(2.0*math.Pi*rng.Float64())
+}
+
+// Gives the founders phenotypes drawn from the standard normal distribution.
+// They are drawn from a stream of their own so that the founders are the
+// same as without phenotypes.
+func (s *Simulation) addFounderPhenotypes(rng Rng) {
+	for i := range s.agents {
+		s.agents[i].phenotype = normal(rng)
+	}
+}
+
+// Sets a child's phenotype to the mean of its parents' plus normal noise with
+// variance Parameters.EnvVariance. No random numbers are drawn without noise.
+func (s *Simulation) inheritPhenotype(child *Agent) {
+	child.phenotype = 0.5 * (s.agents[child.mother].phenotype + s.agents[child.father].phenotype)
+	if s.params.EnvVariance > 0.0 {
+		child.phenotype += math.Sqrt(s.params.EnvVariance) * normal(s.rng)
+	}
+}
+
+// Returns the mean and population variance of the phenotypes of the agents in
+// the given generation, NaN if it has none
+func (s *Simulation) PhenotypeStats(gen int) (mean, variance float64) {
+	agents := s.Generation(gen)
+	if len(agents) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	sum, squares := 0.0, 0.0
+	for _, agent := range agents {
+		sum += agent.phenotype
+		squares += agent.phenotype * agent.phenotype
+	}
+	n := float64(len(agents))
+	mean = sum / n
+	return mean, squares/n - mean*mean
+}
+
+// Reports the mean and variance of the phenotypes of the last generation
+func (s *Simulation) reportPhenotypes() {
+	last := s.LastGeneration()
+	mean, variance := s.PhenotypeStats(last)
+	fmt.Fprintf(s.out, "%d, rpt-phenotype, generation, %d, agents, %d, mean, %.4f, variance, %.4f\n",
+		s.id, last, len(s.Generation(last)), mean, variance)
+}
@@ -0,0 +1,35 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPhenotype(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 50
+	parameters.Generations = 4
+	parameters.Seed = 3
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	for _, agent := range simulation.agents {
+		if agent.isFounder() {
+			continue
+		}
+		midpoint := 0.5 * (simulation.agents[agent.mother].phenotype + simulation.agents[agent.father].phenotype)
+		assert.Equal(t, midpoint, agent.phenotype, "Agent %d has its parents' midpoint", agent.id)
+	}
+	_, founderVariance := simulation.PhenotypeStats(0)
+	assert.InDelta(t, 1.0, founderVariance, 0.5, "Founders are drawn from a standard normal")
+	_, lastVariance := simulation.PhenotypeStats(4)
+	assert.Less(t, lastVariance, founderVariance, "Averaging without noise shrinks the variance")
+
+	parameters.EnvVariance = 1.0
+	noisy := NewSimulation(&parameters)
+	require.Nil(t, noisy.Simulate(), "Noisy simulation succeeds")
+	assert.Equal(t, simulation.agents[0].phenotype, noisy.agents[0].phenotype, "Founders don't depend on the noise")
+	child := noisy.agents[noisy.genBdrys[0]]
+	midpoint := 0.5 * (noisy.agents[child.mother].phenotype + noisy.agents[child.father].phenotype)
+	assert.NotEqual(t, midpoint, child.phenotype, "Noise is added to the midpoint")
+}
@@ -0,0 +1,65 @@
+// Results of the analyses, so that they can be used without parsing the
+// printed reports.
+
+package abm
+
+// Results of the analyses of a simulation. The result of an analysis that
+// isn't selected is nil.
+type AnalysisResult struct {
+	// Generation the ancestry analyses are done on
+	Generation      int
+	NumAncestors    *NumAncestorsResult
+	CommonAncestors *CommonAncestorsResult
+	GenerationDiff  *GenerationDiffResult
+	// One result per generation analyzed, oldest first
+	Genes []GeneResult
+}
+
+// Number of ancestors of the agents in the analyzed generation (N). Means
+// are rounded to whole numbers, as they are reported.
+type NumAncestorsResult struct {
+	TotalAgents int
+	Agents      int
+	// Generations back that ancestors are counted, fewer than the generation
+	// if the ancestors stored are limited
+	Depth int
+	// Number of ancestors an agent would have without pedigree collapse
+	MaxPossible float64
+	Min         int
+	Max         int
+	Mean        float64
+}
+
+// Number of common ancestors of the pairs of agents in the analyzed
+// generation (C). When pairs are sampled the extremes are those of the sample
+// and the total and mean are estimates.
+type CommonAncestorsResult struct {
+	Min   int
+	Max   int
+	Total int
+	Mean  float64
+	// Number of pairs sampled, 0 if every pair is compared
+	Samples int
+}
+
+// Number of generations back to the nearest common ancestor of the pairs of
+// agents in the analyzed generation (D)
+type GenerationDiffResult struct {
+	Min   int
+	Max   int
+	Total int
+	Mean  float64
+}
+
+// Gene statistics of one generation (G)
+type GeneResult struct {
+	Generation int
+	// Number of copies of each gene in the generation
+	GeneCounts map[string]int
+	// Number of genes in the generation that come from each founder
+	FounderCounts          map[int]int
+	MostCommonGene         string
+	MostCommonGeneCount    int
+	MostCommonFounder      int
+	MostCommonFounderCount int
+}
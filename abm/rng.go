@@ -0,0 +1,148 @@
+// Random number streams.
+//
+// Every random number a simulation uses is drawn from a stream derived from
+// the simulation's seed and a stream index, never from the global math/rand
+// source. Stream 0 creates the founders (their sexes) in NewSimulation, from
+// Parameters.FounderSeed instead if it is set.
+// Stream g is used for everything random while generation g is made: the
+// deaths in and shuffle of the current generation, the number of children with the Random
+// growth strategy, the choice of parents and the sex, inherited genes and
+// mutations of each child. Because each stream only depends on the seed and
+// its index, the generations of a simulation can be reproduced no matter
+// how many simulations run at once, and parallel workers that each use
+// their own stream from WorkerRng produce the same numbers regardless of
+// how they are scheduled. Analyses that sample at random have streams of
+// their own, so that running them doesn't change the simulation.
+//
+// By default the streams are math/rand generators, whose sequences aren't
+// guaranteed to stay the same across Go versions. With Parameters.StableRng
+// they are instead xoshiro256** generators implemented here, seeded with
+// SplitMix64, so that a seed produces the same simulation forever.
+
+package abm
+
+import (
+	"math/bits"
+	"math/rand"
+)
+
+// Source of the random numbers used by a simulation. *rand.Rand implements
+// it.
+type Rng interface {
+	Float64() float64
+	Intn(n int) int
+	Int63() int64
+	Shuffle(n int, swap func(i, j int))
+}
+
+const (
+	// Stream used to create the founding generation
+	founderStream uint64 = 0
+	// First stream used by parallel workers, well clear of the generations
+	workerStream uint64 = 1 << 62
+	// Stream used to sample pairs for mean kinship
+	kinshipStream uint64 = 1<<62 - 1
+	// Stream used to trace gene lineages for the coalescent expectations
+	coalescentStream uint64 = 1<<62 - 2
+	// Stream used to sample pairs for the common ancestors analysis
+	commonAncestorStream uint64 = 1<<62 - 3
+	// Stream used to give the founders' haplotypes nucleotide sequences
+	haplotypeStream uint64 = 1<<62 - 4
+	// Stream used to draw the founders' phenotypes
+	phenotypeStream uint64 = 1<<62 - 5
+)
+
+// SplitMix64 finalizer, used to scramble seeds and stream indices into
+// well-distributed, independent seeds
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Creates the random number generator for a stream of a seed
+func substream(seed int64, stream uint64, stable bool) Rng {
+	mixed := splitmix64(uint64(seed) ^ splitmix64(stream))
+	if stable {
+		return newStableRng(mixed)
+	}
+	return rand.New(rand.NewSource(int64(mixed)))
+}
+
+// Creates the random number generator for a stream of the simulation's seed
+func (s *Simulation) substream(stream uint64) Rng {
+	return substream(s.seed, stream, s.params.StableRng)
+}
+
+// Returns a random number generator for a parallel worker. Each worker gets
+// its own deterministic stream so that randomized parallel work is
+// reproducible from the simulation seed.
+func (s *Simulation) WorkerRng(worker int) Rng {
+	return s.substream(workerStream + uint64(worker))
+}
+
+// The xoshiro256** generator of Blackman and Vigna. Every method's algorithm
+// is fixed, so the numbers it produces never change.
+type stableRng struct {
+	state [4]uint64
+}
+
+// Seeds the generator's state with the first four outputs of SplitMix64
+// started at seed
+func newStableRng(seed uint64) *stableRng {
+	var r stableRng
+	for i := range r.state {
+		r.state[i] = splitmix64(seed + uint64(i)*0x9e3779b97f4a7c15)
+	}
+	return &r
+}
+
+// Returns the next 64 random bits
+func (r *stableRng) Uint64() uint64 {
+	s := &r.state
+	result := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+	return result
+}
+
+// Returns a non-negative number from the top 63 bits
+func (r *stableRng) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// Returns a number in [0, 1) from the top 53 bits
+func (r *stableRng) Float64() float64 {
+	return float64(r.Uint64()>>11) * 0x1p-53
+}
+
+// Returns a number in [0, n) without bias using Lemire's multiply and
+// reject method. Panics if n <= 0.
+func (r *stableRng) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+	bound := uint64(n)
+	hi, lo := bits.Mul64(r.Uint64(), bound)
+	if lo < bound {
+		threshold := -bound % bound
+		for lo < threshold {
+			hi, lo = bits.Mul64(r.Uint64(), bound)
+		}
+	}
+	return int(hi)
+}
+
+// Shuffles n elements with the Fisher-Yates algorithm, working down from
+// the last element
+func (r *stableRng) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
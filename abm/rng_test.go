@@ -0,0 +1,169 @@
+package abm
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"hash/fnv"
+	"sync"
+	"testing"
+)
+
+// Hashes everything random about the agents of a simulation
+func fingerprint(s *Simulation) uint64 {
+	h := fnv.New64a()
+	for _, agent := range s.agents {
+		fmt.Fprintf(h, "%d,%d,%d,%d,%v;", agent.id, agent.sex, agent.mother, agent.father, agent.genes)
+	}
+	return h.Sum64()
+}
+
+func TestParallelMatchesSerial(t *testing.T) {
+	var batch []Parameters
+	for i := range 4 {
+		p := NewParameters()
+		p.SimulationId = i
+		p.NumAgents = 50
+		p.Generations = 10
+		p.MutationRate = 0.01
+		p.Seed = int64(100 + i)
+		batch = append(batch, p)
+	}
+	serial := make(map[int]uint64)
+	for _, p := range batch {
+		simulation := NewSimulation(&p)
+		assert.Nil(t, simulation.Simulate(), "Serial simulation succeeds")
+		serial[p.SimulationId] = fingerprint(simulation)
+	}
+	parallel := make(map[int]uint64)
+	var mu sync.Mutex
+	RunBatch(context.Background(), batch, func(r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Nil(t, r.Err, "Parallel simulation succeeds")
+		parallel[r.SimulationId] = fingerprint(r.Simulation)
+	})
+	assert.Equal(t, serial, parallel, "Parallel runs match serial runs")
+}
+
+func TestSameSeedSameAgents(t *testing.T) {
+	p := NewParameters()
+	p.NumAgents = 30
+	p.Generations = 8
+	p.MutationRate = 0.05
+	p.Seed = 77
+	a, b := NewSimulation(&p), NewSimulation(&p)
+	assert.Nil(t, a.Simulate(), "First simulation succeeds")
+	assert.Nil(t, b.Simulate(), "Second simulation succeeds")
+	assert.Equal(t, a.agents, b.agents, "Same seed gives identical agents")
+
+	p.Seed = 0
+	c := NewSimulation(&p)
+	assert.NotEqual(t, int64(0), c.Seed(), "Seed chosen when none is given")
+	p.Seed = c.Seed()
+	assert.Nil(t, c.Simulate(), "Simulation with chosen seed succeeds")
+	replay := NewSimulation(&p)
+	assert.Nil(t, replay.Simulate(), "Replay succeeds")
+	assert.Equal(t, c.agents, replay.agents, "Chosen seed replays the run")
+}
+
+func TestWorkerRngReproducible(t *testing.T) {
+	p := NewParameters()
+	p.Seed = 42
+	simulation := NewSimulation(&p)
+	a := simulation.WorkerRng(3)
+	b := simulation.WorkerRng(3)
+	c := simulation.WorkerRng(4)
+	x, y, z := a.Int63(), b.Int63(), c.Int63()
+	assert.Equal(t, x, y, "Same worker stream gives same numbers")
+	assert.NotEqual(t, x, z, "Different worker streams differ")
+}
+
+func TestStableRngReferenceOutputs(t *testing.T) {
+	r := &stableRng{[4]uint64{1, 2, 3, 4}}
+	// First outputs of the reference xoshiro256** implementation for this state
+	assert.Equal(t, uint64(11520), r.Uint64(), "First output")
+	assert.Equal(t, uint64(0), r.Uint64(), "Second output")
+	assert.Equal(t, uint64(1509978240), r.Uint64(), "Third output")
+}
+
+func TestStableRngGolden(t *testing.T) {
+	p := NewParameters()
+	p.NumAgents = 30
+	p.Generations = 8
+	p.MutationRate = 0.05
+	p.MutationModel = NUCLEOTIDE
+	p.Seed = 2024
+	p.StableRng = true
+	simulation := NewSimulation(&p)
+	assert.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	// Must never change: results published with a stable seed depend on it
+	assert.Equal(t, uint64(0x109cc85a4ee2a65e), fingerprint(simulation), "Golden fingerprint")
+}
+
+// Rng that returns scripted integers, so that tests can force the choices a
+// simulation makes. Float64 always returns float, and Shuffle leaves the
+// order as it is.
+type scriptedRng struct {
+	ints  []int
+	float float64
+}
+
+func (r *scriptedRng) Float64() float64 {
+	return r.float
+}
+
+func (r *scriptedRng) Intn(n int) int {
+	if len(r.ints) == 0 {
+		panic("scripted rng has no integers left")
+	}
+	i := r.ints[0]
+	r.ints = r.ints[1:]
+	if i < 0 || i >= n {
+		panic(fmt.Sprintf("scripted integer %d not in range 0 to %d", i, n-1))
+	}
+	return i
+}
+
+func (r *scriptedRng) Int63() int64 {
+	return 0
+}
+
+func (r *scriptedRng) Shuffle(n int, swap func(i, j int)) {}
+
+func TestScriptedMating(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 4
+	parameters.NumGenes = 2
+	parameters.GrowthRate = 1.0
+	parameters.Strategy = CEIL
+	simulation := NewSimulation(&parameters)
+	// Each child's father then mother is picked, and with Float64 0 every
+	// child is male and inherits its father's genes
+	simulation.rng = &scriptedRng{ints: []int{0, 1, 2, 3, 3, 0, 1, 2}}
+	assert.Nil(t, simulation.anyMating(1), "Mating succeeds")
+	var parents [][2]int
+	for _, child := range simulation.agents[4:] {
+		parents = append(parents, [2]int{child.father, child.mother})
+		assert.Equal(t, MALE, child.sex, "Scripted sex")
+		assert.Equal(t, simulation.agents[child.father].genes, child.genes, "Genes of the father")
+	}
+	assert.Equal(t, [][2]int{{0, 1}, {2, 3}, {3, 0}, {1, 2}}, parents, "Scripted parents")
+	assert.Equal(t, []int{4, 6}, simulation.agents[0].children, "Children of agent 0")
+
+	parameters.Monogamous = true
+	parameters.Compatible = true
+	simulation = NewSimulation(&parameters)
+	for i := range simulation.agents {
+		simulation.agents[i].sex = Sex(i % 2)
+	}
+	// Agents are paired in order, 0 with 1 and 2 with 3, and then the pair of
+	// each child is picked
+	simulation.rng = &scriptedRng{ints: []int{1, 0, 1, 1}}
+	assert.Nil(t, simulation.monogamousMating(1), "Mating succeeds")
+	parents = nil
+	for _, child := range simulation.agents[4:] {
+		parents = append(parents, [2]int{child.father, child.mother})
+	}
+	assert.Equal(t, [][2]int{{2, 3}, {0, 1}, {2, 3}, {2, 3}}, parents, "Scripted pairs")
+}
@@ -0,0 +1,40 @@
+// Counting the sexes, so that a mating pool of only one sex is reported as
+// such rather than as a failure to pair.
+
+package abm
+
+// Returns the number of males and females in a generation. With more than two
+// mating types agents of the other types are in neither count.
+func (s *Simulation) SexCounts(gen int) (males, females int) {
+	for _, agent := range s.Generation(gen) {
+		switch agent.sex {
+		case MALE:
+			males++
+		case FEMALE:
+			females++
+		}
+	}
+	return males, females
+}
+
+// Returns a SexImbalance error if mating needs agents of different sexes and
+// every agent of the mating pool for the given generation has the same sex
+func (s *Simulation) checkSexBalance(generation int) error {
+	if s.params.MateSameSex || !(s.params.Monogamous || s.params.Compatible) || len(s.currGen) == 0 {
+		return nil
+	}
+	sex := s.agents[s.currGen[0].id].sex
+	for _, selected := range s.currGen {
+		if s.agents[selected.id].sex != sex {
+			return nil
+		}
+	}
+	err := &SimError{SimID: s.id, Generation: generation, Kind: SexImbalance, Agents: len(s.currGen)}
+	switch sex {
+	case MALE:
+		err.Males = len(s.currGen)
+	case FEMALE:
+		err.Females = len(s.currGen)
+	}
+	return err
+}
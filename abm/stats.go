@@ -0,0 +1,83 @@
+// Timing and resource statistics for tracking performance.
+
+package abm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// How long one of the selected analyses took
+type AnalysisTime struct {
+	Analysis string
+	Duration time.Duration
+}
+
+// Machine-readable timing and resource statistics of a simulation. Times are
+// in seconds.
+type RunStats struct {
+	SimulationId      int                `json:"simulation_id"`
+	GenerationSeconds []float64          `json:"generation_seconds"`
+	AnalysisSeconds   map[string]float64 `json:"analysis_seconds"`
+	// Bytes of memory obtained from the operating system, which the Go
+	// runtime doesn't return, so this is the high-water mark of the process
+	PeakMemoryBytes     uint64 `json:"peak_memory_bytes"`
+	TotalAgents         int    `json:"total_agents"`
+	FinalPopulationSize int    `json:"final_population_size"`
+}
+
+// Returns the timing and resource statistics of the simulation so far. The
+// generation times are in the order the generations were made and there is
+// one for every generation after the founders.
+func (s *Simulation) Stats() RunStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RunStats{
+		SimulationId:      s.id,
+		GenerationSeconds: make([]float64, 0, len(s.genTimes)),
+		AnalysisSeconds:   make(map[string]float64, len(s.analysisTimes)),
+		PeakMemoryBytes:   mem.Sys,
+		TotalAgents:       len(s.agents),
+	}
+	for _, d := range s.genTimes {
+		stats.GenerationSeconds = append(stats.GenerationSeconds, d.Seconds())
+	}
+	for _, a := range s.analysisTimes {
+		stats.AnalysisSeconds[a.Analysis] += a.Duration.Seconds()
+	}
+	if len(s.genBdrys) > 0 {
+		stats.FinalPopulationSize = len(s.agents) - s.genStart(len(s.genBdrys)-1)
+	}
+	return stats
+}
+
+// Writes the timing and resource statistics of the simulation as one JSON
+// document
+func (s *Simulation) WriteStatsJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.Stats())
+}
+
+// Writes how long the simulation took to make its generations and how long
+// each selected analysis took, one line each, in seconds
+func (s *Simulation) WriteTimings(w io.Writer) error {
+	total := time.Duration(0)
+	for _, d := range s.genTimes {
+		total += d
+	}
+	if _, err := fmt.Fprintf(w, "%d, timing, simulate, generations, %d, seconds, %.6f\n",
+		s.id, len(s.genTimes), total.Seconds()); err != nil {
+		return err
+	}
+	for _, a := range s.analysisTimes {
+		if _, err := fmt.Fprintf(w, "%d, timing, analysis, %s, seconds, %.6f\n",
+			s.id, a.Analysis, a.Duration.Seconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
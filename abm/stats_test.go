@@ -0,0 +1,52 @@
+package abm
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestWriteStatsJSON(t *testing.T) {
+	parameters := NewParameters()
+	parameters.NumAgents = 20
+	parameters.Generations = 5
+	parameters.Analysis = "NC"
+	parameters.Seed = 3
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	_, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteStatsJSON(&buf), "Stats are written")
+	var stats RunStats
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &stats), "Stats are valid JSON")
+	assert.Equal(t, 5, len(stats.GenerationSeconds), "One time per generation")
+	assert.Contains(t, stats.AnalysisSeconds, "N", "Selected analysis is timed")
+	assert.NotContains(t, stats.AnalysisSeconds, "D", "Unselected analysis is not timed")
+	assert.Equal(t, len(simulation.agents), stats.TotalAgents, "Total agents")
+	assert.Equal(t, len(simulation.currGen), stats.FinalPopulationSize, "Final population size")
+	assert.Greater(t, stats.PeakMemoryBytes, uint64(0), "Memory is measured")
+}
+
+func TestWriteTimings(t *testing.T) {
+	parameters := NewParameters()
+	parameters.SimulationId = 2
+	parameters.NumAgents = 20
+	parameters.Generations = 5
+	parameters.Analysis = "NC"
+	parameters.Seed = 3
+	simulation := NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	_, err := simulation.Analysis()
+	require.Nil(t, err, "Analysis succeeds")
+	var buf bytes.Buffer
+	require.Nil(t, simulation.WriteTimings(&buf), "Timings are written")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 3, len(lines), "One line for simulating and one per analysis")
+	assert.True(t, strings.HasPrefix(lines[0], "2, timing, simulate, generations, 5, seconds, "), "Simulation is timed")
+	assert.True(t, strings.HasPrefix(lines[1], "2, timing, analysis, N, seconds, "), "First analysis is timed")
+	assert.True(t, strings.HasPrefix(lines[2], "2, timing, analysis, C, seconds, "), "Second analysis is timed")
+}
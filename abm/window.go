@@ -0,0 +1,40 @@
+// Smoothing per-generation series over a rolling window of generations.
+
+package abm
+
+// Mean of the last values added, up to a window of them
+type RollingMean struct {
+	window int
+	values []float64
+}
+
+// Creates a rolling mean over the given number of values. A window of less
+// than 1 is treated as 1, i.e. no smoothing.
+func NewRollingMean(window int) *RollingMean {
+	return &RollingMean{window: max(window, 1)}
+}
+
+// Adds a value and returns the mean of the values in the window, which holds
+// fewer values than its size until enough have been added
+func (r *RollingMean) Add(x float64) float64 {
+	if len(r.values) == r.window {
+		r.values = r.values[1:]
+	}
+	r.values = append(r.values, x)
+	total := 0.0
+	for _, v := range r.values {
+		total += v
+	}
+	return total / float64(len(r.values))
+}
+
+// Returns the rolling mean of each value of a series over the window of
+// values ending with it
+func RollingMeans(series []float64, window int) []float64 {
+	rolling := NewRollingMean(window)
+	means := make([]float64, len(series))
+	for i, x := range series {
+		means[i] = rolling.Add(x)
+	}
+	return means
+}
@@ -0,0 +1,17 @@
+package abm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRollingMeans(t *testing.T) {
+	series := []float64{4, 8, 6, 2, 10, 0}
+	// Manual moving averages over up to the last three values
+	expected := []float64{4, (4 + 8) / 2.0, (4 + 8 + 6) / 3.0, (8 + 6 + 2) / 3.0,
+		(6 + 2 + 10) / 3.0, (2 + 10 + 0) / 3.0}
+	assert.InDeltaSlice(t, expected, RollingMeans(series, 3), 1e-12, "Window of three")
+	assert.Equal(t, series, RollingMeans(series, 1), "Window of one doesn't smooth")
+	assert.Equal(t, series, RollingMeans(series, 0), "No window doesn't smooth")
+	assert.InDelta(t, 5.0, RollingMeans(series, 10)[5], 1e-12, "Window longer than series")
+}
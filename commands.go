@@ -0,0 +1,158 @@
+// Subcommands that work on simulations saved with -json instead of running
+// new ones.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nathangeffen/ancestry/abm"
+	"io"
+	"os"
+)
+
+// Splits the subcommand, run, analyze or export, from its arguments. Without
+// one the arguments are for run, so that the program works as it did before
+// there were subcommands.
+func subcommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run", "analyze", "export":
+			return args[0], args[1:]
+		}
+	}
+	return "run", args
+}
+
+// Options of the analyze subcommand
+type analyzeOptions struct {
+	input      string
+	analysis   string
+	analyzeGen int
+	timing     bool
+}
+
+// Defines the analyze flags in fs and parses args with them
+func parseAnalyzeFlags(fs *flag.FlagSet, args []string) (analyzeOptions, error) {
+	var opts analyzeOptions
+	fs.StringVar(&opts.input, "input", opts.input, "JSON file of a simulation saved with -json")
+	fs.StringVar(&opts.analysis, "analysis", opts.analysis,
+		"Analyses to do, as for run (default the analyses of the saved simulation)")
+	fs.IntVar(&opts.analyzeGen, "analyzegen", opts.analyzeGen,
+		"Generation to do ancestry analyses on (0 for last generation)")
+	fs.BoolVar(&opts.timing, "timing", opts.timing, "Print how long each analysis took")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.input == "" {
+		return opts, errors.New("analyze-err, -input is required")
+	}
+	return opts, nil
+}
+
+// Options of the export subcommand
+type exportOptions struct {
+	input   string
+	gedcom  string
+	csv     string
+	format  string
+	dot     string
+	dotGens int
+}
+
+// Defines the export flags in fs and parses args with them
+func parseExportFlags(fs *flag.FlagSet, args []string) (exportOptions, error) {
+	opts := exportOptions{format: "csv"}
+	fs.StringVar(&opts.input, "input", opts.input, "JSON file of a simulation saved with -json")
+	fs.StringVar(&opts.gedcom, "gedcom", opts.gedcom,
+		"File to write the pedigree to in GEDCOM format for genealogy programs")
+	fs.StringVar(&opts.csv, "csv", opts.csv, "File to write one row per agent to in -format for spreadsheets")
+	fs.StringVar(&opts.format, "format", opts.format, "Format of the -csv file (csv, tsv, json)")
+	fs.StringVar(&opts.dot, "dot", opts.dot, "File to write the pedigree to as a Graphviz digraph")
+	fs.IntVar(&opts.dotGens, "dotgens", opts.dotGens, "Number of generations to draw with -dot (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.input == "" {
+		return opts, errors.New("export-err, -input is required")
+	}
+	if opts.gedcom == "" && opts.csv == "" && opts.dot == "" {
+		return opts, errors.New("export-err, one of -gedcom, -csv or -dot is required")
+	}
+	if err := checkFormat(opts.format); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// Reads a simulation saved with -json
+func loadSimulation(path string) (*abm.Simulation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return abm.LoadSimulation(f)
+}
+
+// Analyzes a saved simulation
+func analyze(args []string) {
+	opts, err := parseAnalyzeFlags(flag.NewFlagSet("analyze", flag.ExitOnError), args)
+	if err == nil {
+		err = analyzeSimulation(opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+}
+
+func analyzeSimulation(opts analyzeOptions) error {
+	simulation, err := loadSimulation(opts.input)
+	if err != nil {
+		return err
+	}
+	if err := simulation.SetAnalysis(opts.analysis, opts.analyzeGen); err != nil {
+		return err
+	}
+	_, err = simulation.Analysis()
+	if opts.timing {
+		if err := simulation.WriteTimings(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Writes a saved simulation in other formats
+func export(args []string) {
+	opts, err := parseExportFlags(flag.NewFlagSet("export", flag.ExitOnError), args)
+	if err == nil {
+		err = exportSimulation(opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+}
+
+func exportSimulation(opts exportOptions) error {
+	simulation, err := loadSimulation(opts.input)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if opts.gedcom != "" {
+		errs = append(errs, writeFile(opts.gedcom, simulation.WriteGEDCOM))
+	}
+	if opts.csv != "" {
+		errs = append(errs, writeFile(opts.csv, agentsWriter(simulation, opts.format)))
+	}
+	if opts.dot != "" {
+		errs = append(errs, writeFile(opts.dot, func(w io.Writer) error {
+			return simulation.WriteDOT(w, opts.dotGens)
+		}))
+	}
+	return errors.Join(errs...)
+}
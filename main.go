@@ -1,63 +1,502 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/nathangeffen/ancestry/abm"
+	"io"
+	"math"
 	"os"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"unsafe"
 )
 
+// Command line options that control the program rather than a simulation
+type options struct {
+	numSims     int
+	mostRelated bool
+	rawPairs    string
+	mrcaHubs    int
+	statsJSON   string
+	incremental bool
+	validate    bool
+	selfCheck   bool
+	trajectory  bool
+	frames      string
+	gedcom      string
+	json        string
+	csv         string
+	format      string
+	progress    bool
+	dot         string
+	dotGens     int
+	config      string
+	timing      bool
+	dryRun      bool
+	resume      string
+	aggregate   bool
+	// Simulation loaded from the -resume checkpoint
+	resumed *abm.Simulation
+}
+
+// Returns the path a simulation should write an output file to. When more
+// than one simulation is run the simulation id is added before the extension
+// so that simulations don't overwrite each other's files.
+func outputPath(path string, simulationId, numSims int) string {
+	if numSims <= 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), simulationId, ext)
+}
+
+// Creates the file at path and calls write to fill it
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Returns an error unless format is one that the agents file can be written
+// in
+func checkFormat(format string) error {
+	switch format {
+	case "csv", "tsv", "json":
+		return nil
+	}
+	return fmt.Errorf("format-err, %q is not csv, tsv or json", format)
+}
+
+// Returns the function that writes the agents of the simulation in the given
+// format: a row per agent separated by commas or tabs, or the whole
+// simulation as JSON
+func agentsWriter(simulation *abm.Simulation, format string) func(io.Writer) error {
+	switch format {
+	case "tsv":
+		return func(w io.Writer) error {
+			return simulation.WriteAgents(w, '\t')
+		}
+	case "json":
+		return simulation.WriteJSON
+	default:
+		return simulation.WriteAgentsCSV
+	}
+}
+
 // Process the command line arguments and return values set in
 // parameters struct.
-func processFlags() (abm.Parameters, int) {
+func processFlags(args []string) (abm.Parameters, options) {
+	p, opts, err := parseFlags(flag.CommandLine, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+	return p, opts
+}
+
+// Defines the flags in fs and parses args with them. Parameters are read from
+// the -config file or the -resume checkpoint, if there is one, and then flags
+// given in args override them.
+func parseFlags(fs *flag.FlagSet, args []string) (abm.Parameters, options, error) {
 	params := abm.NewParameters()
 	var p abm.Parameters
 	p.Strategy = params.Strategy
-	flag.IntVar(&p.SimulationId, "id", params.SimulationId, "Id of simulation")
-	flag.IntVar(&p.NumAgents, "agents", params.NumAgents, "Number of agents")
-	flag.IntVar(&p.Generations, "generations", params.Generations, "Number of generations to run for")
-	flag.Float64Var(&p.GrowthRate, "growth", params.GrowthRate, "Growth rate of population")
-	flag.Var(&p.Strategy, "strat", "Growth strategy (random, floor, ceil, round")
-	flag.BoolVar(&p.Monogamous, "monog", params.Monogamous, "Agents are monogamous")
-	flag.IntVar(&p.MatingK, "matingk", params.MatingK, "Number of agents to search for compatible match")
-	flag.BoolVar(&p.Compatible, "compatible", params.Compatible, "Switch off all mating compatibility checks if false")
-	flag.BoolVar(&p.MateSelf, "mateself", params.MateSelf, "Agents can mate with themselves")
-	flag.BoolVar(&p.MateSibling, "matesibling", params.MateSibling, "Agents can mate with siblings")
-	flag.BoolVar(&p.MateCousin, "matecousin", params.MateCousin, "Agents can mate with cousins")
-	flag.BoolVar(&p.MateSameSex, "matesamesex", params.MateSameSex, "Agents can mate with same sex")
-	flag.IntVar(&p.NumGenes, "genes", params.NumGenes, "Number of genes per agent in initial generation")
-	flag.Float64Var(&p.MutationRate, "mutation", params.MutationRate, "Gene mutation rate")
-	flag.StringVar(&p.Analysis, "analysis", params.Analysis,
-		`N - Number of ancestors
-C - Number of common ancestors
-D - Generation differences
-G - Gene analysis
-g - Only do gene analysis on last generation`)
-	numSims := 1
-	flag.IntVar(&numSims, "numsims", numSims, "Number of simulations to run (will be run in paralllel)")
-	flag.Parse()
-	return p, numSims
+	fs.IntVar(&p.SimulationId, "id", params.SimulationId, "Id of simulation")
+	fs.IntVar(&p.NumAgents, "agents", params.NumAgents, "Number of agents")
+	fs.IntVar(&p.Generations, "generations", params.Generations, "Number of generations to run for")
+	fs.Float64Var(&p.GrowthRate, "growth", params.GrowthRate, "Growth rate of population")
+	fs.Var(&p.Strategy, "strategy", "Growth strategy (random, floor, ceil, round, poisson)")
+	fs.Var(&p.Strategy, "strat", "Same as -strategy")
+	fs.BoolVar(&p.Monogamous, "monog", params.Monogamous, "Agents are monogamous")
+	p.Leftover = params.Leftover
+	fs.Var(&p.Leftover, "leftover", "Handling of agents left without a partner in monogamous mating (drop, retry-any, report-only)")
+	fs.IntVar(&p.MatingK, "matingk", params.MatingK, "Number of agents to search for compatible match")
+	fs.IntVar(&p.MaxOffspring, "maxoffspring", params.MaxOffspring,
+		"Largest number of children an agent can have under non-monogamous mating (0 for no limit)")
+	fs.BoolVar(&p.Compatible, "compatible", params.Compatible, "Switch off all mating compatibility checks if false")
+	fs.BoolVar(&p.MateSelf, "mateself", params.MateSelf, "Agents can mate with themselves")
+	fs.BoolVar(&p.MateSibling, "matesibling", params.MateSibling, "Agents can mate with siblings")
+	fs.BoolVar(&p.MateCousin, "matecousin", params.MateCousin, "Agents can mate with cousins")
+	fs.BoolVar(&p.MateSameSex, "matesamesex", params.MateSameSex, "Agents can mate with same sex")
+	fs.BoolVar(&p.AssortativeMating, "assortative", params.AssortativeMating,
+		"Compatible non-monogamous agents mate with the candidate sharing the most genes")
+	fs.BoolVar(&p.AvoidInbreeding, "avoidinbreeding", params.AvoidInbreeding,
+		"Compatible non-monogamous agents mate with the least related candidate")
+	fs.IntVar(&p.NumMatingTypes, "matingtypes", params.NumMatingTypes,
+		"Number of mating types instead of two sexes (2 or less for male and female)")
+	fs.IntVar(&p.NumGenes, "genes", params.NumGenes, "Number of genes per agent in initial generation")
+	fs.IntVar(&p.FounderFamilies, "founderfamilies", params.FounderFamilies,
+		"Number of families of founders sharing alleles at half the loci (1 or less for unrelated founders)")
+	fs.BoolVar(&p.Diploid, "diploid", params.Diploid,
+		"Give agents two alleles per gene, one inherited from each parent")
+	fs.IntVar(&p.FitnessGene, "fitnessgene", params.FitnessGene,
+		"Gene, counted from 0, whose mutated alleles change fitness with -fitnessadvantage")
+	fs.Float64Var(&p.FitnessAdvantage, "fitnessadvantage", params.FitnessAdvantage,
+		"Fitness advantage of agents carrying a mutated allele of -fitnessgene (0 for no selection)")
+	fs.Float64Var(&p.EnvVariance, "envvariance", params.EnvVariance,
+		"Variance of the environmental noise added to the mean of the parents' phenotypes")
+	fs.Float64Var(&p.MutationRate, "mutation", params.MutationRate, "Gene mutation rate")
+	p.MutationModel = params.MutationModel
+	fs.Var(&p.MutationModel, "mutationmodel", "Mutation model (backtick, infinite, nucleotide)")
+	fs.Float64Var(&p.HaplotypeMutationRate, "haplomutation", params.HaplotypeMutationRate,
+		"Mutation rate of the uniparental markers, such as the Y haplotype")
+	fs.IntVar(&p.GeneLength, "genelength", params.GeneLength, "Number of nucleotides per gene with the nucleotide mutation model")
+	fs.Float64Var(&p.TsTvRatio, "tstv", params.TsTvRatio, "Ratio of transitions to transversions with the nucleotide mutation model")
+	fs.Float64Var(&p.MortalityRate, "mortality", params.MortalityRate,
+		"Probability that an agent dies before it can reproduce")
+	fs.BoolVar(&p.Overlap, "overlap", params.Overlap,
+		"Agents of earlier generations that haven't died can mate with the newest generation")
+	fs.IntVar(&p.FertilityMin, "fertilitymin", params.FertilityMin,
+		"Youngest age in generations at which agents can mate")
+	fs.IntVar(&p.FertilityMax, "fertilitymax", params.FertilityMax,
+		"Oldest age in generations at which agents can mate, so that generations overlap if above 0 (0 for no limit with -overlap)")
+	fs.Int64Var(&p.Seed, "seed", params.Seed, "Seed for random numbers (0 for a random seed)")
+	fs.Int64Var(&p.FounderSeed, "founderseed", params.FounderSeed,
+		"Seed for the founders, so that simulations share them (0 to use -seed)")
+	fs.BoolVar(&p.StableRng, "stablerng", params.StableRng,
+		"Use a random number generator whose results never change across Go versions")
+	fs.StringVar(&p.Analysis, "analysis", params.Analysis, abm.AnalysisHelp())
+	fs.IntVar(&p.AnalysisGen, "analyzegen", params.AnalysisGen,
+		"Generation to do ancestry analyses on (0 for last generation)")
+	fs.IntVar(&p.CommonAncestorSamples, "casamples", params.CommonAncestorSamples,
+		"Number of random pairs of agents to estimate common ancestors from (0 for every pair)")
+	fs.IntVar(&p.MaxAncestorDepth, "maxdepth", params.MaxAncestorDepth,
+		"Number of generations back to search for ancestors (0 for all)")
+	fs.IntVar(&p.AncestorCacheDepth, "ancestorcache", params.AncestorCacheDepth,
+		"Number of generations of ancestors stored per agent to save memory (0 for all)")
+	fs.BoolVar(&p.IncrementalAncestors, "incancestors", params.IncrementalAncestors,
+		"Build each analyzed agent's ancestors from its parents' ancestors instead of searching the pedigree")
+	fs.IntVar(&p.MaxPopulation, "maxpop", params.MaxPopulation,
+		"Stop with an error instead of making a generation that takes the number of agents over this (0 for no limit)")
+	fs.IntVar(&p.KeepGenerations, "keepgens", params.KeepGenerations,
+		"Keep only this many of the latest generations to bound memory, disabling the ancestry analyses (0 for all, else at least 3)")
+	fs.IntVar(&p.Window, "window", params.Window,
+		"Also report rolling means of the per-generation series over this many generations")
+	opts := options{numSims: 1, format: "csv"}
+	fs.IntVar(&opts.numSims, "numsims", opts.numSims, "Number of simulations to run (will be run in paralllel)")
+	fs.BoolVar(&opts.mostRelated, "mostrelated", opts.mostRelated,
+		"Print the most and least related pairs of agents in the last generation")
+	fs.IntVar(&opts.mrcaHubs, "mrcahubs", opts.mrcaHubs,
+		"Print this many ancestors that are most often the most recent common ancestor of a pair")
+	fs.StringVar(&opts.rawPairs, "rawpairs", opts.rawPairs,
+		"Write common ancestors and generation difference of every pair of agents to this CSV file")
+	fs.StringVar(&opts.statsJSON, "statsjson", opts.statsJSON,
+		"Write timing and memory statistics to this JSON file")
+	fs.BoolVar(&opts.aggregate, "aggregate", opts.aggregate,
+		"Print the mean and variance of the main analysis results over all the simulations")
+	fs.BoolVar(&opts.timing, "timing", opts.timing,
+		"Print how long simulating and each analysis took")
+	fs.BoolVar(&opts.incremental, "incremental", opts.incremental,
+		"Print population size and number of alleles of each generation as soon as it is made")
+	fs.Float64Var(&p.SexRatio, "sexratio", params.SexRatio,
+		"Probability that an agent is born male, from 0 to 1")
+	fs.BoolVar(&p.Coalescent, "coalescent", params.Coalescent,
+		"Also print the coalescent expectations with the C and D analyses")
+	fs.Float64Var(&p.EffectiveSize, "ne", params.EffectiveSize,
+		"Effective population size for -coalescent (0 for the harmonic mean of the generation sizes)")
+	fs.Float64Var(&p.MatingRadius, "matingradius", params.MatingRadius,
+		"Largest distance in a unit square between agents that can mate (0 for no spatial structure)")
+	fs.Float64Var(&p.Dispersal, "dispersal", params.Dispersal,
+		"Largest distance a child is placed from its parents' midpoint in each direction with -matingradius")
+	fs.IntVar(&p.MigrationInterval, "migrationinterval", params.MigrationInterval,
+		"Run the simulations as islands that exchange migrants every this many generations (0 for none)")
+	fs.Float64Var(&p.MigrationRate, "migrationrate", params.MigrationRate,
+		"Fraction of each island's agents that migrate to the next island with -migrationinterval")
+	fs.BoolVar(&p.IncrementalKinship, "inckinship", params.IncrementalKinship,
+		"Also print mean kinship of each generation with -incremental")
+	fs.BoolVar(&opts.progress, "progress", opts.progress,
+		"Print each generation to stderr as it is made")
+	fs.BoolVar(&opts.validate, "validate", opts.validate,
+		"Check that the pedigree is well formed before analyzing it")
+	fs.BoolVar(&opts.selfCheck, "selfcheck", opts.selfCheck,
+		"Check the simulation's invariants after simulating and again after analyzing it")
+	fs.BoolVar(&opts.trajectory, "trajectory", opts.trajectory,
+		"Print the number of agents in each generation")
+	fs.StringVar(&opts.frames, "frames", opts.frames,
+		"Write the agents and parent links added in each generation to this file as JSON lines")
+	fs.StringVar(&opts.gedcom, "gedcom", opts.gedcom,
+		"File to write the pedigree to in GEDCOM format for genealogy programs")
+	fs.StringVar(&opts.json, "json", opts.json,
+		"File to write the whole simulation to as JSON")
+	fs.StringVar(&opts.dot, "dot", opts.dot,
+		"File to write the pedigree to as a Graphviz digraph")
+	fs.IntVar(&opts.dotGens, "dotgens", opts.dotGens,
+		"Number of generations to draw with -dot (0 for all)")
+	fs.StringVar(&opts.csv, "csv", opts.csv,
+		"File to write one row per agent to in -format for spreadsheets")
+	fs.StringVar(&opts.format, "format", opts.format,
+		"Format of the -csv file (csv, tsv, json)")
+	fs.BoolVar(&opts.dryRun, "dryrun", opts.dryRun,
+		"Print the projected number of agents and memory of each simulation and exit without simulating")
+	fs.IntVar(&p.CheckpointEvery, "checkpointevery", params.CheckpointEvery,
+		"Write the simulation to -checkpoint every this many generations (0 for never)")
+	fs.StringVar(&p.CheckpointPath, "checkpoint", params.CheckpointPath,
+		"File to write checkpoints to with -checkpointevery")
+	fs.StringVar(&opts.resume, "resume", opts.resume,
+		"Checkpoint file to carry on simulating from, with the parameters it was saved with unless flags override them")
+	fs.StringVar(&opts.config, "config", opts.config,
+		"JSON file of parameters, named as in abm.Parameters, that the other flags override")
+	if err := fs.Parse(args); err != nil {
+		return p, opts, err
+	}
+	if opts.config != "" && opts.resume != "" {
+		return p, opts, fmt.Errorf("resume-err, -config and -resume can't both be given")
+	}
+	if opts.config != "" || opts.resume != "" {
+		if opts.config != "" {
+			loaded, err := abm.LoadParameters(opts.config)
+			if err != nil {
+				return p, opts, err
+			}
+			p = loaded
+		} else {
+			resumed, err := abm.ResumeSimulation(opts.resume)
+			if err != nil {
+				return p, opts, err
+			}
+			p, opts.resumed = resumed.Parameters(), resumed
+		}
+		// Parsing again sets the flags that were given over the loaded values
+		if err := fs.Parse(args); err != nil {
+			return p, opts, err
+		}
+	}
+	if _, err := abm.ParseAnalysis(p.Analysis); err != nil {
+		return p, opts, err
+	}
+	if err := checkFormat(opts.format); err != nil {
+		return p, opts, err
+	}
+	if opts.mrcaHubs < 0 {
+		return p, opts, fmt.Errorf("mrcahubs-err, %d is negative", opts.mrcaHubs)
+	}
+	if err := p.Validate(); err != nil {
+		return p, opts, err
+	}
+	return p, opts, nil
+}
+
+// Prints the number of agents each simulation is projected to end with and
+// roughly how much memory they take. Genes, children and cached ancestors
+// are left out of the memory, so it is a lower bound.
+func dryRun(w io.Writer, p abm.Parameters, numSims int) {
+	agents := p.ProjectedAgents()
+	size := int(unsafe.Sizeof(abm.Agent{}))
+	bytes := math.MaxInt
+	if agents <= math.MaxInt/size {
+		bytes = agents * size
+	}
+	fmt.Fprintf(w, "%d, dry-run, simulations, %d, agents, %d, bytes-per-agent, %d, bytes, %d\n",
+		p.SimulationId, numSims, agents, size, bytes)
 }
 
 func main() {
-	parameters, numSims := processFlags()
-	var wg sync.WaitGroup
-	for i := range numSims {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			p := parameters
-			p.SimulationId = parameters.SimulationId + i
-			simulation := abm.NewSimulation(&p)
-			if err := simulation.Simulate(); err != nil {
+	command, args := subcommand(os.Args[1:])
+	switch command {
+	case "analyze":
+		analyze(args)
+	case "export":
+		export(args)
+	default:
+		run(args)
+	}
+}
+
+// Simulates with the parameters in args and analyzes and writes out the
+// results
+func run(args []string) {
+	parameters, opts := processFlags(args)
+	if opts.dryRun {
+		dryRun(os.Stdout, parameters, opts.numSims)
+		return
+	}
+	resumed := opts.resumed
+	if resumed != nil {
+		opts.numSims = 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	batch := make([]abm.Parameters, opts.numSims)
+	for i := range batch {
+		batch[i] = parameters
+		batch[i].SimulationId = parameters.SimulationId + i
+		if parameters.Seed != 0 {
+			batch[i].Seed = parameters.Seed + int64(i)
+		}
+		if parameters.CheckpointPath != "" {
+			batch[i].CheckpointPath = outputPath(parameters.CheckpointPath, batch[i].SimulationId, opts.numSims)
+		}
+		if opts.incremental {
+			batch[i].OnGeneration = abm.PrintGenerationStats(batch[i].SimulationId, parameters.Window)
+		}
+	}
+	// The simulations send their analysis results to a single collector,
+	// which prints the summary once they have all finished
+	var results chan abm.AnalysisResult
+	aggregated := make(chan []abm.MetricSummary, 1)
+	if opts.aggregate {
+		results = make(chan abm.AnalysisResult)
+		go func() { aggregated <- abm.AggregateResults(results) }()
+	}
+	collect := func() {
+		if results != nil {
+			close(results)
+			abm.WriteAggregate(os.Stdout, <-aggregated)
+		}
+	}
+	emit := func(r abm.BatchResult) {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", r.Err)
+			return
+		}
+		simulation := r.Simulation
+		if opts.selfCheck {
+			if err := simulation.CheckInvariants(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return
+			}
+		}
+		if opts.gedcom != "" {
+			path := outputPath(opts.gedcom, r.SimulationId, opts.numSims)
+			if err := writeFile(path, simulation.WriteGEDCOM); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if opts.json != "" {
+			path := outputPath(opts.json, r.SimulationId, opts.numSims)
+			if err := writeFile(path, simulation.WriteJSON); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if opts.dot != "" {
+			path := outputPath(opts.dot, r.SimulationId, opts.numSims)
+			if err := writeFile(path, func(w io.Writer) error {
+				return simulation.WriteDOT(w, opts.dotGens)
+			}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if opts.csv != "" {
+			path := outputPath(opts.csv, r.SimulationId, opts.numSims)
+			if err := writeFile(path, agentsWriter(simulation, opts.format)); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if opts.validate {
+			if err := simulation.ValidatePedigree(); err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 				return
 			}
-			if err := simulation.Analysis(); err != nil {
+		}
+		result, err := simulation.Analysis()
+		if opts.statsJSON != "" {
+			path := outputPath(opts.statsJSON, r.SimulationId, opts.numSims)
+			if err := writeFile(path, simulation.WriteStatsJSON); err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 			}
-		}()
+		}
+		if opts.timing {
+			if err := simulation.WriteTimings(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return
+		}
+		if results != nil {
+			results <- result
+		}
+		if opts.selfCheck {
+			if err := simulation.CheckInvariants(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return
+			}
+		}
+		if opts.mostRelated {
+			a, b, shared := simulation.MostRelatedPair()
+			fmt.Printf("%d, most-related-pair, %d, %d, shared, %d\n", r.SimulationId, a, b, shared)
+			a, b, shared = simulation.LeastRelatedPair()
+			fmt.Printf("%d, least-related-pair, %d, %d, shared, %d\n", r.SimulationId, a, b, shared)
+		}
+		if opts.trajectory {
+			rolling := abm.NewRollingMean(parameters.Window)
+			for gen, size := range simulation.PopulationTrajectory() {
+				mean := rolling.Add(float64(size))
+				if parameters.Window > 1 {
+					fmt.Printf("%d, trajectory, generation, %d, size, %d, rolling-mean, %.1f\n",
+						r.SimulationId, gen, size, mean)
+				} else {
+					fmt.Printf("%d, trajectory, generation, %d, size, %d\n", r.SimulationId, gen, size)
+				}
+			}
+		}
+		if opts.mrcaHubs > 0 {
+			for i, hub := range simulation.MRCAHubs(parameters.AnalysisGen, opts.mrcaHubs) {
+				fmt.Printf("%d, mrca-hubs, rank, %d, agent, %d, generation, %d, pairs, %d\n",
+					r.SimulationId, i+1, hub.Ancestor, hub.Generation, hub.Pairs)
+			}
+		}
+		if opts.frames != "" {
+			path := outputPath(opts.frames, r.SimulationId, opts.numSims)
+			if err := writeFile(path, simulation.WriteReplayFrames); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+		if opts.rawPairs != "" {
+			path := outputPath(opts.rawPairs, r.SimulationId, opts.numSims)
+			if err := writeFile(path, func(w io.Writer) error {
+				return simulation.WriteRawPairs(w, parameters.AnalysisGen)
+			}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+	}
+	var setup func(*abm.Simulation)
+	if opts.progress {
+		setup = func(s *abm.Simulation) {
+			id := s.Id()
+			s.ProgressFunc = func(generation, numAgents int) {
+				fmt.Fprintf(os.Stderr, "%d, progress, generation, %d, of, %d, agents, %d\n",
+					id, generation, parameters.Generations, numAgents)
+			}
+		}
+	}
+	if resumed != nil {
+		if err := resumed.SetParameters(batch[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		if setup != nil {
+			setup(resumed)
+		}
+		err := resumed.SimulateContext(ctx)
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return
+		}
+		emit(abm.BatchResult{SimulationId: resumed.Id(), Simulation: resumed, Err: err})
+		collect()
+		return
+	}
+	var summary abm.BatchSummary
+	if parameters.MigrationInterval > 0 && opts.numSims > 1 {
+		summary = abm.RunIslandsSetup(ctx, batch, setup, emit)
+	} else {
+		summary = abm.RunBatchSetup(ctx, batch, setup, emit)
+	}
+	collect()
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "interrupted, completed, %d, failed, %d, cancelled, %d\n",
+			summary.Completed, summary.Failed, summary.Cancelled)
 	}
-	wg.Wait()
 }
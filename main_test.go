@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"github.com/nathangeffen/ancestry/abm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"NumAgents": 100, "Generations": 7, "Strategy": "ceil", "LogMatings": true}`
+	require.Nil(t, os.WriteFile(path, []byte(config), 0o644), "Config file is written")
+
+	fs := flag.NewFlagSet("ancestry", flag.ContinueOnError)
+	p, _, err := parseFlags(fs, []string{"-generations", "3", "-config", path, "-numsims", "2"})
+	require.Nil(t, err, "Flags parse")
+	assert.Equal(t, 100, p.NumAgents, "Config sets the number of agents")
+	assert.Equal(t, abm.CEIL, p.Strategy, "Config sets the strategy")
+	assert.True(t, p.LogMatings, "Config sets parameters without flags")
+	assert.Equal(t, 3, p.Generations, "Flags override the config")
+
+	fs = flag.NewFlagSet("ancestry", flag.ContinueOnError)
+	p, opts, err := parseFlags(fs, []string{"-agents", "10"})
+	require.Nil(t, err, "Flags parse without a config")
+	assert.Equal(t, 10, p.NumAgents, "Flag sets the number of agents")
+	assert.Equal(t, abm.NewParameters().Generations, p.Generations, "Generations keep their default")
+	assert.Equal(t, 1, opts.numSims, "Options keep their defaults")
+}
+
+func TestDryRun(t *testing.T) {
+	p := abm.NewParameters()
+	p.NumAgents = 10
+	p.Generations = 2
+	p.GrowthRate = 1.5
+	var out strings.Builder
+	dryRun(&out, p, 1)
+	assert.Contains(t, out.String(), "0, dry-run, simulations, 1, agents, 48, ", "Agents are projected")
+}
+
+func TestSubcommand(t *testing.T) {
+	command, args := subcommand([]string{"analyze", "-input", "sim.json", "-analysis", "NH"})
+	assert.Equal(t, "analyze", command, "Analyze is chosen")
+	opts, err := parseAnalyzeFlags(flag.NewFlagSet("analyze", flag.ContinueOnError), args)
+	require.Nil(t, err, "Analyze flags parse")
+	assert.Equal(t, analyzeOptions{input: "sim.json", analysis: "NH"}, opts, "Analyze options are set")
+
+	command, args = subcommand([]string{"-agents", "10"})
+	assert.Equal(t, "run", command, "Run is chosen without a subcommand")
+	assert.Equal(t, []string{"-agents", "10"}, args, "Run gets every argument")
+
+	command, args = subcommand([]string{"export", "-input", "sim.json"})
+	assert.Equal(t, "export", command, "Export is chosen")
+	_, err = parseExportFlags(flag.NewFlagSet("export", flag.ContinueOnError), args)
+	assert.NotNil(t, err, "Export needs an output file")
+}
+
+func TestAnalyzeSavedSimulation(t *testing.T) {
+	parameters := abm.NewParameters()
+	parameters.NumAgents = 10
+	parameters.Generations = 3
+	parameters.Seed = 2
+	simulation := abm.NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	path := filepath.Join(t.TempDir(), "sim.json")
+	require.Nil(t, writeFile(path, simulation.WriteJSON), "Simulation is saved")
+
+	assert.Nil(t, analyzeSimulation(analyzeOptions{input: path, analysis: "N"}), "Saved simulation is analyzed")
+	assert.NotNil(t, analyzeSimulation(analyzeOptions{input: path, analysis: "Z"}), "Invalid analysis is an error")
+	csv := filepath.Join(t.TempDir(), "sim.csv")
+	require.Nil(t, exportSimulation(exportOptions{input: path, csv: csv}), "Saved simulation is exported")
+	_, err := os.Stat(csv)
+	assert.Nil(t, err, "CSV file is written")
+}
+
+func TestFormatFlag(t *testing.T) {
+	_, opts, err := parseFlags(flag.NewFlagSet("ancestry", flag.ContinueOnError), []string{"-format", "tsv"})
+	require.Nil(t, err, "Flags parse")
+	assert.Equal(t, "tsv", opts.format, "Format is set")
+	_, _, err = parseFlags(flag.NewFlagSet("ancestry", flag.ContinueOnError), []string{"-format", "xml"})
+	assert.NotNil(t, err, "Unknown format is an error")
+
+	parameters := abm.NewParameters()
+	parameters.NumAgents = 10
+	parameters.Generations = 2
+	simulation := abm.NewSimulation(&parameters)
+	require.Nil(t, simulation.Simulate(), "Simulation succeeds")
+	var out strings.Builder
+	require.Nil(t, agentsWriter(simulation, "tsv")(&out), "Agents are written as TSV")
+	assert.True(t, strings.HasPrefix(out.String(), "id\tgeneration\t"), "Fields are separated by tabs")
+}
+
+func TestMRCAHubsFlag(t *testing.T) {
+	_, opts, err := parseFlags(flag.NewFlagSet("ancestry", flag.ContinueOnError), []string{"-mrcahubs", "3"})
+	require.Nil(t, err, "Flags parse")
+	assert.Equal(t, 3, opts.mrcaHubs, "Number of hubs is set")
+	_, _, err = parseFlags(flag.NewFlagSet("ancestry", flag.ContinueOnError), []string{"-mrcahubs", "-1"})
+	assert.NotNil(t, err, "Negative number of hubs is an error")
+}
+
+func TestResumeFlag(t *testing.T) {
+	params := abm.NewParameters()
+	params.NumAgents = 20
+	params.Generations = 3
+	params.GrowthRate = 1.0
+	params.CheckpointEvery = 3
+	params.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint.json")
+	require.Nil(t, abm.NewSimulation(&params).Simulate(), "Checkpointed run succeeds")
+
+	fs := flag.NewFlagSet("ancestry", flag.ContinueOnError)
+	p, opts, err := parseFlags(fs, []string{"-resume", params.CheckpointPath, "-generations", "5"})
+	require.Nil(t, err, "Flags parse")
+	require.NotNil(t, opts.resumed, "Checkpoint is loaded")
+	assert.Equal(t, 20, p.NumAgents, "Checkpoint sets the number of agents")
+	assert.Equal(t, 5, p.Generations, "Flags override the checkpoint")
+	require.Nil(t, opts.resumed.SetParameters(p), "Parameters apply to the resumed simulation")
+	require.Nil(t, opts.resumed.Simulate(), "Resumed run succeeds")
+	assert.Equal(t, 6, opts.resumed.NumGenerations(), "Resumed run makes the extra generations")
+
+	fs = flag.NewFlagSet("ancestry", flag.ContinueOnError)
+	_, _, err = parseFlags(fs, []string{"-resume", params.CheckpointPath, "-config", "config.json"})
+	assert.NotNil(t, err, "Config and resume can't both be given")
+}